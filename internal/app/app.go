@@ -25,11 +25,15 @@ type App struct {
 	tray          *system.Tray
 	version       string
 	updater       *update.Service
+	deviceSync    deviceSyncJob
+	stopWatch     func()
+	stopStateSync func()
 }
 
-// NewApp creates a new App application struct
-func NewApp(version string, updateOwner string, updateRepo string) *App {
-	store := state.NewStore("LiteSound")
+// NewApp creates a new App application struct. State is kept in dataDir,
+// or in the user config directory when dataDir.Path is empty.
+func NewApp(version string, updateOwner string, updateRepo string, dataDir state.DataDir) *App {
+	store := state.NewStoreInDir("LiteSound", dataDir)
 	return &App{
 		store:   store,
 		library: library.New(store),
@@ -74,6 +78,12 @@ func (a *App) startup(ctx context.Context) {
 	if a.tray != nil {
 		a.tray.Start(a.ctx)
 	}
+	a.store.SetRecoveryHandler(func(recovery state.Recovery) {
+		wailsruntime.EventsEmit(a.ctx, "state:recovered", recovery)
+	})
+	a.store.Subscribe(a.forwardStateChange)
+	a.stopWatch = a.store.Watch(stateWatchInterval)
+	a.stopStateSync = a.store.StartSync(stateSyncInterval)
 	if theme, err := a.store.GetTheme(); err == nil {
 		system.ApplyTheme(a.ctx, theme)
 	}
@@ -86,6 +96,16 @@ func (a *App) GetStreamBaseURL() string {
 
 func (a *App) shutdown(ctx context.Context) {
 	system.StopHotkeys()
+	a.CancelDeviceSync()
+	if a.stopWatch != nil {
+		a.stopWatch()
+	}
+	if a.stopStateSync != nil {
+		a.stopStateSync()
+	}
+	if a.store != nil {
+		_ = a.store.Flush()
+	}
 	if a.streamServer == nil {
 		return
 	}
@@ -99,6 +119,9 @@ func (a *App) autoUpdateOnStartup() {
 	if runtime.GOOS != "windows" {
 		return
 	}
+	if !Preferences(a).CheckForUpdates {
+		return
+	}
 	currentVersion := strings.TrimSpace(a.version)
 	if currentVersion == "" || strings.EqualFold(currentVersion, "dev") {
 		return
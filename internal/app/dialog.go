@@ -6,6 +6,23 @@ import (
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
+var playlistFileFilters = []runtime.FileFilter{
+	{DisplayName: "Playlists (*.m3u;*.m3u8;*.xspf;*.pls)", Pattern: "*.m3u;*.m3u8;*.xspf;*.pls"},
+}
+
+var bundleFileFilters = []runtime.FileFilter{
+	{DisplayName: "Playlist bundles (*.zip)", Pattern: "*.zip"},
+}
+
+var settingsFileFilters = []runtime.FileFilter{
+	{DisplayName: "LiteSound settings (*.json)", Pattern: "*.json"},
+}
+
+var historyFileFilters = []runtime.FileFilter{
+	{DisplayName: "CSV (*.csv)", Pattern: "*.csv"},
+	{DisplayName: "JSON (*.json)", Pattern: "*.json"},
+}
+
 func (a *App) PickMusicDir(current string) (string, error) {
 	dir := strings.TrimSpace(current)
 	if dir == "" && a.store != nil {
@@ -19,3 +36,89 @@ func (a *App) PickMusicDir(current string) (string, error) {
 		DefaultDirectory: dir,
 	})
 }
+
+func (a *App) PickStateSyncFolder(current string) (string, error) {
+	return runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:                "Select Shared Sync Folder",
+		DefaultDirectory:     strings.TrimSpace(current),
+		CanCreateDirectories: true,
+	})
+}
+
+func (a *App) PickSyncTarget(current string) (string, error) {
+	return runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:            "Select Device Folder",
+		DefaultDirectory: strings.TrimSpace(current),
+	})
+}
+
+func (a *App) PickPlaylistFile() (string, error) {
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Import Playlist",
+		Filters: playlistFileFilters,
+	})
+}
+
+func (a *App) PickPlaylistBundle() (string, error) {
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Import Playlist Bundle",
+		Filters: bundleFileFilters,
+	})
+}
+
+func (a *App) PickBundleExportPath(defaultName string) (string, error) {
+	return runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Playlist Bundle",
+		DefaultFilename: defaultName,
+		Filters:         bundleFileFilters,
+	})
+}
+
+func (a *App) PickStreamingCSV() (string, error) {
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Import Streaming Export",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "CSV files (*.csv)", Pattern: "*.csv"},
+		},
+	})
+}
+
+func (a *App) PickLibraryExports() ([]string, error) {
+	return runtime.OpenMultipleFilesDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Import From Another Player",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "Library exports (*.xml;*.m3u;*.m3u8;*.xspf;*.pls)", Pattern: "*.xml;*.m3u;*.m3u8;*.xspf;*.pls"},
+		},
+	})
+}
+
+func (a *App) PickPlaylistExportPath(defaultName string) (string, error) {
+	return runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Playlist",
+		DefaultFilename: defaultName,
+		Filters:         playlistFileFilters,
+	})
+}
+
+func (a *App) PickSettingsFile() (string, error) {
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Import Settings",
+		Filters: settingsFileFilters,
+	})
+}
+
+func (a *App) PickSettingsExportPath(defaultName string) (string, error) {
+	return runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Settings",
+		DefaultFilename: defaultName,
+		Filters:         settingsFileFilters,
+	})
+}
+
+func (a *App) PickHistoryExportPath(defaultName string) (string, error) {
+	return runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Listening History",
+		DefaultFilename: defaultName,
+		Filters:         historyFileFilters,
+	})
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"errors"
+
+	"LiteSound/internal/state"
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// RecordPlay adds a play to the listening history and the track's play or
+// skip count. The frontend calls it when a track ends or is skipped.
+func (a *App) RecordPlay(record state.PlayRecord) (state.PlayRecord, error) {
+	if a.store == nil {
+		return record, nil
+	}
+	record, err := a.store.RecordPlay(record)
+	if errors.Is(err, state.ErrPlayStatsNotSaved) {
+		// The play is in the history, so report success rather than have
+		// the frontend record it twice.
+		if a.ctx != nil {
+			wailsruntime.LogWarningf(a.ctx, "Counting the play of %s failed: %v", record.Path, err)
+		}
+		return record, nil
+	}
+	if err != nil {
+		return state.PlayRecord{}, err
+	}
+	if record.Outcome == state.PlayCompleted {
+		if stats, err := a.store.GetTrackStats(record.Path); err == nil {
+			a.writeRatingTags(record.Path, stats)
+		}
+	}
+	return record, nil
+}
+
+func (a *App) GetPlayHistory(query state.HistoryQuery) (state.HistoryPage, error) {
+	if a.store == nil {
+		return state.HistoryPage{Records: []state.PlayRecord{}}, nil
+	}
+	return a.store.QueryHistory(query)
+}
+
+func (a *App) ExportPlayHistory(dest string, query state.HistoryQuery) (int, error) {
+	if a.store == nil {
+		return 0, nil
+	}
+	return a.store.ExportHistory(dest, query)
+}
@@ -1,7 +1,9 @@
 package app
 
 import (
+	"LiteSound/internal/library"
 	"LiteSound/internal/media"
+	"LiteSound/internal/state"
 )
 
 func (a *App) GetMusicDir() string {
@@ -22,6 +24,13 @@ func (a *App) GetMusicDirs() ([]string, error) {
 	return a.store.ResolveMusicDirs()
 }
 
+func (a *App) GetMusicRoots() ([]state.MusicRoot, error) {
+	if a.store == nil {
+		return nil, nil
+	}
+	return a.store.GetMusicRoots()
+}
+
 func (a *App) SetMusicDir(path string) (string, error) {
 	if a.store == nil {
 		return "", nil
@@ -43,9 +52,74 @@ func (a *App) ListMusicFiles() ([]media.MusicFile, error) {
 	return a.library.ListMusicFiles()
 }
 
+func (a *App) ListHiddenMusicFiles() ([]media.MusicFile, error) {
+	if a.library == nil {
+		return nil, nil
+	}
+	return a.library.ListHiddenMusicFiles()
+}
+
+func (a *App) GetExclusions() (state.Exclusions, error) {
+	if a.store == nil {
+		return state.Exclusions{}, nil
+	}
+	return a.store.GetExclusions()
+}
+
+func (a *App) SetTrackHidden(path string, hidden bool) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.SetTrackHidden(path, hidden)
+}
+
+func (a *App) SetAlbumHidden(album string, hidden bool) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.SetAlbumHidden(album, hidden)
+}
+
+func (a *App) SetTrackSkipShuffle(path string, skip bool) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.SetTrackSkipShuffle(path, skip)
+}
+
+func (a *App) SetAlbumSkipShuffle(album string, skip bool) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.SetAlbumSkipShuffle(album, skip)
+}
+
+func (a *App) RestoreHiddenItems() error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.RestoreHiddenItems()
+}
+
 func (a *App) ReadMusicFile(path string) ([]byte, error) {
 	if a.library == nil {
 		return nil, nil
 	}
 	return a.library.ReadMusicFile(path)
 }
+
+// PreviewLibraryImport reports what ImportLibrary would change without
+// saving anything.
+func (a *App) PreviewLibraryImport(options library.LibraryImportOptions) (library.LibraryImportSummary, error) {
+	if a.library == nil {
+		return library.LibraryImportSummary{}, nil
+	}
+	return a.library.ImportLibrary(options, true)
+}
+
+func (a *App) ImportLibrary(options library.LibraryImportOptions) (library.LibraryImportSummary, error) {
+	if a.library == nil {
+		return library.LibraryImportSummary{}, nil
+	}
+	return a.library.ImportLibrary(options, false)
+}
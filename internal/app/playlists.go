@@ -1,12 +1,31 @@
 package app
 
-import "LiteSound/internal/state"
+import (
+	"LiteSound/internal/library"
+	"LiteSound/internal/media"
+	"LiteSound/internal/state"
+)
 
-func (a *App) GetPlaylists() ([]state.Playlist, error) {
+func (a *App) GetPlaylists() ([]state.PlaylistView, error) {
 	if a.store == nil {
 		return nil, nil
 	}
-	return a.store.GetPlaylists()
+	playlists, err := a.store.GetPlaylists()
+	if err != nil {
+		return nil, err
+	}
+	views := make([]state.PlaylistView, 0, len(playlists))
+	for _, playlist := range playlists {
+		views = append(views, state.PlaylistView{Playlist: playlist})
+	}
+	if a.library == nil {
+		return views, nil
+	}
+	smart, err := a.library.SmartPlaylistViews()
+	if err != nil {
+		return nil, err
+	}
+	return append(views, smart...), nil
 }
 
 func (a *App) CreatePlaylist(name string) error {
@@ -36,3 +55,213 @@ func (a *App) DeletePlaylist(name string) error {
 	}
 	return a.store.DeletePlaylist(name)
 }
+
+func (a *App) AddTracksToPlaylist(name string, paths []string) (state.BatchResult, error) {
+	if a.store == nil {
+		return state.BatchResult{}, nil
+	}
+	return a.store.AddTracksToPlaylist(name, paths)
+}
+
+func (a *App) RemoveTracksFromPlaylist(name string, paths []string) (state.BatchResult, error) {
+	if a.store == nil {
+		return state.BatchResult{}, nil
+	}
+	return a.store.RemoveTracksFromPlaylist(name, paths)
+}
+
+func (a *App) ReplacePlaylistTracks(name string, paths []string) (state.BatchResult, error) {
+	if a.store == nil {
+		return state.BatchResult{}, nil
+	}
+	return a.store.ReplacePlaylistTracks(name, paths)
+}
+
+func (a *App) RenamePlaylist(name string, newName string) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.RenamePlaylist(name, newName)
+}
+
+func (a *App) DuplicatePlaylist(name string, newName string) (state.Playlist, error) {
+	if a.store == nil {
+		return state.Playlist{}, nil
+	}
+	return a.store.DuplicatePlaylist(name, newName)
+}
+
+func (a *App) MergePlaylists(target string, sources []string, options state.MergeOptions) (state.Playlist, error) {
+	if a.store == nil {
+		return state.Playlist{}, nil
+	}
+	return a.store.MergePlaylists(target, sources, options)
+}
+
+func (a *App) GetPlaylist(name string) (state.Playlist, error) {
+	if a.store == nil {
+		return state.Playlist{}, nil
+	}
+	return a.store.GetPlaylist(name)
+}
+
+func (a *App) UpdatePlaylistDetails(name string, description string, coverImage string) (state.Playlist, error) {
+	if a.store == nil {
+		return state.Playlist{}, nil
+	}
+	return a.store.UpdatePlaylistDetails(name, description, coverImage)
+}
+
+func (a *App) InsertIntoPlaylist(name string, path string, index int) (state.PlaylistEntry, error) {
+	if a.store == nil {
+		return state.PlaylistEntry{}, nil
+	}
+	return a.store.InsertIntoPlaylist(name, path, index)
+}
+
+func (a *App) RemovePlaylistEntry(name string, entryID string) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.RemovePlaylistEntry(name, entryID)
+}
+
+func (a *App) MovePlaylistEntry(name string, entryID string, index int) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.MovePlaylistEntry(name, entryID, index)
+}
+
+func (a *App) ReorderPlaylist(name string, entryIDs []string) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.ReorderPlaylist(name, entryIDs)
+}
+
+func (a *App) GetPlaylistTree() (state.PlaylistTree, error) {
+	if a.store == nil {
+		return state.PlaylistTree{}, nil
+	}
+	return a.store.GetPlaylistTree()
+}
+
+func (a *App) CreatePlaylistFolder(name string, parentID string) (state.PlaylistFolder, error) {
+	if a.store == nil {
+		return state.PlaylistFolder{}, nil
+	}
+	return a.store.CreatePlaylistFolder(name, parentID)
+}
+
+func (a *App) RenamePlaylistFolder(id string, name string) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.RenamePlaylistFolder(id, name)
+}
+
+func (a *App) DeletePlaylistFolder(id string) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.DeletePlaylistFolder(id)
+}
+
+func (a *App) MovePlaylistToFolder(name string, folderID string, index int) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.MovePlaylistToFolder(name, folderID, index)
+}
+
+func (a *App) MovePlaylistFolder(id string, parentID string, index int) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.MovePlaylistFolder(id, parentID, index)
+}
+
+func (a *App) GetSmartPlaylists() ([]state.SmartPlaylist, error) {
+	if a.store == nil {
+		return nil, nil
+	}
+	return a.store.GetSmartPlaylists()
+}
+
+func (a *App) CreateSmartPlaylist(definition state.SmartPlaylist) (state.SmartPlaylist, error) {
+	if a.store == nil {
+		return state.SmartPlaylist{}, nil
+	}
+	return a.store.CreateSmartPlaylist(definition)
+}
+
+func (a *App) UpdateSmartPlaylist(definition state.SmartPlaylist) (state.SmartPlaylist, error) {
+	if a.store == nil {
+		return state.SmartPlaylist{}, nil
+	}
+	return a.store.UpdateSmartPlaylist(definition)
+}
+
+func (a *App) DeleteSmartPlaylist(name string) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.DeleteSmartPlaylist(name)
+}
+
+func (a *App) PreviewSmartPlaylist(definition state.SmartPlaylist) ([]media.MusicFile, error) {
+	if a.library == nil {
+		return nil, nil
+	}
+	return a.library.EvaluateSmartPlaylist(definition)
+}
+
+func (a *App) ImportPlaylistFile(path string, name string) (library.ImportReport, error) {
+	if a.library == nil {
+		return library.ImportReport{}, nil
+	}
+	return a.library.ImportPlaylistFile(path, name)
+}
+
+func (a *App) ImportFolderPlaylists(options library.FolderImportOptions) (library.FolderImportResult, error) {
+	if a.library == nil {
+		return library.FolderImportResult{}, nil
+	}
+	return a.library.ImportFolderPlaylists(options)
+}
+
+func (a *App) StopFolderSync(name string) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.StopFolderSync(name)
+}
+
+func (a *App) ExportPlaylistBundle(name string, dest string) (library.BundleExportResult, error) {
+	if a.library == nil {
+		return library.BundleExportResult{}, nil
+	}
+	return a.library.ExportPlaylistBundle(name, dest)
+}
+
+func (a *App) ImportPlaylistBundle(path string, root string) (library.BundleImportReport, error) {
+	if a.library == nil {
+		return library.BundleImportReport{}, nil
+	}
+	return a.library.ImportPlaylistBundle(path, root)
+}
+
+func (a *App) ImportStreamingCSV(path string, name string) (library.MatchReport, error) {
+	if a.library == nil {
+		return library.MatchReport{}, nil
+	}
+	return a.library.ImportStreamingCSV(path, name)
+}
+
+func (a *App) ExportPlaylistFile(name string, dest string, options library.ExportOptions) error {
+	if a.library == nil {
+		return nil
+	}
+	return a.library.ExportPlaylistFile(name, dest, options)
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"LiteSound/internal/state"
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Preferences returns the preferences main needs before the window is
+// created, or the defaults when they cannot be read.
+func Preferences(a *App) state.Preferences {
+	if a == nil || a.store == nil {
+		return state.DefaultPreferences()
+	}
+	preferences, err := a.store.GetPreferences()
+	if err != nil {
+		return state.DefaultPreferences()
+	}
+	return preferences
+}
+
+func (a *App) GetPreferences() (state.Preferences, error) {
+	if a.store == nil {
+		return state.DefaultPreferences(), nil
+	}
+	return a.store.GetPreferences()
+}
+
+// SetPreference changes one preference, named by its JSON key, and returns
+// them all. A new window size is applied right away.
+func (a *App) SetPreference(key string, value any) (state.Preferences, error) {
+	if a.store == nil {
+		return state.DefaultPreferences(), nil
+	}
+	preferences, err := a.store.SetPreference(key, value)
+	if err != nil {
+		return state.Preferences{}, err
+	}
+	if (key == "windowWidth" || key == "windowHeight") && a.ctx != nil {
+		wailsruntime.WindowSetSize(a.ctx, preferences.WindowWidth, preferences.WindowHeight)
+	}
+	return preferences, nil
+}
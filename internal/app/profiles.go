@@ -0,0 +1,67 @@
+package app
+
+import (
+	"LiteSound/internal/state"
+	"LiteSound/internal/system"
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+func (a *App) ListProfiles() ([]state.Profile, error) {
+	if a.store == nil {
+		return []state.Profile{}, nil
+	}
+	return a.store.ListProfiles()
+}
+
+func (a *App) GetActiveProfile() (state.Profile, error) {
+	if a.store == nil {
+		return state.Profile{}, nil
+	}
+	return a.store.ActiveProfile()
+}
+
+func (a *App) CreateProfile(name string, sharedRoots bool) (state.Profile, error) {
+	if a.store == nil {
+		return state.Profile{}, nil
+	}
+	return a.store.CreateProfile(name, sharedRoots)
+}
+
+func (a *App) DeleteProfile(id string) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.DeleteProfile(id)
+}
+
+// SwitchProfile makes another profile current without a restart. The store
+// is shared by the library and the stream server, so both follow it; a
+// running device sync is cancelled, the library index is dropped, the tray
+// is reset and the profile's theme applied. A "profile:switched" event
+// tells the frontend to reload.
+func (a *App) SwitchProfile(id string) (state.Profile, error) {
+	if a.store == nil {
+		return state.Profile{}, nil
+	}
+	a.CancelDeviceSync()
+	if _, err := a.store.SwitchProfile(id); err != nil {
+		return state.Profile{}, err
+	}
+	if a.library != nil {
+		a.library.Invalidate()
+	}
+	if a.tray != nil {
+		a.tray.UpdatePlayback("", false, "")
+	}
+	profile, err := a.store.ActiveProfile()
+	if err != nil {
+		return state.Profile{}, err
+	}
+	if a.ctx != nil {
+		if theme, err := a.store.GetTheme(); err == nil {
+			system.ApplyTheme(a.ctx, theme)
+		}
+		wailsruntime.EventsEmit(a.ctx, "profile:switched", profile)
+	}
+	return profile, nil
+}
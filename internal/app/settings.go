@@ -0,0 +1,42 @@
+package app
+
+import (
+	"LiteSound/internal/state"
+	"LiteSound/internal/system"
+)
+
+// ExportSettings writes the chosen sections of the state ("musicDirs",
+// "theme", "filters", "playlists", "exclusions", "stats") to a settings
+// archive. No sections exports all of them.
+func (a *App) ExportSettings(path string, sections []string) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.ExportSettings(path, sections)
+}
+
+// PreviewSettingsImport checks a settings archive and reports what
+// ImportSettings would change without saving anything.
+func (a *App) PreviewSettingsImport(path string, options state.SettingsImportOptions) (state.SettingsImportResult, error) {
+	if a.store == nil {
+		return state.SettingsImportResult{}, nil
+	}
+	return a.store.ImportSettings(path, options, true)
+}
+
+func (a *App) ImportSettings(path string, options state.SettingsImportOptions) (state.SettingsImportResult, error) {
+	if a.store == nil {
+		return state.SettingsImportResult{}, nil
+	}
+	result, err := a.store.ImportSettings(path, options, false)
+	if err != nil {
+		return result, err
+	}
+	if a.library != nil {
+		a.library.Invalidate()
+	}
+	if theme, err := a.store.GetTheme(); err == nil && a.ctx != nil {
+		system.ApplyTheme(a.ctx, theme)
+	}
+	return result, nil
+}
@@ -1,6 +1,12 @@
 package app
 
-import "LiteSound/internal/state"
+import (
+	"time"
+
+	"LiteSound/internal/state"
+	"LiteSound/internal/system"
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
 
 func (a *App) GetActivePlaylist() (string, error) {
 	if a.store == nil {
@@ -50,3 +56,77 @@ func (a *App) SetFilters(composer string, album string) error {
 	}
 	return a.store.SetFilters(composer, album)
 }
+
+func (a *App) ListStateSnapshots() ([]state.Snapshot, error) {
+	if a.store == nil {
+		return []state.Snapshot{}, nil
+	}
+	return a.store.ListSnapshots()
+}
+
+func (a *App) RestoreStateSnapshot(id string) error {
+	if a.store == nil {
+		return nil
+	}
+	_, err := a.store.RestoreSnapshot(id)
+	return err
+}
+
+func (a *App) UndoPlaylistOperation() (state.Snapshot, error) {
+	if a.store == nil {
+		return state.Snapshot{}, nil
+	}
+	return a.store.UndoPlaylistOperation()
+}
+
+func (a *App) GetStateRecovery() *state.Recovery {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.GetRecovery()
+}
+
+func (a *App) GetDataDir() (state.DataDirInfo, error) {
+	if a.store == nil {
+		return state.DataDirInfo{}, nil
+	}
+	return a.store.DataDirInfo()
+}
+
+// MigrateDataDir moves the state from the default location into the data
+// directory in use and applies the migrated theme.
+func (a *App) MigrateDataDir() error {
+	if a.store == nil {
+		return nil
+	}
+	if _, err := a.store.MigrateDataDir(); err != nil {
+		return err
+	}
+	if theme, err := a.store.GetTheme(); err == nil && a.ctx != nil {
+		system.ApplyTheme(a.ctx, theme)
+	}
+	return nil
+}
+
+// stateWatchInterval is how often state.json is checked for outside edits.
+const stateWatchInterval = 2 * time.Second
+
+// forwardStateChange emits a store change as a "state:<kind>" event, such
+// as "state:playlists". Edits of state.json made outside the app, and
+// changes synced from other devices, also get their theme applied here,
+// since no binding did that for them. Changed music directories and
+// preferences drop the library index, so the next listing rescans.
+func (a *App) forwardStateChange(change state.Change) {
+	if (change.Kind == state.ChangeMusicDirs || change.Kind == state.ChangePreferences) && a.library != nil {
+		a.library.Invalidate()
+	}
+	if a.ctx == nil {
+		return
+	}
+	if change.Kind == state.ChangeTheme && change.Source != state.ChangeFromApp {
+		if theme, err := a.store.GetTheme(); err == nil {
+			system.ApplyTheme(a.ctx, theme)
+		}
+	}
+	wailsruntime.EventsEmit(a.ctx, "state:"+change.Kind, change)
+}
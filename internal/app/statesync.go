@@ -0,0 +1,61 @@
+package app
+
+import (
+	"time"
+
+	"LiteSound/internal/state"
+)
+
+// stateSyncInterval is how often playlists are synced through the shared
+// folder while state sync is enabled.
+const stateSyncInterval = 15 * time.Second
+
+func (a *App) GetStateSyncStatus() (state.SyncStatus, error) {
+	if a.store == nil {
+		return state.SyncStatus{}, nil
+	}
+	return a.store.SyncStatus()
+}
+
+// EnableStateSync shares playlists, theme and filters with other devices
+// through dir and runs a first sync.
+func (a *App) EnableStateSync(dir string, deviceName string) (state.SyncStatus, error) {
+	if a.store == nil {
+		return state.SyncStatus{}, nil
+	}
+	if _, err := a.store.EnableSync(dir, deviceName); err != nil {
+		return state.SyncStatus{}, err
+	}
+	if _, err := a.store.SyncNow(); err != nil {
+		return state.SyncStatus{}, err
+	}
+	return a.store.SyncStatus()
+}
+
+func (a *App) DisableStateSync() error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.DisableSync()
+}
+
+func (a *App) SyncStateNow() (state.SyncResult, error) {
+	if a.store == nil {
+		return state.SyncResult{}, nil
+	}
+	return a.store.SyncNow()
+}
+
+func (a *App) GetSyncConflicts() ([]state.SyncConflict, error) {
+	if a.store == nil {
+		return []state.SyncConflict{}, nil
+	}
+	return a.store.SyncConflicts()
+}
+
+func (a *App) DismissSyncConflict(id string) error {
+	if a.store == nil {
+		return nil
+	}
+	return a.store.DismissSyncConflict(id)
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"errors"
+
+	"LiteSound/internal/media"
+	"LiteSound/internal/state"
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+func (a *App) GetTrackStats(path string) (state.TrackStats, error) {
+	if a.store == nil {
+		return state.TrackStats{}, nil
+	}
+	return a.store.GetTrackStats(path)
+}
+
+func (a *App) GetAllTrackStats() (map[string]state.TrackStats, error) {
+	if a.store == nil {
+		return map[string]state.TrackStats{}, nil
+	}
+	return a.store.GetAllTrackStats()
+}
+
+// RateTrack sets a track's rating, 0 to 5 stars in half-star steps.
+func (a *App) RateTrack(path string, rating float64) (state.TrackStats, error) {
+	if a.store == nil {
+		return state.TrackStats{}, nil
+	}
+	stats, err := a.store.RateTrack(path, rating)
+	if err != nil {
+		return state.TrackStats{}, err
+	}
+	a.writeRatingTags(path, stats)
+	return stats, nil
+}
+
+// writeRatingTags copies a track's rating and play count into its tags when
+// the ratingTags preference is on. The store keeps them either way, so a
+// failure is only logged.
+func (a *App) writeRatingTags(path string, stats state.TrackStats) {
+	if a.library == nil || !Preferences(a).RatingTags {
+		return
+	}
+	err := a.library.WriteRatingTags(path, stats)
+	if err != nil && !errors.Is(err, media.ErrTagsUnsupported) && a.ctx != nil {
+		wailsruntime.LogWarningf(a.ctx, "Writing rating tags to %s failed: %v", path, err)
+	}
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"LiteSound/internal/devicesync"
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+type deviceSyncJob struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+type DeviceSyncDone struct {
+	Result devicesync.Result `json:"result"`
+	Error  string            `json:"error"`
+}
+
+// StartDeviceSync starts mirroring playlists into a device folder in the
+// background. Progress is reported through "sync:progress" events and the
+// outcome through a single "sync:done" event.
+func (a *App) StartDeviceSync(options devicesync.Options) error {
+	if a.library == nil || a.store == nil {
+		return nil
+	}
+	if len(options.Playlists) == 0 {
+		return errors.New("at least one playlist is required")
+	}
+	dirs, err := a.store.ResolveMusicDirs()
+	if err != nil {
+		return err
+	}
+	options.MusicDirs = dirs
+	playlists := make([]devicesync.Playlist, 0, len(options.Playlists))
+	for _, name := range options.Playlists {
+		tracks, err := a.library.PlaylistTracks(name)
+		if err != nil {
+			return err
+		}
+		playlists = append(playlists, devicesync.Playlist{Name: name, Tracks: tracks})
+	}
+
+	a.deviceSync.mu.Lock()
+	defer a.deviceSync.mu.Unlock()
+	if a.deviceSync.cancel != nil {
+		return errors.New("a device sync is already running")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.deviceSync.cancel = cancel
+
+	go func() {
+		result, err := devicesync.Run(ctx, playlists, options, func(progress devicesync.Progress) {
+			if a.ctx != nil {
+				wailsruntime.EventsEmit(a.ctx, "sync:progress", progress)
+			}
+		})
+		a.deviceSync.mu.Lock()
+		a.deviceSync.cancel = nil
+		a.deviceSync.mu.Unlock()
+		cancel()
+		done := DeviceSyncDone{Result: result}
+		if err != nil {
+			done.Error = err.Error()
+		}
+		if a.ctx != nil {
+			wailsruntime.EventsEmit(a.ctx, "sync:done", done)
+		}
+	}()
+	return nil
+}
+
+func (a *App) CancelDeviceSync() {
+	a.deviceSync.mu.Lock()
+	defer a.deviceSync.mu.Unlock()
+	if a.deviceSync.cancel != nil {
+		a.deviceSync.cancel()
+	}
+}
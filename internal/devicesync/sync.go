@@ -0,0 +1,446 @@
+// Package devicesync mirrors playlists into a folder on a portable player or
+// phone mounted as a drive.
+package devicesync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"LiteSound/internal/media"
+	"LiteSound/internal/playlistfmt"
+)
+
+const (
+	LayoutArtistAlbum = "{artist}/{album}/{file}"
+	LayoutFlat        = "{file}"
+	LayoutPlaylist    = "{playlist}/{file}"
+)
+
+// manifestName is the file at the target listing, relative to the target,
+// the files syncs have copied there. Only those are ever deleted.
+const manifestName = ".litesound-sync.json"
+
+// mtimeSlack covers the two-second timestamp resolution of FAT file systems.
+const mtimeSlack = 2 * time.Second
+
+type Options struct {
+	Playlists []string `json:"playlists"`
+	Target    string   `json:"target"`
+	// Layout is a path template relative to Target using {artist},
+	// {album}, {title}, {track}, {playlist}, {file} and {ext}. Empty means
+	// LayoutArtistAlbum.
+	Layout string `json:"layout"`
+	// DeleteExtras removes audio files that an earlier sync copied to
+	// Target and that this sync no longer places there. Files the sync did
+	// not write are never deleted.
+	DeleteExtras bool `json:"deleteExtras"`
+	// WritePlaylists writes "<playlist>.m3u8" at Target for each playlist,
+	// with paths relative to Target.
+	WritePlaylists bool `json:"writePlaylists"`
+	// MusicDirs are the library's music directories. Run refuses a Target
+	// that is inside one of them or contains one.
+	MusicDirs []string `json:"-"`
+}
+
+type Playlist struct {
+	Name   string
+	Tracks []media.MusicFile
+}
+
+type Progress struct {
+	Phase   string `json:"phase"`
+	Current int    `json:"current"`
+	Total   int    `json:"total"`
+	Path    string `json:"path"`
+}
+
+type Failure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type Result struct {
+	Copied    int       `json:"copied"`
+	Skipped   int       `json:"skipped"`
+	Deleted   int       `json:"deleted"`
+	Playlists []string  `json:"playlists"`
+	Failures  []Failure `json:"failures"`
+}
+
+type plannedFile struct {
+	source string
+	dest   string
+}
+
+// Run copies the playlists' tracks into options.Target. Files whose copy on
+// the target already has the same size and a modification time at least as
+// new are skipped. progress, if not nil, is called as each file is handled.
+// Cancelling ctx stops the sync after the current file and returns
+// ctx.Err() with the result so far.
+func Run(ctx context.Context, playlists []Playlist, options Options, progress func(Progress)) (Result, error) {
+	result := Result{Playlists: []string{}, Failures: []Failure{}}
+	target := strings.TrimSpace(options.Target)
+	if target == "" {
+		return result, errors.New("target directory is required")
+	}
+	target = filepath.Clean(target)
+	info, err := os.Stat(target)
+	if err != nil {
+		return result, err
+	}
+	if !info.IsDir() {
+		return result, errors.New("target is not a directory")
+	}
+	if media.IsPathWithinAnyDir(options.MusicDirs, target) {
+		return result, errors.New("target is inside a music folder")
+	}
+	for _, dir := range options.MusicDirs {
+		if dir != "" && media.IsPathWithinDir(target, dir) {
+			return result, errors.New("target contains a music folder")
+		}
+	}
+	layout := strings.TrimSpace(options.Layout)
+	if layout == "" {
+		layout = LayoutArtistAlbum
+	}
+	if progress == nil {
+		progress = func(Progress) {}
+	}
+
+	written, err := readManifest(target)
+	if err != nil {
+		return result, err
+	}
+
+	plan := make([]plannedFile, 0)
+	// planned maps each lowercased destination to the source copied there.
+	planned := make(map[string]string)
+	destsByPlaylist := make(map[string][]string, len(playlists))
+	for _, playlist := range playlists {
+		for _, track := range playlist.Tracks {
+			dest, isNew := claimDest(planned, filepath.Join(target, expandLayout(layout, playlist.Name, track)), track.Path)
+			destsByPlaylist[playlist.Name] = append(destsByPlaylist[playlist.Name], dest)
+			if isNew {
+				plan = append(plan, plannedFile{source: track.Path, dest: dest})
+			}
+		}
+	}
+
+	// Files copied before a cancelled sync stopped are still recorded.
+	stop := func(err error) (Result, error) {
+		_ = writeManifest(target, written)
+		return result, err
+	}
+	failed := make(map[string]struct{})
+	for i, file := range plan {
+		if err := ctx.Err(); err != nil {
+			return stop(err)
+		}
+		progress(Progress{Phase: "copying", Current: i + 1, Total: len(plan), Path: file.dest})
+		copied, err := syncFile(ctx, file.source, file.dest)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return stop(ctxErr)
+			}
+			result.Failures = append(result.Failures, Failure{Path: file.source, Error: err.Error()})
+			failed[strings.ToLower(file.dest)] = struct{}{}
+			continue
+		}
+		if copied {
+			written[strings.ToLower(file.dest)] = file.dest
+			result.Copied++
+		} else {
+			result.Skipped++
+		}
+	}
+
+	if options.WritePlaylists {
+		for _, playlist := range playlists {
+			if err := ctx.Err(); err != nil {
+				return stop(err)
+			}
+			name := media.SafeFileName(playlist.Name) + ".m3u8"
+			dest := filepath.Join(target, name)
+			progress(Progress{Phase: "playlist", Path: dest})
+			if err := writePlaylist(dest, target, playlist, destsByPlaylist[playlist.Name], failed); err != nil {
+				result.Failures = append(result.Failures, Failure{Path: dest, Error: err.Error()})
+				continue
+			}
+			result.Playlists = append(result.Playlists, dest)
+		}
+	}
+
+	if options.DeleteExtras {
+		deleted, err := deleteExtras(ctx, target, written, planned, progress)
+		result.Deleted = deleted
+		if writeErr := writeManifest(target, written); writeErr != nil && err == nil {
+			err = writeErr
+		}
+		if err != nil {
+			return result, err
+		}
+	} else if err := writeManifest(target, written); err != nil {
+		return result, err
+	}
+	progress(Progress{Phase: "done", Current: len(plan), Total: len(plan)})
+	return result, nil
+}
+
+func syncFile(ctx context.Context, source string, dest string) (bool, error) {
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return false, err
+	}
+	if destInfo, err := os.Stat(dest); err == nil {
+		if destInfo.Size() == sourceInfo.Size() && !destInfo.ModTime().Add(mtimeSlack).Before(sourceInfo.ModTime()) {
+			return false, nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return false, err
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+	temp, err := os.CreateTemp(filepath.Dir(dest), ".litesound-*.tmp")
+	if err != nil {
+		return false, err
+	}
+	tempPath := temp.Name()
+	if _, err := io.Copy(temp, &contextReader{ctx: ctx, r: in}); err != nil {
+		_ = temp.Close()
+		_ = os.Remove(tempPath)
+		return false, err
+	}
+	if err := temp.Close(); err != nil {
+		_ = os.Remove(tempPath)
+		return false, err
+	}
+	_ = os.Remove(dest)
+	if err := os.Rename(tempPath, dest); err != nil {
+		_ = os.Remove(tempPath)
+		return false, err
+	}
+	if err := os.Chtimes(dest, sourceInfo.ModTime(), sourceInfo.ModTime()); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// claimDest returns where source is copied when the layout puts it at dest.
+// A destination already taken by another source gets a " (2)", " (3)", ...
+// suffix; isNew is false when source was already planned there.
+func claimDest(planned map[string]string, dest string, source string) (string, bool) {
+	ext := filepath.Ext(dest)
+	base := strings.TrimSuffix(dest, ext)
+	candidate := dest
+	for n := 2; ; n++ {
+		owner, ok := planned[strings.ToLower(candidate)]
+		if !ok {
+			planned[strings.ToLower(candidate)] = source
+			return candidate, true
+		}
+		if strings.EqualFold(owner, source) {
+			return candidate, false
+		}
+		candidate = base + " (" + strconv.Itoa(n) + ")" + ext
+	}
+}
+
+// writePlaylist writes the playlist's tracks at dests, leaving out those
+// whose copy failed.
+func writePlaylist(dest string, target string, playlist Playlist, dests []string, failed map[string]struct{}) error {
+	entries := make([]playlistfmt.Entry, 0, len(dests))
+	for i, path := range dests {
+		if _, ok := failed[strings.ToLower(path)]; ok {
+			continue
+		}
+		relative, err := filepath.Rel(target, path)
+		if err != nil {
+			return err
+		}
+		track := playlist.Tracks[i]
+		entries = append(entries, playlistfmt.Entry{
+			Location: filepath.ToSlash(relative),
+			Title:    track.Title,
+			Creator:  track.Artist,
+		})
+	}
+	file, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if err := playlistfmt.WriteM3U(file, entries); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readManifest returns the files earlier syncs copied to target, keyed by
+// their lowercased absolute paths. Entries that would leave target are
+// dropped.
+func readManifest(target string) (map[string]string, error) {
+	files := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(target, manifestName))
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest syncManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.New("invalid sync manifest")
+	}
+	for _, relative := range manifest.Files {
+		relative = filepath.FromSlash(relative)
+		if relative == "" || filepath.IsAbs(relative) || !filepath.IsLocal(relative) {
+			continue
+		}
+		path := filepath.Join(target, relative)
+		files[strings.ToLower(path)] = path
+	}
+	return files, nil
+}
+
+func writeManifest(target string, files map[string]string) error {
+	manifest := syncManifest{Files: make([]string, 0, len(files))}
+	for _, path := range files {
+		relative, err := filepath.Rel(target, path)
+		if err != nil {
+			continue
+		}
+		manifest.Files = append(manifest.Files, filepath.ToSlash(relative))
+	}
+	slices.Sort(manifest.Files)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(target, manifestName), data, 0o644)
+}
+
+type syncManifest struct {
+	Files []string `json:"files"`
+}
+
+// deleteExtras removes the files in written that are not in keep, dropping
+// each one removed, or already gone, from written.
+func deleteExtras(ctx context.Context, target string, written map[string]string, keep map[string]string, progress func(Progress)) (int, error) {
+	extras := make([]string, 0)
+	for key, path := range written {
+		if _, ok := keep[key]; !ok {
+			extras = append(extras, path)
+		}
+	}
+	slices.Sort(extras)
+	deleted := 0
+	for i, path := range extras {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+		progress(Progress{Phase: "deleting", Current: i + 1, Total: len(extras), Path: path})
+		err := os.Remove(path)
+		if err == nil {
+			deleted++
+		}
+		if err == nil || os.IsNotExist(err) {
+			delete(written, strings.ToLower(path))
+			removeEmptyParents(target, filepath.Dir(path))
+		}
+	}
+	return deleted, nil
+}
+
+// removeEmptyParents removes dir and its parents up to target while they
+// are empty.
+func removeEmptyParents(target string, dir string) {
+	for dir != target && len(dir) > len(target) {
+		if entries, err := os.ReadDir(dir); err != nil || len(entries) > 0 {
+			return
+		}
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func expandLayout(layout string, playlist string, track media.MusicFile) string {
+	ext := filepath.Ext(track.Path)
+	fileName := filepath.Base(track.Path)
+	title := track.Title
+	if title == "" {
+		title = strings.TrimSuffix(fileName, ext)
+	}
+	artist := track.Artist
+	if artist == "" {
+		artist = track.Composer
+	}
+	if artist == "" {
+		artist = "Unknown Artist"
+	}
+	album := track.Album
+	if album == "" {
+		album = "Unknown Album"
+	}
+	number := ""
+	if track.Track > 0 {
+		number = strconv.Itoa(track.Track)
+		if track.Track < 10 {
+			number = "0" + number
+		}
+	}
+	values := map[string]string{
+		"{artist}":   artist,
+		"{album}":    album,
+		"{title}":    title,
+		"{track}":    number,
+		"{playlist}": playlist,
+		"{file}":     fileName,
+		"{ext}":      strings.TrimPrefix(ext, "."),
+	}
+	parts := strings.Split(filepath.ToSlash(layout), "/")
+	cleaned := make([]string, 0, len(parts))
+	for _, part := range parts {
+		for token, value := range values {
+			part = strings.ReplaceAll(part, token, value)
+		}
+		part = media.SafeFileName(part)
+		if part == "" {
+			continue
+		}
+		cleaned = append(cleaned, part)
+	}
+	if len(cleaned) == 0 {
+		cleaned = append(cleaned, media.SafeFileName(fileName))
+	}
+	last := cleaned[len(cleaned)-1]
+	if !strings.EqualFold(filepath.Ext(last), ext) {
+		cleaned[len(cleaned)-1] = last + ext
+	}
+	return filepath.Join(cleaned...)
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
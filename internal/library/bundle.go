@@ -0,0 +1,350 @@
+package library
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"LiteSound/internal/media"
+	"LiteSound/internal/playlistfmt"
+	"LiteSound/internal/state"
+)
+
+const (
+	bundleVersion      = 1
+	bundleManifestName = "manifest.json"
+	bundleTracksDir    = "tracks"
+)
+
+// BundleTrack describes one audio file in a playlist bundle. File is its
+// path inside the archive.
+type BundleTrack struct {
+	File     string  `json:"file"`
+	Title    string  `json:"title"`
+	Artist   string  `json:"artist"`
+	Composer string  `json:"composer"`
+	Album    string  `json:"album"`
+	Genre    string  `json:"genre"`
+	Year     int     `json:"year"`
+	Track    int     `json:"track"`
+	Duration float64 `json:"duration"`
+	ISRC     string  `json:"isrc"`
+}
+
+// BundleManifest is the manifest.json at the root of a playlist bundle.
+// Tracks are in playlist order and may repeat a File.
+type BundleManifest struct {
+	Version     int           `json:"version"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Cover       string        `json:"cover"`
+	Playlist    string        `json:"playlist"`
+	ExportedAt  int64         `json:"exportedAt"`
+	Tracks      []BundleTrack `json:"tracks"`
+}
+
+type BundleExportResult struct {
+	Tracks  int      `json:"tracks"`
+	Missing []string `json:"missing"`
+}
+
+type BundleImportReport struct {
+	Playlist  state.Playlist `json:"playlist"`
+	Dir       string         `json:"dir"`
+	Extracted int            `json:"extracted"`
+	Reused    int            `json:"reused"`
+	Missing   []string       `json:"missing"`
+}
+
+// ExportPlaylistBundle writes a ZIP holding the playlist's audio files under
+// tracks/, an M3U8 referring to them relatively, the cover image and
+// manifest.json with the tracks' tags. Entries whose file no longer exists
+// are left out and listed in Missing.
+func (s *Service) ExportPlaylistBundle(name string, dest string) (BundleExportResult, error) {
+	result := BundleExportResult{Missing: []string{}}
+	if strings.TrimSpace(dest) == "" {
+		return result, errors.New("destination is required")
+	}
+	tracks, err := s.PlaylistTracks(name)
+	if err != nil {
+		return result, err
+	}
+	manifest := BundleManifest{
+		Version:    bundleVersion,
+		Name:       strings.TrimSpace(name),
+		ExportedAt: time.Now().UnixMilli(),
+		Tracks:     make([]BundleTrack, 0, len(tracks)),
+	}
+	cover := ""
+	if playlist, err := s.store.GetPlaylist(name); err == nil {
+		manifest.Name = playlist.Name
+		manifest.Description = playlist.Description
+		cover = playlist.CoverImage
+	}
+	manifest.Playlist = bundleFileName(manifest.Name, "Playlist") + ".m3u8"
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return result, err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(dest), ".bundle-*.tmp")
+	if err != nil {
+		return result, err
+	}
+	defer os.Remove(temp.Name())
+	archive := zip.NewWriter(temp)
+
+	written := make(map[string]string)
+	entries := make([]playlistfmt.Entry, 0, len(tracks))
+	for _, track := range tracks {
+		file, ok := written[track.Path]
+		if !ok {
+			file = path.Join(bundleTracksDir, fmt.Sprintf("%03d %s", len(written)+1, bundleFileName(track.Name, "track"+track.Ext)))
+			if err := addFileToZip(archive, track.Path, file); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					result.Missing = append(result.Missing, track.Path)
+					continue
+				}
+				_ = temp.Close()
+				return result, err
+			}
+			written[track.Path] = file
+		}
+		duration := trackDuration(track)
+		manifest.Tracks = append(manifest.Tracks, BundleTrack{
+			File:     file,
+			Title:    track.Title,
+			Artist:   track.Artist,
+			Composer: track.Composer,
+			Album:    track.Album,
+			Genre:    track.Genre,
+			Year:     track.Year,
+			Track:    track.Track,
+			Duration: duration,
+			ISRC:     track.ISRC,
+		})
+		title := track.Title
+		if title == "" {
+			title = strings.TrimSuffix(track.Name, track.Ext)
+		}
+		entries = append(entries, playlistfmt.Entry{
+			Location: file,
+			Title:    title,
+			Creator:  track.Artist,
+			Album:    track.Album,
+			Duration: time.Duration(duration * float64(time.Second)),
+		})
+	}
+	result.Tracks = len(manifest.Tracks)
+
+	if cover != "" {
+		file := "cover" + strings.ToLower(filepath.Ext(cover))
+		if err := addFileToZip(archive, cover, file); err == nil {
+			manifest.Cover = file
+		} else if !errors.Is(err, os.ErrNotExist) {
+			_ = temp.Close()
+			return result, err
+		}
+	}
+	writer, err := archive.Create(manifest.Playlist)
+	if err == nil {
+		err = playlistfmt.WriteM3U(writer, entries)
+	}
+	if err == nil {
+		writer, err = archive.Create(bundleManifestName)
+	}
+	if err == nil {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(manifest)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return result, err
+	}
+	_ = os.Remove(dest)
+	return result, os.Rename(temp.Name(), dest)
+}
+
+// ImportPlaylistBundle unpacks a bundle into a folder named after the
+// playlist under root, which must be one of the music directories, and
+// recreates the playlist with its description and cover. Files already in
+// that folder with the same name and size are reused rather than copied
+// again, so importing a bundle twice does not duplicate audio.
+func (s *Service) ImportPlaylistBundle(bundlePath string, root string) (BundleImportReport, error) {
+	report := BundleImportReport{Missing: []string{}}
+	if strings.TrimSpace(bundlePath) == "" {
+		return report, errors.New("path is required")
+	}
+	dirs, err := s.store.ResolveMusicDirs()
+	if err != nil {
+		return report, err
+	}
+	root, err = media.ResolveExistingPath(root)
+	if err != nil {
+		return report, err
+	}
+	if !media.IsPathWithinAnyDir(dirs, root) {
+		return report, errors.New("folder not in music directory")
+	}
+
+	archive, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		return report, err
+	}
+	defer archive.Close()
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	manifestFile, ok := files[bundleManifestName]
+	if !ok {
+		return report, errors.New("not a playlist bundle")
+	}
+	var manifest BundleManifest
+	reader, err := manifestFile.Open()
+	if err != nil {
+		return report, err
+	}
+	err = json.NewDecoder(reader).Decode(&manifest)
+	_ = reader.Close()
+	if err != nil {
+		return report, err
+	}
+	if manifest.Version > bundleVersion {
+		return report, errors.New("bundle was made by a newer version")
+	}
+
+	report.Dir = filepath.Join(root, bundleFileName(manifest.Name, "Playlist"))
+	if err := os.MkdirAll(report.Dir, 0o755); err != nil {
+		return report, err
+	}
+	extracted := make(map[string]string)
+	paths := make([]string, 0, len(manifest.Tracks))
+	for _, track := range manifest.Tracks {
+		if target, ok := extracted[track.File]; ok {
+			paths = append(paths, target)
+			continue
+		}
+		file, ok := files[track.File]
+		name := bundleFileName(path.Base(track.File), "")
+		if !ok || !media.IsAllowedAudio(name) {
+			report.Missing = append(report.Missing, track.File)
+			continue
+		}
+		target, reused, err := extractZipFile(file, report.Dir, name)
+		if err != nil {
+			return report, err
+		}
+		if reused {
+			report.Reused++
+		} else {
+			report.Extracted++
+		}
+		extracted[track.File] = target
+		paths = append(paths, target)
+	}
+	// A cover that is not an image is left out rather than failing the
+	// import after the playlist has been created.
+	cover := ""
+	if file, ok := files[manifest.Cover]; ok && manifest.Cover != "" && state.IsCoverImage(manifest.Cover) {
+		if target, _, err := extractZipFile(file, report.Dir, bundleFileName(path.Base(manifest.Cover), "")); err == nil {
+			cover = target
+		}
+	}
+
+	s.Invalidate()
+
+	report.Playlist, err = s.store.ImportPlaylist(manifest.Name, paths)
+	if err != nil {
+		return report, err
+	}
+	if manifest.Description != "" || cover != "" {
+		report.Playlist, err = s.store.UpdatePlaylistDetails(report.Playlist.Name, manifest.Description, cover)
+	}
+	return report, err
+}
+
+// addFileToZip stores source in the archive without compression; audio and
+// images are already compressed.
+func addFileToZip(archive *zip.Writer, source string, name string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header := &zip.FileHeader{Name: name, Method: zip.Store, Modified: info.ModTime()}
+	header.SetMode(0o644)
+	writer, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+// extractZipFile writes file into dir as name. A file already there with
+// the same size is taken to be the same track and reused; any other file
+// of that name gets a numeric suffix instead of being overwritten.
+func extractZipFile(file *zip.File, dir string, name string) (string, bool, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	target := filepath.Join(dir, name)
+	for n := 2; ; n++ {
+		info, err := os.Stat(target)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", false, err
+		}
+		if !info.IsDir() && uint64(info.Size()) == file.UncompressedSize64 {
+			return target, true, nil
+		}
+		target = filepath.Join(dir, base+" ("+strconv.Itoa(n)+")"+ext)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return "", false, err
+	}
+	defer reader.Close()
+	temp, err := os.CreateTemp(dir, ".bundle-*.tmp")
+	if err != nil {
+		return "", false, err
+	}
+	defer os.Remove(temp.Name())
+	_, err = io.Copy(temp, reader)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), target)
+	}
+	if err == nil && !file.Modified.IsZero() {
+		_ = os.Chtimes(target, file.Modified, file.Modified)
+	}
+	return target, false, err
+}
+
+func bundleFileName(name string, fallback string) string {
+	if safe := media.SafeFileName(name); safe != "" {
+		return safe
+	}
+	return fallback
+}
@@ -0,0 +1,266 @@
+package library
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"LiteSound/internal/media"
+	"LiteSound/internal/state"
+)
+
+const defaultFolderNameTemplate = "{folder}"
+
+// FolderImportOptions controls how a directory is turned into playlists.
+// Depth 0 makes one playlist per leaf folder; a positive Depth makes one
+// per folder that many levels below Dir, each including its subfolders.
+// NameTemplate may use {folder}, {parent}, {path} (the folder relative to
+// Dir, levels joined with " - ") and {dir} (Dir's own name). SortBy is
+// "track" or "name".
+type FolderImportOptions struct {
+	Dir          string `json:"dir"`
+	Depth        int    `json:"depth"`
+	NameTemplate string `json:"nameTemplate"`
+	SortBy       string `json:"sortBy"`
+	KeepInSync   bool   `json:"keepInSync"`
+}
+
+type FolderImportResult struct {
+	Created []state.Playlist `json:"created"`
+	Updated []state.Playlist `json:"updated"`
+}
+
+// ImportFolderPlaylists creates playlists from the folder structure under a
+// music directory. With KeepInSync the playlists follow their folders on
+// every rescan.
+func (s *Service) ImportFolderPlaylists(options FolderImportOptions) (FolderImportResult, error) {
+	result := FolderImportResult{Created: []state.Playlist{}, Updated: []state.Playlist{}}
+	if strings.TrimSpace(options.Dir) == "" {
+		return result, errors.New("folder is required")
+	}
+	if options.Depth < 0 {
+		return result, errors.New("depth must not be negative")
+	}
+	template := strings.TrimSpace(options.NameTemplate)
+	if template == "" {
+		template = defaultFolderNameTemplate
+	}
+	sortBy := options.SortBy
+	switch sortBy {
+	case "":
+		sortBy = state.FolderSortTrack
+	case state.FolderSortTrack, state.FolderSortName:
+	default:
+		return result, errors.New("sort must be track or name")
+	}
+	dirs, err := s.store.ResolveMusicDirs()
+	if err != nil {
+		return result, err
+	}
+	base, err := media.ResolveExistingPath(options.Dir)
+	if err != nil {
+		return result, err
+	}
+	if info, err := os.Stat(base); err != nil || !info.IsDir() {
+		return result, errors.New("folder not found")
+	}
+	if !media.IsPathWithinAnyDir(dirs, base) {
+		return result, errors.New("folder not in music directory")
+	}
+
+	files, err := s.scanMusicFiles()
+	if err != nil {
+		return result, err
+	}
+	s.mu.Lock()
+	s.index = files
+	s.mu.Unlock()
+
+	groups := groupByFolder(files, base, options.Depth)
+	folders := make([]string, 0, len(groups))
+	for folder := range groups {
+		folders = append(folders, folder)
+	}
+	sort.Slice(folders, func(i, j int) bool { return naturalLess(folders[i], folders[j]) })
+
+	playlists := make([]state.FolderPlaylist, 0, len(folders))
+	for _, folder := range folders {
+		source := &state.FolderSource{Dir: folder, Recursive: options.Depth > 0, SortBy: sortBy}
+		playlist := state.FolderPlaylist{
+			Name:   folderPlaylistName(template, base, folder),
+			Tracks: folderTracks(files, *source),
+		}
+		if options.KeepInSync {
+			playlist.Source = source
+		}
+		playlists = append(playlists, playlist)
+	}
+	result.Created, result.Updated, err = s.store.ImportFolderPlaylists(playlists)
+	return result, err
+}
+
+// syncFolderPlaylists brings playlists that follow a folder up to date with
+// a fresh scan.
+func (s *Service) syncFolderPlaylists(files []media.MusicFile) error {
+	playlists, err := s.store.GetPlaylists()
+	if err != nil {
+		return err
+	}
+	contents := make(map[string][]string)
+	for _, playlist := range playlists {
+		if playlist.Source != nil {
+			contents[playlist.ID] = folderTracks(files, *playlist.Source)
+		}
+	}
+	if len(contents) == 0 {
+		return nil
+	}
+	_, err = s.store.SyncFolderPlaylists(contents)
+	return err
+}
+
+// groupByFolder returns the folders under base that become playlists. At
+// depth 0 those are the leaf folders holding tracks; otherwise every folder
+// exactly depth levels down that holds tracks itself or below.
+func groupByFolder(files []media.MusicFile, base string, depth int) map[string]struct{} {
+	withTracks := make(map[string]struct{})
+	for _, file := range files {
+		dir := filepath.Dir(file.Path)
+		relative, ok := relativeDir(base, dir)
+		if !ok {
+			continue
+		}
+		if depth == 0 {
+			withTracks[dir] = struct{}{}
+			continue
+		}
+		parts := splitRelative(relative)
+		if len(parts) < depth {
+			continue
+		}
+		withTracks[filepath.Join(append([]string{base}, parts[:depth]...)...)] = struct{}{}
+	}
+	if depth > 0 {
+		return withTracks
+	}
+	groups := make(map[string]struct{})
+	for dir := range withTracks {
+		leaf := true
+		for other := range withTracks {
+			if other != dir && strings.HasPrefix(strings.ToLower(other), strings.ToLower(dir)+string(os.PathSeparator)) {
+				leaf = false
+				break
+			}
+		}
+		if leaf {
+			groups[dir] = struct{}{}
+		}
+	}
+	return groups
+}
+
+// folderTracks lists the tracks belonging to a source folder in its order.
+// Sorting by track number keeps subfolders together and puts untagged
+// tracks after numbered ones.
+func folderTracks(files []media.MusicFile, source state.FolderSource) []string {
+	matched := make([]media.MusicFile, 0)
+	for _, file := range files {
+		relative, ok := relativeDir(source.Dir, filepath.Dir(file.Path))
+		if !ok || (relative != "" && !source.Recursive) {
+			continue
+		}
+		matched = append(matched, file)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if source.SortBy != state.FolderSortName {
+			if dirA, dirB := filepath.Dir(a.Path), filepath.Dir(b.Path); dirA != dirB {
+				return naturalLess(dirA, dirB)
+			}
+			if a.Track != b.Track {
+				return a.Track != 0 && (b.Track == 0 || a.Track < b.Track)
+			}
+		}
+		return naturalLess(a.Path, b.Path)
+	})
+	tracks := make([]string, 0, len(matched))
+	for _, file := range matched {
+		tracks = append(tracks, file.Path)
+	}
+	return tracks
+}
+
+func folderPlaylistName(template string, base string, folder string) string {
+	relative, _ := relativeDir(base, folder)
+	parts := splitRelative(relative)
+	path := strings.Join(parts, " - ")
+	if path == "" {
+		path = filepath.Base(folder)
+	}
+	name := strings.NewReplacer(
+		"{folder}", filepath.Base(folder),
+		"{parent}", filepath.Base(filepath.Dir(folder)),
+		"{path}", path,
+		"{dir}", filepath.Base(base),
+	).Replace(template)
+	if strings.TrimSpace(name) == "" {
+		return filepath.Base(folder)
+	}
+	return strings.TrimSpace(name)
+}
+
+// relativeDir returns dir relative to base, "" for base itself, and false
+// when dir is outside base.
+func relativeDir(base string, dir string) (string, bool) {
+	relative, err := filepath.Rel(base, dir)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(os.PathSeparator)) {
+		return "", false
+	}
+	if relative == "." {
+		return "", true
+	}
+	return relative, true
+}
+
+func splitRelative(relative string) []string {
+	if relative == "" {
+		return nil
+	}
+	return strings.Split(relative, string(os.PathSeparator))
+}
+
+// naturalLess compares strings case-insensitively with runs of digits
+// compared by value, so "Track 2" sorts before "Track 10".
+func naturalLess(a string, b string) bool {
+	ra, rb := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		if unicode.IsDigit(ra[i]) && unicode.IsDigit(rb[j]) {
+			startA, startB := i, j
+			for i < len(ra) && unicode.IsDigit(ra[i]) {
+				i++
+			}
+			for j < len(rb) && unicode.IsDigit(rb[j]) {
+				j++
+			}
+			numberA := strings.TrimLeft(string(ra[startA:i]), "0")
+			numberB := strings.TrimLeft(string(rb[startB:j]), "0")
+			if len(numberA) != len(numberB) {
+				return len(numberA) < len(numberB)
+			}
+			if numberA != numberB {
+				return numberA < numberB
+			}
+			continue
+		}
+		if ra[i] != rb[j] {
+			return ra[i] < rb[j]
+		}
+		i++
+		j++
+	}
+	return len(ra)-i < len(rb)-j
+}
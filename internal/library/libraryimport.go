@@ -0,0 +1,213 @@
+package library
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"LiteSound/internal/libraryfmt"
+	"LiteSound/internal/playlistfmt"
+	"LiteSound/internal/state"
+)
+
+// PathRewrite replaces the From prefix of a path from the other machine with
+// To, e.g. "C:/Users/me/Music/iTunes/iTunes Media/Music" with
+// "/home/me/Music". Prefixes match case-insensitively and either slash
+// direction.
+type PathRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type LibraryImportOptions struct {
+	Paths    []string      `json:"paths"`
+	Rewrites []PathRewrite `json:"rewrites"`
+}
+
+// LibraryImportSummary describes an import from another player. Tracks
+// counts the distinct tracks found in the exports, Matched those mapped
+// onto library files, MatchedByMetadata the part of Matched found by tags
+// after the location did not resolve.
+type LibraryImportSummary struct {
+	DryRun            bool                     `json:"dryRun"`
+	Formats           []string                 `json:"formats"`
+	Tracks            int                      `json:"tracks"`
+	Matched           int                      `json:"matched"`
+	MatchedByMetadata int                      `json:"matchedByMetadata"`
+	Unmatched         []UnresolvedEntry        `json:"unmatched"`
+	SkippedPlaylists  []string                 `json:"skippedPlaylists"`
+	Changes           state.LibraryMergeResult `json:"changes"`
+}
+
+// ImportLibrary brings play counts, skip counts, ratings, last-played times
+// and playlists over from other players' exports. Locations are rewritten
+// with the first matching rule, then resolved like playlist file entries,
+// falling back to a tag match. With dryRun set the state is left untouched
+// and the summary shows what an import would change.
+func (s *Service) ImportLibrary(options LibraryImportOptions, dryRun bool) (LibraryImportSummary, error) {
+	summary := LibraryImportSummary{
+		DryRun:           dryRun,
+		Formats:          []string{},
+		Unmatched:        []UnresolvedEntry{},
+		SkippedPlaylists: []string{},
+	}
+	if len(options.Paths) == 0 {
+		return summary, errors.New("path is required")
+	}
+	dirs, err := s.store.ResolveMusicDirs()
+	if err != nil {
+		return summary, err
+	}
+	resolver := &foreignResolver{service: s, dirs: dirs, rewrites: options.Rewrites, resolved: make(map[string]string)}
+
+	merge := state.LibraryMerge{Stats: make(map[string]state.TrackStats)}
+	for _, path := range options.Paths {
+		library, err := readLibraryFile(path)
+		if err != nil {
+			return summary, err
+		}
+		summary.Formats = append(summary.Formats, library.Format)
+		summary.SkippedPlaylists = append(summary.SkippedPlaylists, library.Skipped...)
+		baseDir := filepath.Dir(path)
+		for _, track := range library.Tracks {
+			resolved, err := resolver.resolve(track, baseDir)
+			if err != nil {
+				return summary, err
+			}
+			if resolved == "" {
+				continue
+			}
+			stats := merge.Stats[resolved]
+			stats.PlayCount = max(stats.PlayCount, track.PlayCount)
+			stats.SkipCount = max(stats.SkipCount, track.SkipCount)
+			if !track.LastPlayed.IsZero() {
+				stats.LastPlayedAt = max(stats.LastPlayedAt, track.LastPlayed.UnixMilli())
+			}
+			stats.Rating = max(stats.Rating, track.Rating)
+			if stats != (state.TrackStats{}) {
+				merge.Stats[resolved] = stats
+			}
+		}
+		for _, playlist := range library.Playlists {
+			imported := state.ImportedPlaylist{Name: playlist.Name, Tracks: make([]string, 0, len(playlist.Tracks))}
+			for _, track := range playlist.Tracks {
+				resolved, err := resolver.resolve(track, baseDir)
+				if err != nil {
+					return summary, err
+				}
+				if resolved != "" {
+					imported.Tracks = append(imported.Tracks, resolved)
+				}
+			}
+			merge.Playlists = append(merge.Playlists, imported)
+		}
+	}
+
+	summary.Tracks = len(resolver.resolved)
+	for _, resolved := range resolver.resolved {
+		if resolved != "" {
+			summary.Matched++
+		}
+	}
+	summary.MatchedByMetadata = resolver.matchedByMetadata
+	summary.Unmatched = resolver.unmatched
+	summary.Changes, err = s.store.MergeLibrary(merge, dryRun)
+	return summary, err
+}
+
+func readLibraryFile(path string) (libraryfmt.Library, error) {
+	if strings.TrimSpace(path) == "" {
+		return libraryfmt.Library{}, errors.New("path is required")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return libraryfmt.Library{}, err
+	}
+	defer file.Close()
+	return libraryfmt.Read(path, file)
+}
+
+// foreignResolver maps tracks from another player onto library paths,
+// remembering each outcome so a track listed in the library and in several
+// playlists is resolved and reported once.
+type foreignResolver struct {
+	service           *Service
+	dirs              []string
+	rewrites          []PathRewrite
+	matcher           *trackMatcher
+	resolved          map[string]string
+	unmatched         []UnresolvedEntry
+	matchedByMetadata int
+}
+
+func (r *foreignResolver) resolve(track libraryfmt.Track, baseDir string) (string, error) {
+	key := track.Location
+	if key == "" {
+		key = "\x00" + track.Title + "\x00" + track.Artist + "\x00" + track.Album
+	}
+	if resolved, ok := r.resolved[key]; ok {
+		return resolved, nil
+	}
+	location := rewriteLocation(foreignPath(track.Location), r.rewrites)
+	resolved, reason := resolveEntryLocation(location, baseDir, r.dirs)
+	if location == "" && track.Location != "" {
+		reason = "not a local file"
+	}
+	if reason != "" && track.Title != "" {
+		if r.matcher == nil {
+			index, err := r.service.Index()
+			if err != nil {
+				return "", err
+			}
+			r.matcher = newTrackMatcher(index)
+		}
+		entry := playlistfmt.Entry{Title: track.Title, Creator: track.Artist, Album: track.Album, Duration: track.Duration}
+		if file, _, ok := r.matcher.matchByMetadata(entry); ok {
+			resolved, reason = file.Path, ""
+			r.matchedByMetadata++
+		} else if location == "" {
+			reason = "no matching track in library"
+		}
+	}
+	if reason != "" {
+		r.unmatched = append(r.unmatched, UnresolvedEntry{
+			Location: track.Location,
+			Title:    track.Title,
+			Reason:   reason,
+		})
+	}
+	r.resolved[key] = resolved
+	return resolved, nil
+}
+
+// foreignPath turns a location from another player into a plain path with
+// forward slashes. File URLs are decoded; other URLs yield "".
+func foreignPath(location string) string {
+	location = strings.TrimSpace(location)
+	if playlistfmt.IsURL(location) {
+		parsed, err := url.Parse(location)
+		if err != nil || !strings.EqualFold(parsed.Scheme, "file") {
+			return ""
+		}
+		location = fileURLPath(parsed)
+	}
+	return strings.ReplaceAll(location, "\\", "/")
+}
+
+func rewriteLocation(path string, rewrites []PathRewrite) string {
+	for _, rewrite := range rewrites {
+		from := strings.TrimRight(strings.ReplaceAll(strings.TrimSpace(rewrite.From), "\\", "/"), "/")
+		if from == "" || len(path) < len(from) || !strings.EqualFold(path[:len(from)], from) {
+			continue
+		}
+		rest := path[len(from):]
+		if rest != "" && rest[0] != '/' {
+			continue
+		}
+		to := strings.TrimRight(strings.ReplaceAll(strings.TrimSpace(rewrite.To), "\\", "/"), "/")
+		return to + rest
+	}
+	return path
+}
@@ -0,0 +1,263 @@
+package library
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"LiteSound/internal/media"
+	"LiteSound/internal/playlistfmt"
+)
+
+// metadataMatchThreshold is the lowest score accepted when a playlist entry
+// is matched by its tags instead of its location.
+const metadataMatchThreshold = 0.85
+
+const (
+	MatchByISRC     = "isrc"
+	MatchByMetadata = "metadata"
+)
+
+// durationCheckScore is the lowest title, artist and album score at which a
+// track's length is compared. Below it a track cannot reach
+// metadataMatchThreshold, so its file need not be read.
+const durationCheckScore = 0.5
+
+// trackMatcher finds library tracks for playlist entries that have no usable
+// location. The library's tags are normalized once so matching a long
+// playlist does not redo that work per entry. Track lengths the index does
+// not know are read from the files as candidates need them, and kept.
+type trackMatcher struct {
+	files     []media.MusicFile
+	titles    []string
+	stripped  []string
+	artists   []string
+	composers []string
+	albums    []string
+	byISRC    map[string]int
+	durations []float64
+	measured  []bool
+}
+
+func newTrackMatcher(files []media.MusicFile) *trackMatcher {
+	matcher := &trackMatcher{
+		files:     files,
+		titles:    make([]string, len(files)),
+		stripped:  make([]string, len(files)),
+		artists:   make([]string, len(files)),
+		composers: make([]string, len(files)),
+		albums:    make([]string, len(files)),
+		byISRC:    make(map[string]int),
+		durations: make([]float64, len(files)),
+		measured:  make([]bool, len(files)),
+	}
+	for i, file := range files {
+		matcher.durations[i] = file.Duration
+		matcher.measured[i] = file.Duration > 0
+		matcher.titles[i] = normalizeForMatch(trackTitle(file))
+		matcher.stripped[i] = normalizeForMatch(stripTitleExtras(trackTitle(file)))
+		matcher.artists[i] = normalizeForMatch(file.Artist)
+		matcher.composers[i] = normalizeForMatch(file.Composer)
+		matcher.albums[i] = normalizeForMatch(file.Album)
+		if file.ISRC != "" {
+			matcher.byISRC[strings.ToUpper(file.ISRC)] = i
+		}
+	}
+	return matcher
+}
+
+// match returns the library track that best fits entry, its score from 0 to
+// 1 and how it was found. An ISRC match is exact and scores 1; otherwise
+// title, artist, album and duration are compared, and fields the entry
+// lacks, or durations the library does not know, do not count against a
+// track. The best candidate is returned even when its score is low so
+// callers can offer it for review.
+func (m *trackMatcher) match(entry playlistfmt.Entry) (media.MusicFile, float64, string) {
+	if entry.ISRC != "" {
+		if index, ok := m.byISRC[strings.ToUpper(entry.ISRC)]; ok {
+			return m.files[index], 1, MatchByISRC
+		}
+	}
+	title := normalizeForMatch(entry.Title)
+	if title == "" {
+		return media.MusicFile{}, 0, ""
+	}
+	strippedTitle := normalizeForMatch(stripTitleExtras(entry.Title))
+	creators := splitCreators(entry.Creator)
+	album := normalizeForMatch(entry.Album)
+	duration := entry.Duration.Seconds()
+
+	best, bestScore := -1, 0.0
+	for i := range m.files {
+		titleScore := max(similarity(title, m.titles[i]), similarity(strippedTitle, m.stripped[i]))
+		score, weight := titleScore*0.6, 0.6
+		if len(creators) > 0 {
+			creatorScore := 0.0
+			for _, creator := range creators {
+				creatorScore = max(creatorScore, similarity(creator, m.artists[i]), similarity(creator, m.composers[i]))
+			}
+			score += creatorScore * 0.25
+			weight += 0.25
+		}
+		if album != "" {
+			score += similarity(album, m.albums[i]) * 0.15
+			weight += 0.15
+		}
+		if duration > 0 && score/weight >= durationCheckScore {
+			if length := m.duration(i); length > 0 {
+				score += durationSimilarity(duration, length) * 0.2
+				weight += 0.2
+			}
+		}
+		score /= weight
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return media.MusicFile{}, 0, ""
+	}
+	return m.files[best], bestScore, MatchByMetadata
+}
+
+// duration returns the length of the i-th track in seconds, reading it from
+// the file the first time it is needed; 0 means unknown.
+func (m *trackMatcher) duration(i int) float64 {
+	if !m.measured[i] {
+		m.durations[i] = media.ReadDuration(m.files[i].Path)
+		m.measured[i] = true
+	}
+	return m.durations[i]
+}
+
+// matchByMetadata finds the library track whose tags best match the entry
+// and reports whether it clears metadataMatchThreshold.
+func (m *trackMatcher) matchByMetadata(entry playlistfmt.Entry) (media.MusicFile, float64, bool) {
+	file, score, _ := m.match(entry)
+	if score < metadataMatchThreshold {
+		return media.MusicFile{}, score, false
+	}
+	return file, score, true
+}
+
+// durationSimilarity is 1 for lengths within two seconds of each other,
+// falling to 0 at a ten second difference.
+func durationSimilarity(a float64, b float64) float64 {
+	diff := math.Abs(a - b)
+	switch {
+	case diff <= 2:
+		return 1
+	case diff >= 10:
+		return 0
+	}
+	return 1 - (diff-2)/8
+}
+
+// stripTitleExtras drops the parts streaming services add to titles, such
+// as "(feat. …)", "[Live]" and "- Remastered 2011".
+func stripTitleExtras(title string) string {
+	var builder strings.Builder
+	depth := 0
+	for _, r := range title {
+		switch r {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth > 0 {
+				depth--
+			}
+		default:
+			if depth == 0 {
+				builder.WriteRune(r)
+			}
+		}
+	}
+	stripped := builder.String()
+	if index := strings.Index(stripped, " - "); index > 0 {
+		stripped = stripped[:index]
+	}
+	return strings.TrimSpace(stripped)
+}
+
+// splitCreators returns the normalized artist credit followed by each artist
+// when several are listed, since exports join them with commas or
+// semicolons while local tags often name only the first.
+func splitCreators(creator string) []string {
+	full := normalizeForMatch(creator)
+	if full == "" {
+		return nil
+	}
+	creators := []string{full}
+	parts := strings.FieldsFunc(creator, func(r rune) bool { return r == ',' || r == ';' || r == '/' || r == '&' })
+	if len(parts) > 1 {
+		for _, part := range parts {
+			if normalized := normalizeForMatch(part); normalized != "" {
+				creators = append(creators, normalized)
+			}
+		}
+	}
+	return creators
+}
+
+// trackTitle returns the tagged title, or the file name without extension
+// for untagged files.
+func trackTitle(file media.MusicFile) string {
+	if file.Title != "" {
+		return file.Title
+	}
+	return strings.TrimSuffix(file.Name, filepath.Ext(file.Name))
+}
+
+// normalizeForMatch lowercases text and reduces punctuation and runs of
+// spaces to single spaces so "Don't Stop (Remastered)" and "dont stop
+// remastered" compare equal.
+func normalizeForMatch(text string) string {
+	var builder strings.Builder
+	space := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r == '\'' || r == '’':
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && builder.Len() > 0 {
+				builder.WriteByte(' ')
+			}
+			builder.WriteRune(r)
+			space = false
+		default:
+			space = true
+		}
+	}
+	return builder.String()
+}
+
+// similarity scores two normalized strings from 0 to 1 using their edit
+// distance.
+func similarity(a string, b string) float64 {
+	if a == b {
+		return 1
+	}
+	if a == "" || b == "" {
+		return 0
+	}
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	longest := max(len(ra), len(rb))
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
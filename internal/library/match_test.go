@@ -0,0 +1,115 @@
+package library
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"LiteSound/internal/media"
+	"LiteSound/internal/playlistfmt"
+)
+
+// writeWAV writes a silent PCM WAV header that plays for seconds, enough for
+// media.ReadDuration.
+func writeWAV(t *testing.T, path string, seconds uint32) {
+	t.Helper()
+	const byteRate = 176400
+	data := []byte("RIFF\x00\x00\x00\x00WAVEfmt ")
+	data = binary.LittleEndian.AppendUint32(data, 16)
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, 2)
+	data = binary.LittleEndian.AppendUint32(data, 44100)
+	data = binary.LittleEndian.AppendUint32(data, byteRate)
+	data = binary.LittleEndian.AppendUint16(data, 4)
+	data = binary.LittleEndian.AppendUint16(data, 16)
+	data = append(data, "data"...)
+	data = binary.LittleEndian.AppendUint32(data, byteRate*seconds)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatchByMetadata(t *testing.T) {
+	files := []media.MusicFile{
+		{Path: "/music/a/intro.mp3", Title: "Intro", Artist: "Band A", Album: "First", Duration: 62},
+		{Path: "/music/b/intro.mp3", Title: "Intro", Artist: "Band A", Album: "Second", Duration: 245},
+		{Path: "/music/c/song.mp3", Title: "Don't Stop", Artist: "Band B", Album: "Hits"},
+		{Path: "/music/d/other.mp3", Name: "Untitled Track.mp3"},
+	}
+	tests := []struct {
+		name  string
+		entry playlistfmt.Entry
+		want  string
+	}{
+		{
+			name:  "duration picks between tracks with the same tags",
+			entry: playlistfmt.Entry{Title: "Intro", Creator: "Band A", Duration: 244 * time.Second},
+			want:  "/music/b/intro.mp3",
+		},
+		{
+			name:  "duration within two seconds still matches",
+			entry: playlistfmt.Entry{Title: "Intro", Creator: "Band A", Duration: 60 * time.Second},
+			want:  "/music/a/intro.mp3",
+		},
+		{
+			name:  "album without duration",
+			entry: playlistfmt.Entry{Title: "Intro", Creator: "Band A", Album: "Second"},
+			want:  "/music/b/intro.mp3",
+		},
+		{
+			name:  "unknown library duration does not count against a track",
+			entry: playlistfmt.Entry{Title: "Dont Stop", Creator: "Band B", Duration: 200 * time.Second},
+			want:  "/music/c/song.mp3",
+		},
+		{
+			name:  "untagged tracks match by file name",
+			entry: playlistfmt.Entry{Title: "Untitled Track"},
+			want:  "/music/d/other.mp3",
+		},
+		{
+			name:  "different title",
+			entry: playlistfmt.Entry{Title: "Something Else", Creator: "Band A", Duration: 62 * time.Second},
+		},
+		{
+			name:  "no title",
+			entry: playlistfmt.Entry{Creator: "Band A", Duration: 62 * time.Second},
+		},
+	}
+	matcher := newTrackMatcher(files)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, score, ok := matcher.matchByMetadata(test.entry)
+			if test.want == "" {
+				if ok {
+					t.Fatalf("matched %s with score %.2f, want no match", file.Path, score)
+				}
+				return
+			}
+			if !ok || file.Path != test.want {
+				t.Fatalf("matched %q (ok %v, score %.2f), want %q", file.Path, ok, score, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchByMetadataReadsMissingDurations(t *testing.T) {
+	dir := t.TempDir()
+	short := filepath.Join(dir, "short.wav")
+	long := filepath.Join(dir, "long.wav")
+	writeWAV(t, short, 90)
+	writeWAV(t, long, 300)
+	matcher := newTrackMatcher([]media.MusicFile{
+		{Path: short, Title: "Theme", Artist: "Band"},
+		{Path: long, Title: "Theme", Artist: "Band"},
+		{Path: filepath.Join(dir, "missing.wav"), Title: "Unrelated"},
+	})
+	file, _, ok := matcher.matchByMetadata(playlistfmt.Entry{Title: "Theme", Creator: "Band", Duration: 299 * time.Second})
+	if !ok || file.Path != long {
+		t.Fatalf("matched %q (ok %v), want %q", file.Path, ok, long)
+	}
+	if matcher.measured[2] {
+		t.Errorf("read the length of a track whose tags could not match")
+	}
+}
@@ -0,0 +1,322 @@
+package library
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"LiteSound/internal/media"
+	"LiteSound/internal/playlistfmt"
+	"LiteSound/internal/state"
+)
+
+type UnresolvedEntry struct {
+	Line     int    `json:"line"`
+	Location string `json:"location"`
+	Title    string `json:"title"`
+	Reason   string `json:"reason"`
+}
+
+type ImportReport struct {
+	Playlist          state.Playlist    `json:"playlist"`
+	Imported          int               `json:"imported"`
+	MatchedByMetadata int               `json:"matchedByMetadata"`
+	Unresolved        []UnresolvedEntry `json:"unresolved"`
+}
+
+type ExportOptions struct {
+	// Relative writes paths relative to BaseDir, or to the playlist file's
+	// directory when BaseDir is empty. Tracks on another volume keep their
+	// absolute path.
+	Relative bool   `json:"relative"`
+	BaseDir  string `json:"baseDir"`
+}
+
+// PlaylistTracks returns the tracks of a regular or smart playlist, in
+// order, with tags from the library index where available.
+func (s *Service) PlaylistTracks(name string) ([]media.MusicFile, error) {
+	playlist, err := s.store.GetPlaylist(name)
+	if err != nil {
+		definition, smartErr := s.store.GetSmartPlaylist(name)
+		if smartErr != nil {
+			return nil, err
+		}
+		return s.EvaluateSmartPlaylist(definition)
+	}
+	known := make(map[string]media.MusicFile)
+	if files, err := s.Index(); err == nil {
+		for _, file := range files {
+			known[file.Path] = file
+		}
+	}
+	tracks := make([]media.MusicFile, 0, len(playlist.Entries))
+	for _, entry := range playlist.Entries {
+		if file, ok := known[entry.Path]; ok {
+			tracks = append(tracks, file)
+			continue
+		}
+		tracks = append(tracks, media.MusicFile{
+			Name: filepath.Base(entry.Path),
+			Path: entry.Path,
+			Ext:  strings.ToLower(filepath.Ext(entry.Path)),
+		})
+	}
+	return tracks, nil
+}
+
+// ImportPlaylistFile reads a playlist file and creates a playlist from the
+// entries that resolve to tracks under the music directories. The playlist
+// is named after the file unless name is given, with a numeric suffix if
+// the name is taken.
+func (s *Service) ImportPlaylistFile(path string, name string) (ImportReport, error) {
+	report := ImportReport{Unresolved: []UnresolvedEntry{}}
+	if strings.TrimSpace(path) == "" {
+		return report, errors.New("path is required")
+	}
+	if !playlistfmt.IsSupported(path) {
+		return report, playlistfmt.ErrUnsupportedFormat
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return report, err
+	}
+	defer file.Close()
+	entries, err := playlistfmt.Read(path, file)
+	if err != nil {
+		return report, err
+	}
+
+	resolution, err := s.ResolvePlaylistEntries(entries, filepath.Dir(path))
+	if err != nil {
+		return report, err
+	}
+	report.Unresolved = resolution.Unresolved
+	report.MatchedByMetadata = resolution.MatchedByMetadata
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	playlist, err := s.store.ImportPlaylist(name, resolution.Tracks)
+	if err != nil {
+		return report, err
+	}
+	report.Playlist = playlist
+	report.Imported = len(playlist.Entries)
+	return report, nil
+}
+
+// PlaylistResolution is the outcome of mapping playlist entries onto
+// library tracks.
+type PlaylistResolution struct {
+	Tracks            []string
+	Unresolved        []UnresolvedEntry
+	MatchedByMetadata int
+}
+
+// ResolvePlaylistEntries maps playlist entries onto tracks under the music
+// directories. Relative locations are tried against baseDir first and then
+// against each music directory. Entries whose location does not resolve are
+// matched against the library by title, artist and album, so playlists made
+// on another machine still find their tracks.
+func (s *Service) ResolvePlaylistEntries(entries []playlistfmt.Entry, baseDir string) (PlaylistResolution, error) {
+	result := PlaylistResolution{
+		Tracks:     make([]string, 0, len(entries)),
+		Unresolved: make([]UnresolvedEntry, 0),
+	}
+	dirs, err := s.store.ResolveMusicDirs()
+	if err != nil {
+		return result, err
+	}
+	var matcher *trackMatcher
+	for _, entry := range entries {
+		track, reason := resolveEntryLocation(entry.Location, baseDir, dirs)
+		if reason != "" && entry.Title != "" {
+			if matcher == nil {
+				index, err := s.Index()
+				if err != nil {
+					return result, err
+				}
+				matcher = newTrackMatcher(index)
+			}
+			if file, _, ok := matcher.matchByMetadata(entry); ok {
+				track, reason = file.Path, ""
+				result.MatchedByMetadata++
+			} else if strings.TrimSpace(entry.Location) == "" {
+				reason = "no matching track in library"
+			}
+		}
+		if reason != "" {
+			result.Unresolved = append(result.Unresolved, UnresolvedEntry{
+				Line:     entry.Line,
+				Location: entry.Location,
+				Title:    entry.Title,
+				Reason:   reason,
+			})
+			continue
+		}
+		result.Tracks = append(result.Tracks, track)
+	}
+	return result, nil
+}
+
+func resolveEntryLocation(location string, baseDir string, dirs []string) (string, string) {
+	location = strings.TrimSpace(location)
+	if location == "" {
+		return "", "empty location"
+	}
+	if playlistfmt.IsURL(location) {
+		parsed, err := url.Parse(location)
+		if err != nil {
+			return "", "invalid URL"
+		}
+		if !strings.EqualFold(parsed.Scheme, "file") {
+			return "", "not a local file"
+		}
+		location = fileURLPath(parsed)
+	}
+	if !media.IsAllowedAudio(location) {
+		return "", "unsupported audio type"
+	}
+	location = filepath.FromSlash(strings.ReplaceAll(location, "\\", "/"))
+
+	candidates := []string{location}
+	if !filepath.IsAbs(location) {
+		candidates = candidates[:0]
+		if baseDir != "" {
+			candidates = append(candidates, filepath.Join(baseDir, location))
+		}
+		for _, dir := range dirs {
+			candidates = append(candidates, filepath.Join(dir, location))
+		}
+	}
+	outside := false
+	for _, candidate := range candidates {
+		abs, err := media.ResolveExistingPath(candidate)
+		if err != nil {
+			continue
+		}
+		if !media.IsPathWithinAnyDir(dirs, abs) {
+			outside = true
+			continue
+		}
+		return abs, ""
+	}
+	if outside {
+		return "", "file not in music directory"
+	}
+	return "", "file not found"
+}
+
+// pathToURL turns a path into a file URL, or into an escaped relative URL
+// reference when the path is relative.
+func pathToURL(path string, relative bool) string {
+	if relative {
+		return (&url.URL{Path: path}).EscapedPath()
+	}
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
+
+// fileURLPath converts a file URL to a local path, including Windows drive
+// letters (file:///C:/…) and UNC hosts (file://server/share/…).
+func fileURLPath(u *url.URL) string {
+	if u.Opaque != "" {
+		// file:Music/song.mp3 names a relative path.
+		if path, err := url.PathUnescape(u.Opaque); err == nil {
+			return path
+		}
+		return u.Opaque
+	}
+	path := u.Path
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	if u.Host != "" && !strings.EqualFold(u.Host, "localhost") {
+		path = "//" + u.Host + path
+	}
+	return path
+}
+
+// ExportPlaylistFile writes a playlist to dest in the format given by dest's
+// extension.
+func (s *Service) ExportPlaylistFile(name string, dest string, options ExportOptions) error {
+	if strings.TrimSpace(dest) == "" {
+		return errors.New("destination is required")
+	}
+	if !playlistfmt.IsSupported(dest) {
+		return playlistfmt.ErrUnsupportedFormat
+	}
+	playlist, err := s.store.GetPlaylist(name)
+	if err != nil {
+		return err
+	}
+	baseDir := options.BaseDir
+	if baseDir == "" {
+		baseDir = filepath.Dir(dest)
+	}
+	entries := s.exportEntries(playlist, options.Relative, baseDir, playlistfmt.UsesURLs(dest))
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if err := playlistfmt.Write(dest, playlist.Name, file, entries); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// trackDuration returns the track's length in seconds, reading it from the
+// file when the scan did not.
+func trackDuration(file media.MusicFile) float64 {
+	if file.Duration > 0 {
+		return file.Duration
+	}
+	return media.ReadDuration(file.Path)
+}
+
+func (s *Service) exportEntries(playlist state.Playlist, relative bool, baseDir string, asURLs bool) []playlistfmt.Entry {
+	known := make(map[string]media.MusicFile)
+	if files, err := s.Index(); err == nil {
+		for _, file := range files {
+			known[file.Path] = file
+		}
+	}
+	entries := make([]playlistfmt.Entry, 0, len(playlist.Entries))
+	for _, item := range playlist.Entries {
+		location := item.Path
+		isRelative := false
+		if relative {
+			if rel, err := filepath.Rel(baseDir, item.Path); err == nil && !filepath.IsAbs(rel) {
+				location = filepath.ToSlash(rel)
+				isRelative = true
+			}
+		}
+		if asURLs {
+			location = pathToURL(location, isRelative)
+		}
+		entry := playlistfmt.Entry{Location: location}
+		if file, ok := known[item.Path]; ok {
+			entry.Title = file.Title
+			entry.Creator = file.Artist
+			entry.Album = file.Album
+			entry.Duration = time.Duration(trackDuration(file) * float64(time.Second))
+		}
+		if entry.Title == "" {
+			entry.Title = strings.TrimSuffix(filepath.Base(item.Path), filepath.Ext(item.Path))
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"LiteSound/internal/media"
 	"LiteSound/internal/state"
@@ -13,6 +14,9 @@ import (
 
 type Service struct {
 	store *state.Store
+
+	mu    sync.RWMutex
+	index []media.MusicFile
 }
 
 func New(store *state.Store) *Service {
@@ -20,6 +24,74 @@ func New(store *state.Store) *Service {
 }
 
 func (s *Service) ListMusicFiles() ([]media.MusicFile, error) {
+	return s.listFiltered(false)
+}
+
+// ListHiddenMusicFiles returns the tracks that ListMusicFiles leaves out, so
+// they can be reviewed and restored.
+func (s *Service) ListHiddenMusicFiles() ([]media.MusicFile, error) {
+	return s.listFiltered(true)
+}
+
+func (s *Service) listFiltered(hidden bool) ([]media.MusicFile, error) {
+	files, err := s.scanMusicFiles()
+	if err != nil {
+		return nil, err
+	}
+	exclusions, err := s.store.GetExclusions()
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.store.GetAllTrackStats()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.index = files
+	s.mu.Unlock()
+	// Folder playlists are refreshed on a best-effort basis; a failure to
+	// save them should not keep the library from listing.
+	_ = s.syncFolderPlaylists(files)
+	filtered := make([]media.MusicFile, 0, len(files))
+	for _, file := range files {
+		if exclusions.IsHidden(file.Path, file.Album) != hidden {
+			continue
+		}
+		file.SkipShuffle = exclusions.IsSkippedInShuffle(file.Path, file.Album)
+		filtered = append(filtered, withStats(file, stats))
+	}
+	return filtered, nil
+}
+
+// Index returns the tracks found by the most recent scan, scanning the music
+// directories first if nothing has been scanned yet. Hidden tracks are
+// included.
+func (s *Service) Index() ([]media.MusicFile, error) {
+	s.mu.RLock()
+	index := s.index
+	s.mu.RUnlock()
+	if index != nil {
+		return index, nil
+	}
+	files, err := s.scanMusicFiles()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.index = files
+	s.mu.Unlock()
+	return files, nil
+}
+
+// Invalidate drops the scanned index so the next Index call rescans, for
+// when the music directories may have changed underneath the service.
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	s.index = nil
+	s.mu.Unlock()
+}
+
+func (s *Service) scanMusicFiles() ([]media.MusicFile, error) {
 	dirs, err := s.store.ResolveMusicDirs()
 	if err != nil {
 		return nil, err
@@ -27,8 +99,13 @@ func (s *Service) ListMusicFiles() ([]media.MusicFile, error) {
 	if len(dirs) == 0 {
 		return nil, errors.New("music directory not found")
 	}
+	preferences, err := s.store.GetPreferences()
+	if err != nil {
+		return nil, err
+	}
 	entries := make([]media.MusicFile, 0)
 	seen := make(map[string]struct{})
+	tagStats := make(map[string]state.TrackStats)
 
 	for _, dir := range dirs {
 		if dir == "" {
@@ -41,6 +118,12 @@ func (s *Service) ListMusicFiles() ([]media.MusicFile, error) {
 			if walkErr != nil {
 				return walkErr
 			}
+			if preferences.ScanSkipHidden && path != dir && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 			if d.IsDir() {
 				return nil
 			}
@@ -56,13 +139,38 @@ func (s *Service) ListMusicFiles() ([]media.MusicFile, error) {
 				return nil
 			}
 			seen[abs] = struct{}{}
-			composer, album := media.ReadAudioMetadata(path)
+			// Lengths cost a second pass over the file, so they are only
+			// read here for the duration filter; matching reads the ones it
+			// needs.
+			var duration float64
+			if preferences.ScanMinDuration > 0 {
+				duration = media.ReadDuration(path)
+				if duration > 0 && duration < float64(preferences.ScanMinDuration) {
+					return nil
+				}
+			}
+			metadata := media.ReadTrackMetadata(path)
+			if preferences.RatingTags && (metadata.Rating > 0 || metadata.PlayCount > 0) {
+				tagStats[abs] = state.TrackStats{PlayCount: metadata.PlayCount, Rating: metadata.Rating}
+			}
+			var addedAt int64
+			if info, err := d.Info(); err == nil {
+				addedAt = info.ModTime().UnixMilli()
+			}
 			entries = append(entries, media.MusicFile{
 				Name:     d.Name(),
 				Path:     abs,
 				Ext:      ext,
-				Composer: composer,
-				Album:    album,
+				Title:    metadata.Title,
+				Artist:   metadata.Artist,
+				Composer: metadata.Composer,
+				Album:    metadata.Album,
+				Genre:    metadata.Genre,
+				Year:     metadata.Year,
+				Track:    metadata.Track,
+				ISRC:     metadata.ISRC,
+				Duration: duration,
+				AddedAt:  addedAt,
 			})
 			return nil
 		})
@@ -71,6 +179,12 @@ func (s *Service) ListMusicFiles() ([]media.MusicFile, error) {
 		}
 	}
 
+	// Ratings and play counts from tags are merged on a best-effort basis,
+	// like folder playlists.
+	if len(tagStats) > 0 {
+		_, _ = s.store.MergeTrackStats(tagStats)
+	}
+
 	sort.Slice(entries, func(i, j int) bool {
 		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
 	})
@@ -78,6 +192,36 @@ func (s *Service) ListMusicFiles() ([]media.MusicFile, error) {
 	return entries, nil
 }
 
+// withStats fills in a track's listening statistics.
+func withStats(file media.MusicFile, stats map[string]state.TrackStats) media.MusicFile {
+	trackStats := stats[file.Path]
+	file.PlayCount = trackStats.PlayCount
+	file.SkipCount = trackStats.SkipCount
+	file.LastPlayedAt = trackStats.LastPlayedAt
+	file.Rating = trackStats.Rating
+	return file
+}
+
+// WriteRatingTags writes a track's rating and play count into its tags. The
+// track must be in a music directory.
+func (s *Service) WriteRatingTags(path string, stats state.TrackStats) error {
+	if !media.IsAllowedAudio(path) {
+		return errors.New("unsupported audio type")
+	}
+	dirs, err := s.store.ResolveMusicDirs()
+	if err != nil {
+		return err
+	}
+	absFile, err := media.ResolveExistingPath(path)
+	if err != nil {
+		return err
+	}
+	if !media.IsPathWithinAnyDir(dirs, absFile) {
+		return errors.New("file not in music directory")
+	}
+	return media.WriteRatingTags(absFile, stats.Rating, stats.PlayCount)
+}
+
 func (s *Service) ReadMusicFile(path string) ([]byte, error) {
 	if path == "" {
 		return nil, errors.New("path is required")
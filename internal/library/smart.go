@@ -0,0 +1,233 @@
+package library
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"LiteSound/internal/media"
+	"LiteSound/internal/state"
+)
+
+// EvaluateSmartPlaylist returns the visible library tracks that match the
+// smart playlist's rules, sorted and limited as it specifies.
+func (s *Service) EvaluateSmartPlaylist(definition state.SmartPlaylist) ([]media.MusicFile, error) {
+	files, err := s.Index()
+	if err != nil {
+		return nil, err
+	}
+	exclusions, err := s.store.GetExclusions()
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.store.GetAllTrackStats()
+	if err != nil {
+		return nil, err
+	}
+	matched := evaluateSmartPlaylist(definition, files, exclusions, stats, time.Now())
+	for i := range matched {
+		matched[i] = withStats(matched[i], stats)
+	}
+	return matched, nil
+}
+
+// SmartPlaylistViews evaluates every smart playlist and presents each as a
+// read-only playlist view. If the library cannot be scanned the views are
+// returned without tracks.
+func (s *Service) SmartPlaylistViews() ([]state.PlaylistView, error) {
+	definitions, err := s.store.GetSmartPlaylists()
+	if err != nil {
+		return nil, err
+	}
+	if len(definitions) == 0 {
+		return []state.PlaylistView{}, nil
+	}
+	files, indexErr := s.Index()
+	exclusions, err := s.store.GetExclusions()
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.store.GetAllTrackStats()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	views := make([]state.PlaylistView, 0, len(definitions))
+	for _, definition := range definitions {
+		view := state.PlaylistView{
+			Playlist: state.Playlist{
+				ID:         definition.ID,
+				Name:       definition.Name,
+				CreatedAt:  definition.CreatedAt,
+				ModifiedAt: definition.ModifiedAt,
+				Entries:    []state.PlaylistEntry{},
+				Tracks:     []string{},
+			},
+			Smart:    true,
+			ReadOnly: true,
+		}
+		if indexErr == nil {
+			for i, file := range evaluateSmartPlaylist(definition, files, exclusions, stats, now) {
+				view.Entries = append(view.Entries, state.PlaylistEntry{
+					ID:   definition.ID + "-" + strconv.Itoa(i),
+					Path: file.Path,
+				})
+				view.Tracks = append(view.Tracks, file.Path)
+			}
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+func evaluateSmartPlaylist(definition state.SmartPlaylist, files []media.MusicFile, exclusions state.Exclusions, stats map[string]state.TrackStats, now time.Time) []media.MusicFile {
+	matched := make([]media.MusicFile, 0)
+	for _, file := range files {
+		if exclusions.IsHidden(file.Path, file.Album) {
+			continue
+		}
+		if matchesSmartRules(definition, file, stats[file.Path], now) {
+			matched = append(matched, file)
+		}
+	}
+	if definition.SortBy != "" {
+		sortBy := definition.SortBy
+		kind := state.SmartFieldType(sortBy)
+		sort.SliceStable(matched, func(i, j int) bool {
+			a, b := matched[i], matched[j]
+			if definition.SortDesc {
+				a, b = b, a
+			}
+			if kind == state.SmartFieldText {
+				return strings.ToLower(textField(a, sortBy)) < strings.ToLower(textField(b, sortBy))
+			}
+			return numericField(a, stats[a.Path], sortBy) < numericField(b, stats[b.Path], sortBy)
+		})
+	}
+	if definition.Limit > 0 && len(matched) > definition.Limit {
+		matched = matched[:definition.Limit]
+	}
+	return matched
+}
+
+func matchesSmartRules(definition state.SmartPlaylist, file media.MusicFile, stats state.TrackStats, now time.Time) bool {
+	matchAny := definition.Match == "any"
+	for _, rule := range definition.Rules {
+		matched := matchesSmartRule(rule, file, stats, now)
+		if matchAny && matched {
+			return true
+		}
+		if !matchAny && !matched {
+			return false
+		}
+	}
+	return !matchAny
+}
+
+func matchesSmartRule(rule state.SmartRule, file media.MusicFile, stats state.TrackStats, now time.Time) bool {
+	switch state.SmartFieldType(rule.Field) {
+	case state.SmartFieldText:
+		actual := strings.ToLower(textField(file, rule.Field))
+		expected := strings.ToLower(strings.TrimSpace(rule.Value))
+		switch rule.Operator {
+		case "is":
+			return actual == expected
+		case "isNot":
+			return actual != expected
+		case "contains":
+			return strings.Contains(actual, expected)
+		case "notContains":
+			return !strings.Contains(actual, expected)
+		case "startsWith":
+			return strings.HasPrefix(actual, expected)
+		case "endsWith":
+			return strings.HasSuffix(actual, expected)
+		}
+	case state.SmartFieldNumber:
+		expected, err := state.ParseSmartNumber(rule.Value)
+		if err != nil {
+			return false
+		}
+		actual := numericField(file, stats, rule.Field)
+		switch rule.Operator {
+		case "is":
+			return actual == expected
+		case "isNot":
+			return actual != expected
+		case "lt":
+			return actual < expected
+		case "lte":
+			return actual <= expected
+		case "gt":
+			return actual > expected
+		case "gte":
+			return actual >= expected
+		}
+	case state.SmartFieldDate:
+		actual := int64(numericField(file, stats, rule.Field))
+		switch rule.Operator {
+		case "inLast", "notInLast":
+			period, err := state.ParseSmartPeriod(rule.Value)
+			if err != nil {
+				return false
+			}
+			within := actual > 0 && actual >= now.Add(-period).UnixMilli()
+			return within == (rule.Operator == "inLast")
+		case "before", "after":
+			date, err := state.ParseSmartDate(rule.Value)
+			if err != nil || actual <= 0 {
+				return false
+			}
+			if rule.Operator == "before" {
+				return actual < date.UnixMilli()
+			}
+			return actual >= date.AddDate(0, 0, 1).UnixMilli()
+		}
+	}
+	return false
+}
+
+func textField(file media.MusicFile, field string) string {
+	switch field {
+	case "name":
+		return file.Name
+	case "title":
+		return file.Title
+	case "artist":
+		return file.Artist
+	case "composer":
+		return file.Composer
+	case "album":
+		return file.Album
+	case "genre":
+		return file.Genre
+	case "ext":
+		return file.Ext
+	case "path":
+		return file.Path
+	}
+	return ""
+}
+
+// numericField returns number and date fields; dates are Unix milliseconds
+// and zero when unknown.
+func numericField(file media.MusicFile, stats state.TrackStats, field string) float64 {
+	switch field {
+	case "year":
+		return float64(file.Year)
+	case "track":
+		return float64(file.Track)
+	case "playCount":
+		return float64(stats.PlayCount)
+	case "skipCount":
+		return float64(stats.SkipCount)
+	case "rating":
+		return stats.Rating
+	case "added":
+		return float64(file.AddedAt)
+	case "lastPlayed":
+		return float64(stats.LastPlayedAt)
+	}
+	return 0
+}
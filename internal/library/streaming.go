@@ -0,0 +1,93 @@
+package library
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"LiteSound/internal/playlistfmt"
+	"LiteSound/internal/state"
+)
+
+// streamingMatchThreshold is the lowest score at which a streaming export
+// row is added to the playlist. Rows below it are reported with their best
+// candidate so the user can decide.
+const streamingMatchThreshold = 0.8
+
+// TrackMatch is one row of a streaming export and the library track chosen
+// for it. Path is empty when nothing in the library resembles the row.
+type TrackMatch struct {
+	Line       int     `json:"line"`
+	Title      string  `json:"title"`
+	Artist     string  `json:"artist"`
+	Album      string  `json:"album"`
+	ISRC       string  `json:"isrc"`
+	Path       string  `json:"path"`
+	Method     string  `json:"method"`
+	Confidence float64 `json:"confidence"`
+}
+
+type MatchReport struct {
+	Playlist  state.Playlist `json:"playlist"`
+	Matched   []TrackMatch   `json:"matched"`
+	Unmatched []TrackMatch   `json:"unmatched"`
+}
+
+// ImportStreamingCSV creates a playlist from a CSV track list exported from
+// a streaming service. Each row is matched to a library track by ISRC, then
+// by title, artist, album and duration. Rows scoring below
+// streamingMatchThreshold are left out of the playlist and listed in
+// Unmatched with the closest track, if any.
+func (s *Service) ImportStreamingCSV(path string, name string) (MatchReport, error) {
+	report := MatchReport{Matched: []TrackMatch{}, Unmatched: []TrackMatch{}}
+	if strings.TrimSpace(path) == "" {
+		return report, errors.New("path is required")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return report, err
+	}
+	defer file.Close()
+	entries, err := playlistfmt.ReadCSV(file)
+	if err != nil {
+		return report, err
+	}
+	index, err := s.Index()
+	if err != nil {
+		return report, err
+	}
+	matcher := newTrackMatcher(index)
+
+	tracks := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		candidate, score, method := matcher.match(entry)
+		match := TrackMatch{
+			Line:       entry.Line,
+			Title:      entry.Title,
+			Artist:     entry.Creator,
+			Album:      entry.Album,
+			ISRC:       entry.ISRC,
+			Path:       candidate.Path,
+			Method:     method,
+			Confidence: score,
+		}
+		if score < streamingMatchThreshold {
+			report.Unmatched = append(report.Unmatched, match)
+			continue
+		}
+		report.Matched = append(report.Matched, match)
+		tracks = append(tracks, candidate.Path)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	playlist, err := s.store.ImportPlaylist(name, tracks)
+	if err != nil {
+		return report, err
+	}
+	report.Playlist = playlist
+	return report, nil
+}
@@ -0,0 +1,201 @@
+package libraryfmt
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// macEpochOffset converts the seconds since 1904 used by iTunes' "Play Date"
+// to Unix seconds.
+const macEpochOffset = 2082844800
+
+// readITunes reads an "iTunes Music Library.xml" or "Library.xml" exported
+// from Music. Ratings that iTunes derived from the album rating are
+// ignored, as are the library, smart, folder and built-in playlists.
+func readITunes(r io.Reader) (Library, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	var root map[string]interface{}
+	for root == nil {
+		token, err := decoder.Token()
+		if err != nil {
+			return Library{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "dict" {
+			value, err := decodePlistValue(decoder, start)
+			if err != nil {
+				return Library{}, err
+			}
+			root, _ = value.(map[string]interface{})
+		}
+	}
+	trackDicts, _ := root["Tracks"].(map[string]interface{})
+	if trackDicts == nil {
+		return Library{}, errors.New("not an iTunes library")
+	}
+
+	library := Library{Format: FormatITunes, Tracks: make([]Track, 0, len(trackDicts)), Playlists: []Playlist{}, Skipped: []string{}}
+	byID := make(map[string]Track, len(trackDicts))
+	// Track IDs are numbers that iTunes hands out in the order tracks were
+	// added, so sorting by them keeps the import order stable.
+	ids := make([]string, 0, len(trackDicts))
+	for id := range trackDicts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, errA := strconv.ParseInt(ids[i], 10, 64)
+		b, errB := strconv.ParseInt(ids[j], 10, 64)
+		if errA == nil && errB == nil && a != b {
+			return a < b
+		}
+		return ids[i] < ids[j]
+	})
+	for _, id := range ids {
+		dict, ok := trackDicts[id].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		track := Track{
+			Location:  plistString(dict, "Location"),
+			Title:     plistString(dict, "Name"),
+			Artist:    plistString(dict, "Artist"),
+			Album:     plistString(dict, "Album"),
+			Duration:  time.Duration(plistInt(dict, "Total Time")) * time.Millisecond,
+			PlayCount: int(plistInt(dict, "Play Count")),
+			SkipCount: int(plistInt(dict, "Skip Count")),
+		}
+		if computed, _ := dict["Rating Computed"].(bool); !computed {
+			track.Rating = float64(plistInt(dict, "Rating")) / 20
+		}
+		if played, ok := dict["Play Date UTC"].(time.Time); ok {
+			track.LastPlayed = played
+		} else if seconds := plistInt(dict, "Play Date"); seconds > 0 {
+			track.LastPlayed = time.Unix(seconds-macEpochOffset, 0)
+		}
+		byID[id] = track
+		library.Tracks = append(library.Tracks, track)
+	}
+
+	playlists, _ := root["Playlists"].([]interface{})
+	for _, value := range playlists {
+		dict, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := plistString(dict, "Name")
+		if master, _ := dict["Master"].(bool); master {
+			continue
+		}
+		_, builtIn := dict["Distinguished Kind"]
+		_, smart := dict["Smart Info"]
+		folder, _ := dict["Folder"].(bool)
+		if builtIn || smart || folder {
+			library.Skipped = append(library.Skipped, name)
+			continue
+		}
+		playlist := Playlist{Name: name, Tracks: []Track{}}
+		items, _ := dict["Playlist Items"].([]interface{})
+		for _, item := range items {
+			itemDict, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if track, ok := byID[strconv.FormatInt(plistInt(itemDict, "Track ID"), 10)]; ok {
+				playlist.Tracks = append(playlist.Tracks, track)
+			}
+		}
+		library.Playlists = append(library.Playlists, playlist)
+	}
+	return library, nil
+}
+
+// decodePlistValue decodes the property list value that start opens: dicts
+// become maps, arrays slices, integers int64, reals float64, dates
+// time.Time and booleans bool. Strings and data stay strings.
+func decodePlistValue(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]interface{})
+		key := ""
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch element := token.(type) {
+			case xml.StartElement:
+				if element.Name.Local == "key" {
+					if err := decoder.DecodeElement(&key, &element); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				value, err := decodePlistValue(decoder, element)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+	case "array":
+		array := make([]interface{}, 0)
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch element := token.(type) {
+			case xml.StartElement:
+				value, err := decodePlistValue(decoder, element)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+	case "true", "false":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+	var text string
+	if err := decoder.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	text = strings.TrimSpace(text)
+	switch start.Name.Local {
+	case "integer":
+		number, _ := strconv.ParseInt(text, 10, 64)
+		return number, nil
+	case "real":
+		number, _ := strconv.ParseFloat(text, 64)
+		return number, nil
+	case "date":
+		date, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return text, nil
+		}
+		return date, nil
+	}
+	return text, nil
+}
+
+func plistString(dict map[string]interface{}, key string) string {
+	text, _ := dict[key].(string)
+	return text
+}
+
+func plistInt(dict map[string]interface{}, key string) int64 {
+	number, _ := dict[key].(int64)
+	return number
+}
@@ -0,0 +1,115 @@
+// Package libraryfmt reads library databases and playlist exports from other
+// players so their play counts, ratings and playlists can be brought over.
+package libraryfmt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"LiteSound/internal/playlistfmt"
+)
+
+const (
+	FormatITunes             = "itunes"
+	FormatRhythmbox          = "rhythmbox"
+	FormatRhythmboxPlaylists = "rhythmbox-playlists"
+	FormatPlaylist           = "playlist"
+)
+
+// Track is a track as the other player knows it. Location is a file URL or
+// a path from the machine the export was made on. Rating runs from 0 to 5
+// in half steps; zero values mean the player recorded nothing.
+type Track struct {
+	Location   string
+	Title      string
+	Artist     string
+	Album      string
+	Duration   time.Duration
+	PlayCount  int
+	SkipCount  int
+	Rating     float64
+	LastPlayed time.Time
+}
+
+type Playlist struct {
+	Name   string
+	Tracks []Track
+}
+
+// Library is the content of one export. Tracks carries listening data and
+// may be empty for formats that only hold playlists. Skipped names the
+// playlists left out because they are generated by the other player.
+type Library struct {
+	Format    string
+	Tracks    []Track
+	Playlists []Playlist
+	Skipped   []string
+}
+
+var ErrUnsupportedFormat = errors.New("unsupported library format")
+
+// Read parses an export. XML files are recognised by their root element as an
+// iTunes or Music library, a Rhythmbox rhythmdb.xml or a Rhythmbox
+// playlists.xml. Playlist files, which is how foobar2000 and most other
+// players export, become a single playlist named after the file.
+func Read(name string, r io.Reader) (Library, error) {
+	if playlistfmt.IsSupported(name) {
+		entries, err := playlistfmt.Read(name, r)
+		if err != nil {
+			return Library{}, err
+		}
+		playlist := Playlist{
+			Name:   strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)),
+			Tracks: make([]Track, 0, len(entries)),
+		}
+		for _, entry := range entries {
+			playlist.Tracks = append(playlist.Tracks, Track{
+				Location: entry.Location,
+				Title:    entry.Title,
+				Artist:   entry.Creator,
+				Album:    entry.Album,
+				Duration: entry.Duration,
+			})
+		}
+		return Library{Format: FormatPlaylist, Tracks: []Track{}, Playlists: []Playlist{playlist}, Skipped: []string{}}, nil
+	}
+	if !strings.EqualFold(filepath.Ext(name), ".xml") {
+		return Library{}, ErrUnsupportedFormat
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Library{}, err
+	}
+	root, err := rootElement(data)
+	if err != nil {
+		return Library{}, err
+	}
+	switch root {
+	case "plist":
+		return readITunes(bytes.NewReader(data))
+	case "rhythmdb":
+		return readRhythmDB(bytes.NewReader(data))
+	case "rhythmdb-playlists":
+		return readRhythmboxPlaylists(bytes.NewReader(data))
+	}
+	return Library{}, ErrUnsupportedFormat
+}
+
+func rootElement(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
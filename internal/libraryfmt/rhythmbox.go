@@ -0,0 +1,84 @@
+package libraryfmt
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+type rhythmDB struct {
+	Entries []struct {
+		Type       string  `xml:"type,attr"`
+		Title      string  `xml:"title"`
+		Artist     string  `xml:"artist"`
+		Album      string  `xml:"album"`
+		Location   string  `xml:"location"`
+		Duration   int64   `xml:"duration"`
+		PlayCount  int     `xml:"play-count"`
+		Rating     float64 `xml:"rating"`
+		LastPlayed int64   `xml:"last-played"`
+	} `xml:"entry"`
+}
+
+type rhythmboxPlaylists struct {
+	Playlists []struct {
+		Name      string   `xml:"name,attr"`
+		Type      string   `xml:"type,attr"`
+		Locations []string `xml:"location"`
+	} `xml:"playlist"`
+}
+
+// readRhythmDB reads the song entries of a Rhythmbox rhythmdb.xml. Podcasts,
+// radio stations and ignored files are left out.
+func readRhythmDB(r io.Reader) (Library, error) {
+	var db rhythmDB
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	if err := decoder.Decode(&db); err != nil {
+		return Library{}, err
+	}
+	library := Library{Format: FormatRhythmbox, Tracks: make([]Track, 0, len(db.Entries)), Playlists: []Playlist{}, Skipped: []string{}}
+	for _, entry := range db.Entries {
+		if entry.Type != "song" {
+			continue
+		}
+		track := Track{
+			Location:  entry.Location,
+			Title:     entry.Title,
+			Artist:    entry.Artist,
+			Album:     entry.Album,
+			Duration:  time.Duration(entry.Duration) * time.Second,
+			PlayCount: entry.PlayCount,
+			Rating:    entry.Rating,
+		}
+		if entry.LastPlayed > 0 {
+			track.LastPlayed = time.Unix(entry.LastPlayed, 0)
+		}
+		library.Tracks = append(library.Tracks, track)
+	}
+	return library, nil
+}
+
+// readRhythmboxPlaylists reads the static playlists of a Rhythmbox
+// playlists.xml. Automatic playlists and the play queue are skipped.
+func readRhythmboxPlaylists(r io.Reader) (Library, error) {
+	var file rhythmboxPlaylists
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	if err := decoder.Decode(&file); err != nil {
+		return Library{}, err
+	}
+	library := Library{Format: FormatRhythmboxPlaylists, Tracks: []Track{}, Playlists: []Playlist{}, Skipped: []string{}}
+	for _, playlist := range file.Playlists {
+		if playlist.Type != "static" {
+			library.Skipped = append(library.Skipped, playlist.Name)
+			continue
+		}
+		imported := Playlist{Name: playlist.Name, Tracks: make([]Track, 0, len(playlist.Locations))}
+		for _, location := range playlist.Locations {
+			imported.Tracks = append(imported.Tracks, Track{Location: location})
+		}
+		library.Playlists = append(library.Playlists, imported)
+	}
+	return library, nil
+}
@@ -16,11 +16,24 @@ var AllowedAudioExt = map[string]string{
 }
 
 type MusicFile struct {
-	Name     string `json:"name"`
-	Path     string `json:"path"`
-	Ext      string `json:"ext"`
-	Composer string `json:"composer"`
-	Album    string `json:"album"`
+	Name         string  `json:"name"`
+	Path         string  `json:"path"`
+	Ext          string  `json:"ext"`
+	Title        string  `json:"title"`
+	Artist       string  `json:"artist"`
+	Composer     string  `json:"composer"`
+	Album        string  `json:"album"`
+	Genre        string  `json:"genre"`
+	Year         int     `json:"year"`
+	Track        int     `json:"track"`
+	ISRC         string  `json:"isrc"`
+	Duration     float64 `json:"duration"`
+	AddedAt      int64   `json:"addedAt"`
+	SkipShuffle  bool    `json:"skipShuffle"`
+	PlayCount    int     `json:"playCount"`
+	SkipCount    int     `json:"skipCount"`
+	LastPlayedAt int64   `json:"lastPlayedAt"`
+	Rating       float64 `json:"rating"`
 }
 
 func DefaultMusicDir() (string, error) {
@@ -0,0 +1,284 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadDuration returns the playing time of an audio file in seconds, read
+// from its headers without decoding. It returns 0 when the format does not
+// record a length, such as raw AAC, or the file cannot be read.
+func ReadDuration(path string) float64 {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		return mp3Duration(file, info.Size())
+	case ".flac":
+		return flacDuration(file)
+	case ".wav":
+		return wavDuration(file)
+	case ".m4a":
+		return mp4Duration(file, info.Size())
+	case ".ogg":
+		return oggDuration(file, info.Size())
+	}
+	return 0
+}
+
+var (
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	}
+	mp3SampleRates = [3][3]int{
+		{44100, 48000, 32000},
+		{22050, 24000, 16000},
+		{11025, 12000, 8000},
+	}
+)
+
+// mp3Duration uses the Xing/Info or VBRI frame count when present and falls
+// back to a constant-bitrate estimate from the first frame. Only layer III
+// is handled.
+func mp3Duration(r io.ReadSeeker, size int64) float64 {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0
+	}
+	start := int64(0)
+	if bytes.HasPrefix(header, []byte("ID3")) {
+		tagSize := int64(header[6]&0x7F)<<21 | int64(header[7]&0x7F)<<14 | int64(header[8]&0x7F)<<7 | int64(header[9]&0x7F)
+		start = 10 + tagSize
+		if header[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0
+	}
+	buf := make([]byte, 64*1024)
+	n, _ := io.ReadFull(r, buf)
+	buf = buf[:n]
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		versionBits := (buf[i+1] >> 3) & 0x03
+		layerBits := (buf[i+1] >> 1) & 0x03
+		bitrateIndex := buf[i+2] >> 4
+		rateIndex := (buf[i+2] >> 2) & 0x03
+		if versionBits == 1 || layerBits != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+			continue
+		}
+		mpeg1 := versionBits == 3
+		versionRow, bitrateRow, samplesPerFrame := 0, 0, 1152
+		if !mpeg1 {
+			bitrateRow, samplesPerFrame = 1, 576
+			versionRow = 1
+			if versionBits == 0 {
+				versionRow = 2
+			}
+		}
+		sampleRate := mp3SampleRates[versionRow][rateIndex]
+		bitrate := mp3Bitrates[bitrateRow][bitrateIndex] * 1000
+		mono := buf[i+3]>>6 == 3
+		sideInfo := 32
+		switch {
+		case mpeg1 && mono:
+			sideInfo = 17
+		case !mpeg1 && !mono:
+			sideInfo = 17
+		case !mpeg1 && mono:
+			sideInfo = 9
+		}
+		if xing := i + 4 + sideInfo; xing+12 <= len(buf) {
+			tag := string(buf[xing : xing+4])
+			if (tag == "Xing" || tag == "Info") && buf[xing+7]&0x01 != 0 {
+				frames := binary.BigEndian.Uint32(buf[xing+8:])
+				return float64(frames) * float64(samplesPerFrame) / float64(sampleRate)
+			}
+		}
+		if vbri := i + 36; vbri+18 <= len(buf) && string(buf[vbri:vbri+4]) == "VBRI" {
+			frames := binary.BigEndian.Uint32(buf[vbri+14:])
+			return float64(frames) * float64(samplesPerFrame) / float64(sampleRate)
+		}
+		audioBytes := size - start - int64(i)
+		return float64(audioBytes) * 8 / float64(bitrate)
+	}
+	return 0
+}
+
+func flacDuration(r io.Reader) float64 {
+	header := make([]byte, 4+4+34)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:4]) != "fLaC" {
+		return 0
+	}
+	info := header[8:]
+	sampleRate := int64(info[10])<<12 | int64(info[11])<<4 | int64(info[12])>>4
+	samples := int64(info[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(info[14:18]))
+	if sampleRate == 0 {
+		return 0
+	}
+	return float64(samples) / float64(sampleRate)
+}
+
+// maxWAVFormatSize bounds the fmt chunk read into memory; real ones are at
+// most a few dozen bytes.
+const maxWAVFormatSize = 64 * 1024
+
+func wavDuration(r io.Reader) float64 {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return 0
+	}
+	byteRate := uint32(0)
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return 0
+		}
+		id := string(chunk[:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		switch id {
+		case "fmt ":
+			if size < 12 || size > maxWAVFormatSize {
+				return 0
+			}
+			format := make([]byte, size)
+			if _, err := io.ReadFull(r, format); err != nil {
+				return 0
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:])
+			if size%2 == 1 {
+				_, _ = io.CopyN(io.Discard, r, 1)
+			}
+		case "data":
+			if byteRate == 0 {
+				return 0
+			}
+			return float64(size) / float64(byteRate)
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return 0
+			}
+		}
+	}
+}
+
+// mp4Duration reads the movie header inside the moov atom.
+func mp4Duration(r io.ReadSeeker, size int64) float64 {
+	offset, end := int64(0), size
+	header := make([]byte, 8)
+	for offset+8 <= end {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0
+		}
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0
+		}
+		atomSize := int64(binary.BigEndian.Uint32(header))
+		atomType := string(header[4:])
+		headerSize := int64(8)
+		if atomSize == 1 {
+			large := make([]byte, 8)
+			if _, err := io.ReadFull(r, large); err != nil {
+				return 0
+			}
+			atomSize = int64(binary.BigEndian.Uint64(large))
+			headerSize = 16
+		} else if atomSize == 0 {
+			atomSize = end - offset
+		}
+		if atomSize < headerSize {
+			return 0
+		}
+		switch atomType {
+		case "moov":
+			offset, end = offset+headerSize, offset+atomSize
+			continue
+		case "mvhd":
+			body := make([]byte, 32)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return 0
+			}
+			var timescale, duration uint64
+			if body[0] == 1 {
+				timescale = uint64(binary.BigEndian.Uint32(body[20:]))
+				duration = binary.BigEndian.Uint64(body[24:])
+			} else {
+				timescale = uint64(binary.BigEndian.Uint32(body[12:]))
+				duration = uint64(binary.BigEndian.Uint32(body[16:]))
+			}
+			if timescale == 0 {
+				return 0
+			}
+			return float64(duration) / float64(timescale)
+		}
+		offset += atomSize
+	}
+	return 0
+}
+
+// oggDuration divides the granule position of the last page by the sample
+// rate from the Vorbis or Opus identification header.
+func oggDuration(r io.ReadSeeker, size int64) float64 {
+	// The first page holds a 27-byte header, up to 255 segment sizes and
+	// then the identification packet.
+	first := make([]byte, 27+255+32)
+	n, _ := io.ReadFull(r, first)
+	first = first[:n]
+	if !bytes.HasPrefix(first, []byte("OggS")) || len(first) < 28 {
+		return 0
+	}
+	packetStart := 27 + int(first[26])
+	if packetStart > len(first) {
+		return 0
+	}
+	packet := first[packetStart:]
+	var sampleRate float64
+	var preSkip uint64
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 16:
+		sampleRate = float64(binary.LittleEndian.Uint32(packet[12:]))
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 12:
+		sampleRate = 48000
+		preSkip = uint64(binary.LittleEndian.Uint16(packet[10:]))
+	default:
+		return 0
+	}
+	if sampleRate == 0 {
+		return 0
+	}
+	tailSize := int64(64 * 1024)
+	if tailSize > size {
+		tailSize = size
+	}
+	if _, err := r.Seek(size-tailSize, io.SeekStart); err != nil {
+		return 0
+	}
+	tail := make([]byte, tailSize)
+	if _, err := io.ReadFull(r, tail); err != nil {
+		return 0
+	}
+	last := bytes.LastIndex(tail, []byte("OggS"))
+	if last < 0 || last+14 > len(tail) {
+		return 0
+	}
+	granule := binary.LittleEndian.Uint64(tail[last+6:])
+	if granule <= preSkip {
+		return 0
+	}
+	return float64(granule-preSkip) / sampleRate
+}
@@ -0,0 +1,175 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func wavFixture(formatSize uint32, byteRate uint32, dataSize uint32) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(0))
+	buf.WriteString("WAVE")
+	buf.WriteString("LIST")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(3))
+	buf.Write([]byte{1, 2, 3, 0})
+	buf.WriteString("fmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, formatSize)
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format[0:], 1)
+	binary.LittleEndian.PutUint16(format[2:], 2)
+	binary.LittleEndian.PutUint32(format[4:], 44100)
+	binary.LittleEndian.PutUint32(format[8:], byteRate)
+	buf.Write(format)
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, dataSize)
+	return buf.Bytes()
+}
+
+func flacFixture(sampleRate uint32, samples uint64) []byte {
+	data := []byte("fLaC")
+	data = append(data, 0x80, 0, 0, 34)
+	info := make([]byte, 34)
+	info[10] = byte(sampleRate >> 12)
+	info[11] = byte(sampleRate >> 4)
+	info[12] = byte(sampleRate<<4) | 0x02
+	info[13] = 0xF0 | byte(samples>>32)
+	binary.BigEndian.PutUint32(info[14:], uint32(samples))
+	return append(data, info...)
+}
+
+// mp3Frame is an MPEG-1 layer III stereo frame header at 128 kbit/s and
+// 44.1 kHz.
+var mp3Frame = []byte{0xFF, 0xFB, 0x90, 0x00}
+
+func mp3Fixture(xingFrames uint32, audioBytes int) []byte {
+	data := []byte("ID3\x03\x00\x00\x00\x00\x00\x0A")
+	data = append(data, make([]byte, 10)...)
+	frame := make([]byte, audioBytes)
+	copy(frame, mp3Frame)
+	if xingFrames > 0 {
+		xing := 4 + 32
+		copy(frame[xing:], "Xing")
+		binary.BigEndian.PutUint32(frame[xing+4:], 0x01)
+		binary.BigEndian.PutUint32(frame[xing+8:], xingFrames)
+	}
+	return append(data, frame...)
+}
+
+func oggPage(segments []byte, packet []byte, granule uint64) []byte {
+	page := []byte("OggS")
+	page = append(page, 0, 0)
+	page = binary.LittleEndian.AppendUint64(page, granule)
+	page = append(page, make([]byte, 12)...)
+	page = append(page, byte(len(segments)))
+	page = append(page, segments...)
+	return append(page, packet...)
+}
+
+func vorbisFixture(sampleRate uint32, granule uint64) []byte {
+	packet := []byte("\x01vorbis")
+	packet = binary.LittleEndian.AppendUint32(packet, 0)
+	packet = append(packet, 2)
+	packet = binary.LittleEndian.AppendUint32(packet, sampleRate)
+	packet = append(packet, make([]byte, 14)...)
+	data := oggPage([]byte{byte(len(packet))}, packet, 0)
+	return append(data, oggPage([]byte{0}, nil, granule)...)
+}
+
+func opusFixture(preSkip uint16, granule uint64) []byte {
+	packet := []byte("OpusHead")
+	packet = append(packet, 1, 2)
+	packet = binary.LittleEndian.AppendUint16(packet, preSkip)
+	packet = append(packet, make([]byte, 7)...)
+	data := oggPage([]byte{byte(len(packet))}, packet, 0)
+	return append(data, oggPage([]byte{0}, nil, granule)...)
+}
+
+func mp4Atom(kind string, body []byte) []byte {
+	atom := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	atom = append(atom, kind...)
+	return append(atom, body...)
+}
+
+func mp4Fixture(timescale uint32, duration uint32) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:], duration)
+	data := mp4Atom("ftyp", []byte("M4A \x00\x00\x00\x00"))
+	return append(data, mp4Atom("moov", mp4Atom("mvhd", mvhd))...)
+}
+
+func TestReadDuration(t *testing.T) {
+	wav := wavFixture(16, 176400, 176400*3)
+	flac := flacFixture(44100, 44100*90)
+	mp3 := mp3Fixture(0, 16000)
+	mp3VBR := mp3Fixture(1000, 1024)
+	vorbis := vorbisFixture(44100, 44100*200)
+	opus := opusFixture(312, 48000*60+312)
+	m4a := mp4Fixture(1000, 245500)
+
+	hugeFormat := wavFixture(0xFFFFFFF0, 176400, 176400)
+	shortFormat := wavFixture(8, 176400, 176400)
+	// A first page claiming 255 segments in a file too short to hold them.
+	oggShort := append([]byte("OggS"), make([]byte, 22)...)
+	oggShort = append(oggShort, 255, 30)
+
+	tests := []struct {
+		name string
+		file string
+		data []byte
+		want float64
+	}{
+		{"wav", "a.wav", wav, 3},
+		{"flac", "a.flac", flac, 90},
+		{"mp3 constant bitrate", "a.mp3", mp3, 1},
+		{"mp3 xing frame count", "a.mp3", mp3VBR, 1000 * 1152 / 44100.0},
+		{"ogg vorbis", "a.ogg", vorbis, 200},
+		{"ogg opus", "a.ogg", opus, 60},
+		{"m4a", "a.m4a", m4a, 245.5},
+		{"unknown extension", "a.aac", wav, 0},
+		{"empty mp3", "a.mp3", nil, 0},
+
+		{"wav fmt chunk too large", "a.wav", hugeFormat, 0},
+		{"wav fmt chunk too small", "a.wav", shortFormat, 0},
+		{"wav wrong magic", "a.wav", append([]byte("RIFX"), wav[4:]...), 0},
+		{"flac wrong magic", "a.flac", append([]byte("fLaX"), flac[4:]...), 0},
+		{"flac zero sample rate", "a.flac", flacFixture(0, 1000), 0},
+		{"ogg unknown codec", "a.ogg", oggPage([]byte{8}, []byte("\x01theora"), 100), 0},
+		{"ogg segment table past end", "a.ogg", oggShort, 0},
+		{"m4a zero timescale", "a.m4a", mp4Fixture(0, 1000), 0},
+		{"m4a atom smaller than header", "a.m4a", []byte{0, 0, 0, 4, 'm', 'o', 'o', 'v'}, 0},
+		{"mp3 without frames", "a.mp3", bytes.Repeat([]byte{0x00}, 4096), 0},
+
+		{"wav truncated in header", "a.wav", wav[:10], 0},
+		{"wav truncated before data", "a.wav", wav[:40], 0},
+		{"flac truncated", "a.flac", flac[:20], 0},
+		{"mp3 truncated in tag", "a.mp3", mp3[:8], 0},
+		{"ogg truncated in header", "a.ogg", vorbis[:20], 0},
+		{"ogg truncated in packet", "a.ogg", vorbis[:40], 0},
+		{"ogg truncated before last page", "a.ogg", vorbis[:len(vorbis)-20], 0},
+		{"m4a truncated in mvhd", "a.m4a", m4a[:len(m4a)-90], 0},
+	}
+	dir := t.TempDir()
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(rune('a'+i))+test.file)
+			if err := os.WriteFile(path, test.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if got := ReadDuration(path); math.Abs(got-test.want) > 0.001 {
+				t.Errorf("ReadDuration() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadDurationMissingFile(t *testing.T) {
+	if got := ReadDuration(filepath.Join(t.TempDir(), "missing.mp3")); got != 0 {
+		t.Errorf("ReadDuration() = %v, want 0", got)
+	}
+}
@@ -7,23 +7,69 @@ import (
 	"github.com/dhowden/tag"
 )
 
-func ReadAudioMetadata(path string) (string, string) {
+type TrackMetadata struct {
+	Title    string
+	Artist   string
+	Album    string
+	Composer string
+	Genre    string
+	Year     int
+	Track    int
+	ISRC     string
+	// Rating (0-5 stars) and PlayCount come from rating tags; see
+	// WriteRatingTags.
+	Rating    float64
+	PlayCount int
+}
+
+// ReadTrackMetadata reads the tags of an audio file. Composer falls back to
+// the artist, matching how the library groups tracks. Unreadable files yield
+// empty metadata.
+func ReadTrackMetadata(path string) TrackMetadata {
 	file, err := os.Open(path)
 	if err != nil {
-		return "", ""
+		return TrackMetadata{}
 	}
 	defer file.Close()
 
 	metadata, err := tag.ReadFrom(file)
 	if err != nil {
-		return "", ""
+		return TrackMetadata{}
 	}
 
-	album := strings.TrimSpace(metadata.Album())
+	artist := strings.TrimSpace(metadata.Artist())
 	composer := strings.TrimSpace(metadata.Composer())
 	if composer == "" {
-		composer = strings.TrimSpace(metadata.Artist())
+		composer = artist
+	}
+	track, _ := metadata.Track()
+	rating, playCount := rawStats(metadata.Raw())
+
+	return TrackMetadata{
+		Title:     strings.TrimSpace(metadata.Title()),
+		Artist:    artist,
+		Album:     strings.TrimSpace(metadata.Album()),
+		Composer:  composer,
+		Genre:     strings.TrimSpace(metadata.Genre()),
+		Year:      metadata.Year(),
+		Track:     track,
+		ISRC:      rawISRC(metadata.Raw()),
+		Rating:    rating,
+		PlayCount: playCount,
 	}
+}
 
-	return composer, album
+// rawISRC finds the recording code in the raw tags: the ID3 TSRC frame, the
+// Vorbis ISRC comment or an iTunes freeform ISRC atom.
+func rawISRC(raw map[string]interface{}) string {
+	for key, value := range raw {
+		lower := strings.ToLower(key)
+		if lower != "tsrc" && lower != "isrc" && !strings.HasSuffix(lower, ":isrc") {
+			continue
+		}
+		if text, ok := value.(string); ok && strings.TrimSpace(text) != "" {
+			return strings.ToUpper(strings.TrimSpace(text))
+		}
+	}
+	return ""
 }
@@ -54,3 +54,19 @@ func ResolveExistingPath(path string) (string, error) {
 	}
 	return filepath.Clean(resolvedPath), nil
 }
+
+// SafeFileName makes a single path component safe on Windows and on FAT and
+// exFAT volumes. It returns "" when nothing usable is left.
+func SafeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(strings.TrimSpace(name), ". ")
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
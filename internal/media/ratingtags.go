@@ -0,0 +1,730 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrTagsUnsupported is returned by WriteRatingTags for formats whose tags
+// it cannot write.
+var ErrTagsUnsupported = errors.New("rating tags are not supported for this file type")
+
+// popmEmail identifies the ID3 popularimeter frame LiteSound writes. Frames
+// left by other players are kept.
+const popmEmail = "LiteSound"
+
+// popmValues maps half-star ratings, doubled, to popularimeter bytes, using
+// the values Windows Media Player and MusicBee use.
+var popmValues = [11]byte{0, 13, 1, 54, 64, 118, 128, 186, 196, 242, 255}
+
+// ratingFromPOPM converts a popularimeter byte to 0-5 stars in half steps.
+// Bytes from the table are exact; others fall in the usual ranges.
+func ratingFromPOPM(value byte) float64 {
+	for doubled, known := range popmValues {
+		if known == value {
+			return float64(doubled) / 2
+		}
+	}
+	switch {
+	case value < 32:
+		return 1
+	case value < 96:
+		return 2
+	case value < 160:
+		return 3
+	case value < 224:
+		return 4
+	}
+	return 5
+}
+
+// Where a rating was read from, in order of preference when a file has
+// several.
+const (
+	ratingFromOwnPOPM = iota + 1
+	ratingFromVorbis
+	ratingFromOtherPOPM
+)
+
+// rawStats finds a rating and play count in the raw tags: ID3 POPM and
+// PCNT frames or the Vorbis RATING and PLAYCOUNT comments. LiteSound's own
+// popularimeter wins over a Vorbis rating, which wins over other players'
+// popularimeters; ties go to the first tag by name. Vorbis ratings are read
+// as stars up to 5 and as 0-100 above that. The play count is the largest
+// found.
+func rawStats(raw map[string]interface{}) (float64, int) {
+	var rating float64
+	ratingSource := 0
+	setRating := func(value float64, source int) {
+		if ratingSource == 0 || source < ratingSource {
+			rating, ratingSource = value, source
+		}
+	}
+	playCount := 0
+	for _, key := range slices.Sorted(maps.Keys(raw)) {
+		value := raw[key]
+		lower := strings.ToLower(key)
+		name, _, _ := strings.Cut(lower, "_")
+		switch name {
+		case "popm", "pop":
+			data, ok := value.([]byte)
+			if !ok {
+				continue
+			}
+			email, rest, found := bytes.Cut(data, []byte{0})
+			if !found || len(rest) == 0 {
+				continue
+			}
+			source := ratingFromOtherPOPM
+			if string(email) == popmEmail {
+				source = ratingFromOwnPOPM
+			}
+			// Other players write 0 for unrated; LiteSound's own frame
+			// with 0 means the track was unrated here.
+			if source == ratingFromOwnPOPM || rest[0] != 0 {
+				setRating(ratingFromPOPM(rest[0]), source)
+			}
+			playCount = max(playCount, readCounter(rest[1:]))
+		case "pcnt", "cnt":
+			if data, ok := value.([]byte); ok {
+				playCount = max(playCount, readCounter(data))
+			}
+		case "rating":
+			if text, ok := value.(string); ok {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(text), 64); err == nil && parsed > 0 {
+					if parsed > 5 {
+						parsed /= 20
+					}
+					setRating(math.Min(math.Round(parsed*2)/2, 5), ratingFromVorbis)
+				}
+			}
+		case "playcount":
+			if text, ok := value.(string); ok {
+				if parsed, err := strconv.Atoi(strings.TrimSpace(text)); err == nil {
+					playCount = max(playCount, parsed)
+				}
+			}
+		}
+	}
+	return rating, playCount
+}
+
+func readCounter(data []byte) int {
+	if len(data) == 0 || len(data) > 8 {
+		return 0
+	}
+	var counter uint64
+	for _, b := range data {
+		counter = counter<<8 | uint64(b)
+	}
+	return int(min(counter, math.MaxInt32))
+}
+
+func writeCounter(count int) []byte {
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, uint32(min(max(count, 0), math.MaxUint32)))
+	return counter
+}
+
+// WriteRatingTags stores a 0-5 star rating and a play count in the tags of
+// an MP3 (ID3v2.3 or 2.4 POPM and PCNT frames), FLAC or Ogg Vorbis or Opus
+// file (RATING, as 0-100, and PLAYCOUNT comments). Zero values remove the
+// tags. The file's modification time is kept. Other formats return
+// ErrTagsUnsupported.
+func WriteRatingTags(path string, rating float64, playCount int) error {
+	doubled := math.Round(rating * 2)
+	if doubled < 0 || doubled > 10 {
+		return errors.New("invalid rating")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		err = writeID3Stats(path, popmValues[int(doubled)], playCount)
+	case ".flac":
+		err = writeFLACStats(path, int(doubled)*10, playCount)
+	case ".ogg":
+		err = writeOggStats(path, int(doubled)*10, playCount)
+	default:
+		return ErrTagsUnsupported
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(path, info.ModTime(), info.ModTime())
+}
+
+func readSynchsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+func putSynchsafe(b []byte, n int) {
+	b[0] = byte(n >> 21 & 0x7f)
+	b[1] = byte(n >> 14 & 0x7f)
+	b[2] = byte(n >> 7 & 0x7f)
+	b[3] = byte(n & 0x7f)
+}
+
+// writeID3Stats replaces LiteSound's POPM frame and the PCNT frame of an
+// MP3's ID3v2 tag, adding a tag when there is none. The tag is rewritten in
+// place when it fits in the old one's padding.
+func writeID3Stats(path string, popm byte, playCount int) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return err
+	}
+	version := byte(3)
+	oldSize := 0
+	var body []byte
+	if string(header[:3]) == "ID3" {
+		version = header[3]
+		if version != 3 && version != 4 {
+			return errors.New("unsupported ID3 version")
+		}
+		if header[5]&0x10 != 0 {
+			return errors.New("unsupported ID3 tag")
+		}
+		oldSize = readSynchsafe(header[6:10])
+		body = make([]byte, oldSize)
+		if _, err := io.ReadFull(file, body); err != nil {
+			return err
+		}
+		// An unsynchronised 2.3 tag is undone as a whole and written back
+		// without it. In 2.4 each frame carries its own flag, so its frames
+		// are kept as they are.
+		if header[5]&0x80 != 0 && version == 3 {
+			body = bytes.ReplaceAll(body, []byte{0xff, 0}, []byte{0xff})
+		}
+		if header[5]&0x40 != 0 {
+			if len(body) < 4 {
+				return errors.New("malformed ID3 tag")
+			}
+			skip := int(binary.BigEndian.Uint32(body[:4])) + 4
+			if version == 4 {
+				skip = readSynchsafe(body[:4])
+			}
+			if skip > len(body) {
+				return errors.New("malformed ID3 tag")
+			}
+			body = body[skip:]
+		}
+	}
+
+	frames := make([]byte, 0, len(body)+64)
+	for offset := 0; offset+10 <= len(body) && body[offset] != 0; {
+		size := int(binary.BigEndian.Uint32(body[offset+4 : offset+8]))
+		if version == 4 {
+			size = readSynchsafe(body[offset+4 : offset+8])
+		}
+		end := offset + 10 + size
+		if size < 0 || end > len(body) {
+			return errors.New("malformed ID3 tag")
+		}
+		id := string(body[offset : offset+4])
+		data := body[offset+10 : end]
+		own := id == "POPM" && body[offset+9] == 0 && bytes.HasPrefix(data, []byte(popmEmail+"\x00"))
+		if id != "PCNT" && !own {
+			frames = append(frames, body[offset:end]...)
+		}
+		offset = end
+	}
+	appendFrame := func(id string, data []byte) {
+		frameHeader := make([]byte, 10)
+		copy(frameHeader, id)
+		if version == 4 {
+			putSynchsafe(frameHeader[4:8], len(data))
+		} else {
+			binary.BigEndian.PutUint32(frameHeader[4:8], uint32(len(data)))
+		}
+		frames = append(frames, frameHeader...)
+		frames = append(frames, data...)
+	}
+	if popm != 0 || playCount > 0 {
+		data := append([]byte(popmEmail+"\x00"), popm)
+		appendFrame("POPM", append(data, writeCounter(playCount)...))
+	}
+	if playCount > 0 {
+		appendFrame("PCNT", writeCounter(playCount))
+	}
+
+	tagHeader := []byte{'I', 'D', '3', version, 0, header[5] &^ 0xc0, 0, 0, 0, 0}
+	if oldSize == 0 {
+		tagHeader[5] = 0
+	}
+	if len(frames) <= oldSize {
+		putSynchsafe(tagHeader[6:10], oldSize)
+		tag := append(tagHeader, frames...)
+		tag = append(tag, make([]byte, oldSize-len(frames))...)
+		_, err := file.WriteAt(tag, 0)
+		return err
+	}
+	size := len(frames) + 1024
+	putSynchsafe(tagHeader[6:10], size)
+	tag := append(tagHeader, frames...)
+	tag = append(tag, make([]byte, size-len(frames))...)
+	audioStart := int64(0)
+	if oldSize > 0 {
+		audioStart = int64(10 + oldSize)
+	}
+	return replaceFileHead(path, file, tag, audioStart)
+}
+
+type flacBlock struct {
+	kind byte
+	data []byte
+}
+
+// writeFLACStats replaces the RATING and PLAYCOUNT comments of a FLAC
+// file's Vorbis comment block. The metadata is rewritten in place when it
+// fits, growing or shrinking the padding.
+func writeFLACStats(path string, rating int, playCount int) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return err
+	}
+	if string(magic) != "fLaC" {
+		return errors.New("unsupported FLAC file")
+	}
+	blocks := make([]flacBlock, 0)
+	audioStart := int64(4)
+	for {
+		blockHeader := make([]byte, 4)
+		if _, err := io.ReadFull(file, blockHeader); err != nil {
+			return err
+		}
+		size := int(blockHeader[1])<<16 | int(blockHeader[2])<<8 | int(blockHeader[3])
+		data := make([]byte, size)
+		if _, err := io.ReadFull(file, data); err != nil {
+			return err
+		}
+		audioStart += int64(4 + size)
+		if kind := blockHeader[0] & 0x7f; kind != 1 {
+			blocks = append(blocks, flacBlock{kind: kind, data: data})
+		}
+		if blockHeader[0]&0x80 != 0 {
+			break
+		}
+	}
+	if len(blocks) == 0 || blocks[0].kind != 0 {
+		return errors.New("malformed FLAC file")
+	}
+
+	var comments []string
+	commentIndex := -1
+	vendor := []byte(popmEmail)
+	for i, block := range blocks {
+		if block.kind != 4 {
+			continue
+		}
+		commentIndex = i
+		if vendor, comments, _, err = readVorbisComments(block.data); err != nil {
+			return err
+		}
+		break
+	}
+	block := flacBlock{kind: 4, data: encodeVorbisComments(vendor, setStatsComments(comments, rating, playCount))}
+	if commentIndex >= 0 {
+		blocks[commentIndex] = block
+	} else {
+		blocks = append(blocks[:1], append([]flacBlock{block}, blocks[1:]...)...)
+	}
+
+	size := int64(4)
+	for _, block := range blocks {
+		if len(block.data) >= 1<<24 {
+			return errors.New("FLAC metadata block too large")
+		}
+		size += int64(4 + len(block.data))
+	}
+	inPlace := true
+	switch {
+	case size == audioStart:
+	case size+4 <= audioStart && audioStart-size-4 < 1<<24:
+		blocks = append(blocks, flacBlock{kind: 1, data: make([]byte, audioStart-size-4)})
+	default:
+		blocks = append(blocks, flacBlock{kind: 1, data: make([]byte, 4096)})
+		inPlace = false
+	}
+	head := []byte("fLaC")
+	for i, block := range blocks {
+		kind := block.kind
+		if i == len(blocks)-1 {
+			kind |= 0x80
+		}
+		length := len(block.data)
+		head = append(head, kind, byte(length>>16), byte(length>>8), byte(length))
+		head = append(head, block.data...)
+	}
+	if inPlace {
+		_, err := file.WriteAt(head, 0)
+		return err
+	}
+	return replaceFileHead(path, file, head, audioStart)
+}
+
+// readVorbisComments splits a Vorbis comment block, after any packet
+// signature, into the vendor string, the comments and the bytes that follow
+// them.
+func readVorbisComments(data []byte) ([]byte, []string, []byte, error) {
+	read := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		size := int(binary.LittleEndian.Uint32(data[:4]))
+		if size < 0 || 4+size > len(data) {
+			return nil, false
+		}
+		value := data[4 : 4+size]
+		data = data[4+size:]
+		return value, true
+	}
+	vendor, ok := read()
+	if !ok || len(data) < 4 {
+		return nil, nil, nil, errors.New("malformed Vorbis comments")
+	}
+	count := int(binary.LittleEndian.Uint32(data[:4]))
+	data = data[4:]
+	comments := make([]string, 0)
+	for n := 0; n < count; n++ {
+		comment, ok := read()
+		if !ok {
+			return nil, nil, nil, errors.New("malformed Vorbis comments")
+		}
+		comments = append(comments, string(comment))
+	}
+	return vendor, comments, data, nil
+}
+
+// setStatsComments replaces the RATING and PLAYCOUNT comments. rating is
+// 0-100; zero values drop the comment.
+func setStatsComments(comments []string, rating int, playCount int) []string {
+	kept := make([]string, 0, len(comments)+2)
+	for _, comment := range comments {
+		key, _, _ := strings.Cut(comment, "=")
+		if !strings.EqualFold(key, "RATING") && !strings.EqualFold(key, "PLAYCOUNT") {
+			kept = append(kept, comment)
+		}
+	}
+	if rating > 0 {
+		kept = append(kept, "RATING="+strconv.Itoa(rating))
+	}
+	if playCount > 0 {
+		kept = append(kept, "PLAYCOUNT="+strconv.Itoa(playCount))
+	}
+	return kept
+}
+
+func encodeVorbisComments(vendor []byte, comments []string) []byte {
+	var encoded bytes.Buffer
+	_ = binary.Write(&encoded, binary.LittleEndian, uint32(len(vendor)))
+	encoded.Write(vendor)
+	_ = binary.Write(&encoded, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		_ = binary.Write(&encoded, binary.LittleEndian, uint32(len(comment)))
+		encoded.WriteString(comment)
+	}
+	return encoded.Bytes()
+}
+
+// oggCRCTable drives the Ogg page checksum, a CRC-32 with polynomial
+// 0x04c11db7 that is neither reflected nor inverted.
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// setOggChecksum stores the checksum of a whole page in its header.
+func setOggChecksum(page []byte) {
+	binary.LittleEndian.PutUint32(page[22:26], 0)
+	crc := uint32(0)
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	binary.LittleEndian.PutUint32(page[22:26], crc)
+}
+
+// peekOggPage returns the next whole page buffered in r without consuming
+// it, or false when r does not continue with one.
+func peekOggPage(r *bufio.Reader) ([]byte, bool) {
+	header, err := r.Peek(27)
+	if err != nil || string(header[:4]) != "OggS" {
+		return nil, false
+	}
+	headerSize := 27 + int(header[26])
+	segments, err := r.Peek(headerSize)
+	if err != nil {
+		return nil, false
+	}
+	size := headerSize
+	for _, segment := range segments[27:] {
+		size += int(segment)
+	}
+	page, err := r.Peek(size)
+	if err != nil {
+		return nil, false
+	}
+	return page, true
+}
+
+// maxOggPage is the largest possible Ogg page: a 27-byte header, 255
+// segment sizes and 255 segments of 255 bytes.
+const maxOggPage = 27 + 255 + 255*255
+
+// writeOggStats replaces the RATING and PLAYCOUNT comments of an Ogg Vorbis
+// or Opus file. The header pages are laid out again; when their number
+// changes, the stream's later pages are renumbered and the file rewritten.
+// Files holding several interleaved streams are not changed.
+func writeOggStats(path string, rating int, playCount int) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(file, maxOggPage)
+	var serial uint32
+	var eos byte
+	packets := make([][]byte, 0, 3)
+	var partial []byte
+	open := false
+	headerPackets := 0
+	commentPrefix := ""
+	pages := uint32(0)
+	headerEnd := int64(0)
+	for headerPackets == 0 || len(packets) < headerPackets || open {
+		page, ok := peekOggPage(reader)
+		if !ok {
+			return errors.New("malformed Ogg file")
+		}
+		pageSerial := binary.LittleEndian.Uint32(page[14:18])
+		if pages == 0 {
+			if page[5]&0x02 == 0 {
+				return errors.New("malformed Ogg file")
+			}
+			serial = pageSerial
+		} else if pageSerial != serial {
+			return errors.New("unsupported Ogg file")
+		}
+		if (page[5]&0x01 != 0) != open {
+			return errors.New("malformed Ogg file")
+		}
+		eos = page[5] & 0x04
+		segments := page[27 : 27+int(page[26])]
+		data := page[27+len(segments):]
+		for _, size := range segments {
+			partial = append(partial, data[:size]...)
+			data = data[size:]
+			open = size == 255
+			if !open {
+				packets = append(packets, partial)
+				partial = nil
+			}
+		}
+		pages++
+		headerEnd += int64(len(page))
+		_, _ = reader.Discard(len(page))
+		if headerPackets == 0 && len(packets) > 0 {
+			switch {
+			case bytes.HasPrefix(packets[0], []byte("\x01vorbis")):
+				headerPackets, commentPrefix = 3, "\x03vorbis"
+			case bytes.HasPrefix(packets[0], []byte("OpusHead")):
+				headerPackets, commentPrefix = 2, "OpusTags"
+			default:
+				return ErrTagsUnsupported
+			}
+		}
+	}
+	if len(packets) != headerPackets || !bytes.HasPrefix(packets[1], []byte(commentPrefix)) {
+		return errors.New("malformed Ogg file")
+	}
+	vendor, comments, rest, err := readVorbisComments(packets[1][len(commentPrefix):])
+	if err != nil {
+		return err
+	}
+	if commentPrefix == "\x03vorbis" && len(rest) == 0 {
+		// The Vorbis comment header ends with a framing bit.
+		rest = []byte{1}
+	}
+	comment := append([]byte(commentPrefix), encodeVorbisComments(vendor, setStatsComments(comments, rating, playCount))...)
+	packets[1] = append(comment, rest...)
+
+	// The identification header goes alone on the first page and the other
+	// headers end on a page of their own, as both codecs require.
+	head := make([]byte, 0, headerEnd+256)
+	sequence := uint32(0)
+	lastPage := 0
+	for i, group := range [][][]byte{packets[:1], packets[1:]} {
+		flags := byte(0)
+		if i == 0 {
+			flags = 0x02
+		}
+		granule := ^uint64(0)
+		var segments, data []byte
+		flush := func() {
+			lastPage = len(head)
+			head = append(head, "OggS\x00"...)
+			head = append(head, flags)
+			head = binary.LittleEndian.AppendUint64(head, granule)
+			head = binary.LittleEndian.AppendUint32(head, serial)
+			head = binary.LittleEndian.AppendUint32(head, sequence)
+			head = append(head, 0, 0, 0, 0, byte(len(segments)))
+			head = append(head, segments...)
+			head = append(head, data...)
+			setOggChecksum(head[lastPage:])
+			sequence++
+			flags, granule = 0, ^uint64(0)
+			segments, data = nil, nil
+		}
+		for _, packet := range group {
+			for offset := 0; ; offset += 255 {
+				size := min(len(packet)-offset, 255)
+				segments = append(segments, byte(size))
+				data = append(data, packet[offset:offset+size]...)
+				if size < 255 {
+					// Header pages that end a packet are at granule 0.
+					granule = 0
+				}
+				if len(segments) == 255 {
+					flush()
+					if size == 255 {
+						flags = 0x01
+					}
+				}
+				if size < 255 {
+					break
+				}
+			}
+		}
+		if len(segments) > 0 {
+			flush()
+		}
+	}
+	if eos != 0 {
+		head[lastPage+5] |= eos
+		setOggChecksum(head[lastPage:])
+	}
+
+	delta := sequence - pages
+	switch {
+	case delta == 0 && int64(len(head)) == headerEnd:
+		_, err := file.WriteAt(head, 0)
+		return err
+	case delta == 0:
+		return replaceFileHead(path, file, head, headerEnd)
+	}
+	return rewriteFile(path, file, func(w io.Writer) error {
+		if _, err := w.Write(head); err != nil {
+			return err
+		}
+		return copyOggPages(w, io.NewSectionReader(file, headerEnd, info.Size()-headerEnd), serial, delta)
+	})
+}
+
+// copyOggPages copies r to w, moving the sequence numbers of the pages of
+// stream serial on by delta. Whatever follows the last whole page is copied
+// unchanged.
+func copyOggPages(w io.Writer, r io.Reader, serial uint32, delta uint32) error {
+	reader := bufio.NewReaderSize(r, maxOggPage)
+	for {
+		page, ok := peekOggPage(reader)
+		if !ok {
+			_, err := io.Copy(w, reader)
+			return err
+		}
+		if binary.LittleEndian.Uint32(page[14:18]) == serial {
+			binary.LittleEndian.PutUint32(page[18:22], binary.LittleEndian.Uint32(page[18:22])+delta)
+			setOggChecksum(page)
+		}
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+		_, _ = reader.Discard(len(page))
+	}
+}
+
+// replaceFileHead rewrites path as head followed by the contents of file
+// from audioStart. file is closed.
+func replaceFileHead(path string, file *os.File, head []byte, audioStart int64) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return rewriteFile(path, file, func(w io.Writer) error {
+		if _, err := w.Write(head); err != nil {
+			return err
+		}
+		_, err := io.Copy(w, io.NewSectionReader(file, audioStart, info.Size()-audioStart))
+		return err
+	})
+}
+
+// rewriteFile replaces path with what write produces, through a temporary
+// file renamed over it. file is the open original and is closed.
+func rewriteFile(path string, file *os.File, write func(w io.Writer) error) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+	defer os.Remove(tempPath)
+	if err := write(temp); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
@@ -0,0 +1,331 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAudio stands in for the audio after the tags. It holds 0xFF bytes so
+// that unsynchronisation would show if it leaked into the audio.
+var testAudio = bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x00, 0xFF, 0x00, 0x12, 0x34}, 512)
+
+func id3Frame(version byte, id string, flags byte, data []byte) []byte {
+	frame := []byte(id)
+	if version == 4 {
+		size := make([]byte, 4)
+		putSynchsafe(size, len(data))
+		frame = append(frame, size...)
+	} else {
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(data)))
+	}
+	frame = append(frame, 0, flags)
+	return append(frame, data...)
+}
+
+func id3Fixture(version byte, flags byte, body []byte, padding int) []byte {
+	tag := []byte{'I', 'D', '3', version, 0, flags, 0, 0, 0, 0}
+	putSynchsafe(tag[6:], len(body)+padding)
+	tag = append(tag, body...)
+	tag = append(tag, make([]byte, padding)...)
+	return append(tag, testAudio...)
+}
+
+// unsynchronise inserts a zero after every 0xFF, as ID3 unsynchronisation
+// does.
+func unsynchronise(data []byte) []byte {
+	return bytes.ReplaceAll(data, []byte{0xff}, []byte{0xff, 0})
+}
+
+// id3Audio returns what follows the file's ID3v2 tag.
+func id3Audio(t *testing.T, data []byte) []byte {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("ID3")) {
+		return data
+	}
+	return data[10+readSynchsafe(data[6:10]):]
+}
+
+func flacTagsFixture(blocks ...flacBlock) []byte {
+	data := []byte("fLaC")
+	for i, block := range blocks {
+		kind := block.kind
+		if i == len(blocks)-1 {
+			kind |= 0x80
+		}
+		length := len(block.data)
+		data = append(data, kind, byte(length>>16), byte(length>>8), byte(length))
+		data = append(data, block.data...)
+	}
+	return append(data, testAudio...)
+}
+
+// streamInfo is a STREAMINFO block for 90 seconds at 44.1 kHz.
+var streamInfo = flacBlock{kind: 0, data: flacFixture(44100, 44100*90)[8:]}
+
+func flacAudio(t *testing.T, data []byte) []byte {
+	t.Helper()
+	offset := 4
+	for {
+		if offset+4 > len(data) {
+			t.Fatalf("FLAC metadata runs past the end of the file")
+		}
+		last := data[offset]&0x80 != 0
+		offset += 4 + (int(data[offset+1])<<16 | int(data[offset+2])<<8 | int(data[offset+3]))
+		if last {
+			return data[offset:]
+		}
+	}
+}
+
+// oggTestPage builds a page holding packets, the last of which may continue
+// on the next page when open is set.
+func oggTestPage(flags byte, granule uint64, serial uint32, sequence uint32, open bool, packets ...[]byte) []byte {
+	var segments, data []byte
+	for i, packet := range packets {
+		for len(packet) >= 255 {
+			segments = append(segments, 255)
+			data = append(data, packet[:255]...)
+			packet = packet[255:]
+		}
+		data = append(data, packet...)
+		if len(packet) > 0 || !open || i < len(packets)-1 {
+			segments = append(segments, byte(len(packet)))
+		}
+	}
+	page := []byte("OggS\x00")
+	page = append(page, flags)
+	page = binary.LittleEndian.AppendUint64(page, granule)
+	page = binary.LittleEndian.AppendUint32(page, serial)
+	page = binary.LittleEndian.AppendUint32(page, sequence)
+	page = append(page, 0, 0, 0, 0, byte(len(segments)))
+	page = append(page, segments...)
+	page = append(page, data...)
+	setOggChecksum(page)
+	return page
+}
+
+func vorbisComment(prefix string, comments ...string) []byte {
+	packet := append([]byte(prefix), encodeVorbisComments([]byte("test encoder"), comments)...)
+	if prefix == "\x03vorbis" {
+		packet = append(packet, 1)
+	}
+	return packet
+}
+
+// oggAudioPages follows the header pages of the Ogg fixtures: three audio
+// packets of 100 samples each, the last page ending the stream.
+func oggAudioPages(sequence uint32) []byte {
+	var data []byte
+	for i := range 3 {
+		flags := byte(0)
+		if i == 2 {
+			flags = 0x04
+		}
+		packet := append([]byte{byte(i)}, testAudio[:300]...)
+		data = append(data, oggTestPage(flags, uint64(i+1)*44100*100, 7, sequence+uint32(i), false, packet)...)
+	}
+	return data
+}
+
+// oggVorbisFixture lays out the headers on as few pages as they fit,
+// splitting a comment header too long for one page across two.
+func oggVorbisFixture(comment []byte) []byte {
+	data := oggTestPage(0x02, 0, 7, 0, false, vorbisFixture(44100, 0)[28:58])
+	setup := []byte("\x05vorbis setup")
+	if len(comment) < 255*255 {
+		data = append(data, oggTestPage(0, 0, 7, 1, false, comment, setup)...)
+		return append(data, oggAudioPages(2)...)
+	}
+	data = append(data, oggTestPage(0, ^uint64(0), 7, 1, true, comment[:255*255])...)
+	data = append(data, oggTestPage(0x01, 0, 7, 2, false, comment[255*255:], setup)...)
+	return append(data, oggAudioPages(3)...)
+}
+
+func oggOpusFixture(comment []byte) []byte {
+	data := oggTestPage(0x02, 0, 7, 0, false, opusFixture(312, 0)[28:47])
+	data = append(data, oggTestPage(0, 0, 7, 1, false, comment)...)
+	return append(data, oggAudioPages(2)...)
+}
+
+// oggAudio checks that every page has a good checksum and that each
+// stream's pages are numbered without gaps, and returns the pages after the
+// headers with their sequence numbers and checksums cleared.
+func oggAudio(t *testing.T, data []byte) []byte {
+	t.Helper()
+	next := make(map[uint32]uint32)
+	var audio []byte
+	for offset := 0; offset < len(data); {
+		if !bytes.HasPrefix(data[offset:], []byte("OggS")) || offset+27 > len(data) {
+			t.Fatalf("no Ogg page at offset %d", offset)
+		}
+		size := 27 + int(data[offset+26])
+		for _, segment := range data[offset+27 : offset+size] {
+			size += int(segment)
+		}
+		page := bytes.Clone(data[offset : offset+size])
+		offset += size
+		checksum := binary.LittleEndian.Uint32(page[22:26])
+		setOggChecksum(page)
+		if binary.LittleEndian.Uint32(page[22:26]) != checksum {
+			t.Fatalf("page at offset %d has a bad checksum", offset-size)
+		}
+		serial := binary.LittleEndian.Uint32(page[14:18])
+		if sequence := binary.LittleEndian.Uint32(page[18:22]); sequence != next[serial] {
+			t.Fatalf("page %d of stream %d is numbered %d", next[serial], serial, sequence)
+		}
+		next[serial]++
+		if granule := binary.LittleEndian.Uint64(page[6:14]); granule != 0 && granule != ^uint64(0) {
+			clear(page[18:26])
+			audio = append(audio, page...)
+		}
+	}
+	return audio
+}
+
+func TestWriteRatingTags(t *testing.T) {
+	title := id3Frame(3, "TIT2", 0, []byte("\x00Title"))
+	title4 := id3Frame(4, "TIT2", 0, []byte("\x03Title"))
+	private := id3Frame(3, "PRIV", 0, []byte("owner\x00\xff\xe0\xff"))
+	private4 := id3Frame(4, "PRIV", 0x02, unsynchronise([]byte("owner\x00\xff\xe0\xff")))
+	otherPOPM := id3Frame(3, "POPM", 0, []byte("other@example.com\x00\xc4\x00\x00\x00\x09"))
+	ownPOPM := id3Frame(3, "POPM", 0, []byte("LiteSound\x00\x40\x00\x00\x00\x02"))
+	count := id3Frame(3, "PCNT", 0, []byte{0, 0, 0, 2})
+	extended3 := []byte{0, 0, 0, 6, 0, 0, 0, 0, 0, 0}
+	extended4 := []byte{0, 0, 0, 6, 1, 0}
+	flacComments := flacBlock{kind: 4, data: encodeVorbisComments([]byte("test encoder"), []string{"TITLE=Title", "rating=20"})}
+
+	// A comment packet that, with the setup header, fills the second page,
+	// so the new comments need another one.
+	padded := len(vorbisComment("\x03vorbis", "TITLE=Title", "DESCRIPTION="))
+	longComment := vorbisComment("\x03vorbis", "TITLE=Title", "DESCRIPTION="+strings.Repeat("x", 254*255-10-padded))
+
+	tests := []struct {
+		name  string
+		file  string
+		data  []byte
+		audio func(*testing.T, []byte) []byte
+		title string
+		// inPlace is set when the tags fit where the old ones were.
+		inPlace bool
+		// keep is a frame that must survive the rewrite.
+		keep []byte
+		// keptRating and keptPlays are read from other players' tags.
+		keptRating float64
+		keptPlays  int
+	}{
+		{name: "mp3 without a tag", file: "a.mp3", data: testAudio, audio: id3Audio},
+		{name: "mp3 id3v2.3 with padding", file: "a.mp3", data: id3Fixture(3, 0, title, 256), audio: id3Audio, title: "Title", inPlace: true},
+		{name: "mp3 id3v2.4 that must grow", file: "a.mp3", data: id3Fixture(4, 0, title4, 0), audio: id3Audio, title: "Title"},
+		{name: "mp3 replaces its own frames and keeps others", file: "a.mp3", data: id3Fixture(3, 0, bytes.Join([][]byte{title, otherPOPM, ownPOPM, count}, nil), 0), audio: id3Audio, title: "Title", inPlace: true, keep: otherPOPM, keptRating: 4, keptPlays: 9},
+		{name: "mp3 id3v2.3 extended header", file: "a.mp3", data: id3Fixture(3, 0x40, append(extended3, title...), 64), audio: id3Audio, title: "Title", inPlace: true},
+		{name: "mp3 id3v2.4 extended header", file: "a.mp3", data: id3Fixture(4, 0x40, append(extended4, title4...), 64), audio: id3Audio, title: "Title", inPlace: true},
+		{name: "mp3 unsynchronised id3v2.3 tag", file: "a.mp3", data: id3Fixture(3, 0x80, unsynchronise(append(bytes.Clone(title), private...)), 64), audio: id3Audio, title: "Title", inPlace: true, keep: private},
+		{name: "mp3 unsynchronised id3v2.4 frames", file: "a.mp3", data: id3Fixture(4, 0x80, append(bytes.Clone(title4), private4...), 64), audio: id3Audio, title: "Title", inPlace: true, keep: private4},
+
+		{name: "flac without comments", file: "a.flac", data: flacTagsFixture(streamInfo), audio: flacAudio},
+		{name: "flac with padding", file: "a.flac", data: flacTagsFixture(streamInfo, flacComments, flacBlock{kind: 1, data: make([]byte, 128)}), audio: flacAudio, title: "Title", inPlace: true},
+		{name: "flac without padding", file: "a.flac", data: flacTagsFixture(streamInfo, flacComments), audio: flacAudio, title: "Title"},
+
+		{name: "ogg vorbis", file: "a.ogg", data: oggVorbisFixture(vorbisComment("\x03vorbis", "TITLE=Title")), audio: oggAudio, title: "Title"},
+		{name: "ogg vorbis headers that need another page", file: "a.ogg", data: oggVorbisFixture(longComment), audio: oggAudio, title: "Title"},
+		{name: "ogg vorbis comments across pages", file: "a.ogg", data: oggVorbisFixture(vorbisComment("\x03vorbis", "TITLE=Title", "DESCRIPTION="+strings.Repeat("x", 70000))), audio: oggAudio, title: "Title"},
+		{name: "ogg opus", file: "a.ogg", data: oggOpusFixture(vorbisComment("OpusTags", "TITLE=Title")), audio: oggAudio, title: "Title"},
+	}
+	dir := t.TempDir()
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(rune('a'+i))+test.file)
+			if err := os.WriteFile(path, test.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, modified, modified); err != nil {
+				t.Fatal(err)
+			}
+			want := test.audio(t, test.data)
+			for _, stats := range []struct {
+				rating    float64
+				playCount int
+			}{{3.5, 7}, {5, 300}, {0, 0}} {
+				if err := WriteRatingTags(path, stats.rating, stats.playCount); err != nil {
+					t.Fatalf("WriteRatingTags(%v, %v) error = %v", stats.rating, stats.playCount, err)
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(test.audio(t, data), want) {
+					t.Fatalf("WriteRatingTags(%v, %v) changed the audio", stats.rating, stats.playCount)
+				}
+				if test.inPlace && stats.rating != 0 && len(data) != len(test.data) {
+					t.Errorf("file grew from %d to %d bytes, want the tags rewritten in place", len(test.data), len(data))
+				}
+				if test.keep != nil && !bytes.Contains(data, test.keep) {
+					t.Errorf("WriteRatingTags(%v, %v) dropped frame %q", stats.rating, stats.playCount, test.keep[:4])
+				}
+				metadata := ReadTrackMetadata(path)
+				if metadata.Title != test.title {
+					t.Errorf("title = %q, want %q", metadata.Title, test.title)
+				}
+				wantRating, wantPlays := stats.rating, max(stats.playCount, test.keptPlays)
+				if wantRating == 0 {
+					wantRating = test.keptRating
+				}
+				if metadata.Rating != wantRating || metadata.PlayCount != wantPlays {
+					t.Errorf("read back %v stars and %d plays, want %v and %d", metadata.Rating, metadata.PlayCount, wantRating, wantPlays)
+				}
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(modified) {
+				t.Errorf("modification time = %v, want %v", info.ModTime(), modified)
+			}
+		})
+	}
+}
+
+func TestWriteRatingTagsLeavesOtherFilesAlone(t *testing.T) {
+	interleaved := oggTestPage(0x02, 0, 7, 0, false, vorbisFixture(44100, 0)[28:58])
+	interleaved = append(interleaved, oggTestPage(0x02, 0, 8, 0, false, []byte("\x80theora"))...)
+	interleaved = append(interleaved, oggVorbisFixture(vorbisComment("\x03vorbis"))[len(interleaved)/2:]...)
+	footer := id3Fixture(4, 0x10, id3Frame(4, "TIT2", 0, []byte("\x03Title")), 0)
+
+	tests := []struct {
+		name string
+		file string
+		data []byte
+		err  error
+	}{
+		{"wav", "a.wav", wavFixture(16, 176400, 176400), ErrTagsUnsupported},
+		{"ogg flac", "a.ogg", oggTestPage(0x02, 0, 7, 0, false, []byte("\x7fFLAC")), ErrTagsUnsupported},
+		{"ogg with interleaved streams", "a.ogg", interleaved, nil},
+		{"ogg truncated in the headers", "a.ogg", oggVorbisFixture(vorbisComment("\x03vorbis"))[:100], nil},
+		{"mp3 id3v2.4 footer", "a.mp3", footer, nil},
+		{"mp3 truncated in the tag", "a.mp3", id3Fixture(3, 0, id3Frame(3, "TIT2", 0, []byte("\x00Title")), 0)[:20], nil},
+		{"flac truncated in the metadata", "a.flac", flacTagsFixture(streamInfo)[:20], nil},
+	}
+	dir := t.TempDir()
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(rune('a'+i))+test.file)
+			if err := os.WriteFile(path, test.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err := WriteRatingTags(path, 4, 2)
+			if err == nil || (test.err != nil && !errors.Is(err, test.err)) {
+				t.Errorf("WriteRatingTags() error = %v, want %v", err, test.err)
+			}
+			if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, test.data) {
+				t.Errorf("WriteRatingTags() changed the file")
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package playlistfmt
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns lists the header names accepted for each field, lowercased.
+// They cover Exportify, TuneMyMusic and Soundiiz exports.
+var csvColumns = map[string][]string{
+	"title":    {"track name", "title", "name", "song", "track"},
+	"artist":   {"artist name(s)", "artist name", "artist", "artists"},
+	"album":    {"album name", "album", "release"},
+	"duration": {"duration (ms)", "duration_ms", "track duration (ms)", "duration", "length"},
+	"isrc":     {"isrc", "track isrc"},
+}
+
+// ReadCSV parses a track list exported from a streaming service. Columns are
+// found by their header, so exports with extra or reordered columns work.
+// Durations are read as milliseconds when the header says so or the value
+// is large, as m:ss when it contains a colon, and as seconds otherwise.
+// Entries have no Location.
+func ReadCSV(r io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := decodeText(data)
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if strings.Count(firstLine(text), ";") > strings.Count(firstLine(text), ",") {
+		reader.Comma = ';'
+	}
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return []Entry{}, nil
+		}
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for field, names := range csvColumns {
+		columns[field] = -1
+		for _, name := range names {
+			if index := headerIndex(header, name); index >= 0 {
+				columns[field] = index
+				break
+			}
+		}
+	}
+	if columns["title"] < 0 {
+		return nil, errors.New("csv has no track name column")
+	}
+	durationInMs := columns["duration"] >= 0 && strings.Contains(strings.ToLower(header[columns["duration"]]), "ms")
+
+	entries := make([]Entry, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			index := columns[name]
+			if index < 0 || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+		entry := Entry{
+			Line:     line,
+			Title:    field("title"),
+			Creator:  field("artist"),
+			Album:    field("album"),
+			Duration: parseCSVDuration(field("duration"), durationInMs),
+			ISRC:     strings.ToUpper(field("isrc")),
+		}
+		if entry.Title == "" && entry.ISRC == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func headerIndex(header []string, name string) int {
+	for i, column := range header {
+		if strings.EqualFold(strings.TrimSpace(column), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func firstLine(text string) string {
+	if end := strings.IndexAny(text, "\r\n"); end >= 0 {
+		return text[:end]
+	}
+	return text
+}
+
+func parseCSVDuration(value string, inMs bool) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if strings.Contains(value, ":") {
+		var total time.Duration
+		for _, part := range strings.Split(value, ":") {
+			number, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || number < 0 {
+				return 0
+			}
+			total = total*60 + time.Duration(number)
+		}
+		return total * time.Second
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0
+	}
+	if inMs || number > 10000 {
+		return time.Duration(number) * time.Millisecond
+	}
+	return time.Duration(number * float64(time.Second))
+}
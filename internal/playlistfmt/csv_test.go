@@ -0,0 +1,124 @@
+package playlistfmt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Entry
+		wantErr bool
+	}{
+		{
+			name:  "empty file",
+			input: "",
+			want:  []Entry{},
+		},
+		{
+			name:  "header only",
+			input: "Track Name,Artist Name(s)\n",
+			want:  []Entry{},
+		},
+		{
+			name: "exportify",
+			input: "Track URI,Track Name,Artist Name(s),Album Name,Duration (ms),ISRC\n" +
+				"spotify:track:1,Song A,Artist A,Album A,215000,usabc1234567\n",
+			want: []Entry{{Line: 2, Title: "Song A", Creator: "Artist A", Album: "Album A", Duration: 215 * time.Second, ISRC: "USABC1234567"}},
+		},
+		{
+			name:  "reordered columns, byte order mark and semicolons",
+			input: "\xEF\xBB\xBFArtist;Title;Length\nArtist B;Song B;3:05\n",
+			want:  []Entry{{Line: 2, Title: "Song B", Creator: "Artist B", Duration: 185 * time.Second}},
+		},
+		{
+			name:  "header with padding and mixed case",
+			input: "  TITLE , artist \nSong C,Artist C\n",
+			want:  []Entry{{Line: 2, Title: "Song C", Creator: "Artist C"}},
+		},
+		{
+			name:    "no title column",
+			input:   "Artist,Album\nArtist D,Album D\n",
+			wantErr: true,
+		},
+		{
+			name:    "header is not csv",
+			input:   "\x00\x01\x02\n",
+			wantErr: true,
+		},
+		{
+			name:  "short and blank rows",
+			input: "Title,Artist,Album\nSong E\n,,\nSong F,Artist F,Album F,extra\n",
+			want: []Entry{
+				{Line: 2, Title: "Song E"},
+				{Line: 4, Title: "Song F", Creator: "Artist F", Album: "Album F"},
+			},
+		},
+		{
+			name:  "truncated inside a quoted field",
+			input: "Title,Artist\n\"Song G\",\"Artist",
+			want:  []Entry{{Line: 2, Title: "Song G", Creator: "Artist"}},
+		},
+		{
+			name:  "truncated after a separator",
+			input: "Title,Artist,Duration\nSong H,Artist H,",
+			want:  []Entry{{Line: 2, Title: "Song H", Creator: "Artist H"}},
+		},
+		{
+			name:  "invalid durations",
+			input: "Title,Duration\nSong I,abc\nSong J,-1:00\nSong K,-5\n",
+			want: []Entry{
+				{Line: 2, Title: "Song I"},
+				{Line: 3, Title: "Song J"},
+				{Line: 4, Title: "Song K"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadCSV(strings.NewReader(test.input))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("ReadCSV() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadCSV() error = %v", err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("ReadCSV() = %+v, want %+v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseCSVDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		inMs  bool
+		want  time.Duration
+	}{
+		{"", false, 0},
+		{"215000", true, 215 * time.Second},
+		{"215000", false, 215 * time.Second},
+		{"215", false, 215 * time.Second},
+		{"3:35", false, 215 * time.Second},
+		{"1:02:03", false, 3723 * time.Second},
+		{"3:x", false, 0},
+		{"-3", false, 0},
+	}
+	for _, test := range tests {
+		if got := parseCSVDuration(test.value, test.inMs); got != test.want {
+			t.Errorf("parseCSVDuration(%q, %v) = %v, want %v", test.value, test.inMs, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package playlistfmt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadM3U parses plain and extended M3U. #EXTINF supplies the duration and an
+// "Artist - Title" display name for the entry that follows it; other
+// directives and comments are ignored.
+func ReadM3U(r io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0)
+	var pending Entry
+	for i, line := range splitLines(decodeText(data)) {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if info, ok := strings.CutPrefix(line, "#EXTINF:"); ok {
+				pending = parseExtInf(info)
+			}
+			continue
+		}
+		pending.Line = i + 1
+		pending.Location = line
+		entries = append(entries, pending)
+		pending = Entry{}
+	}
+	return entries, nil
+}
+
+func parseExtInf(info string) Entry {
+	entry := Entry{}
+	durationPart, display, found := strings.Cut(info, ",")
+	if !found {
+		durationPart = info
+		display = ""
+	}
+	// Attributes such as tvg-id="…" may follow the duration.
+	if fields := strings.Fields(durationPart); len(fields) > 0 {
+		if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil && seconds > 0 {
+			entry.Duration = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	display = strings.TrimSpace(display)
+	if artist, title, ok := strings.Cut(display, " - "); ok {
+		entry.Creator = strings.TrimSpace(artist)
+		entry.Title = strings.TrimSpace(title)
+	} else {
+		entry.Title = display
+	}
+	return entry
+}
+
+// WriteM3U writes extended M3U encoded as UTF-8.
+func WriteM3U(w io.Writer, entries []Entry) error {
+	writer := bufio.NewWriter(w)
+	if _, err := writer.WriteString("#EXTM3U\n"); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		display := entry.Title
+		if entry.Creator != "" && display != "" {
+			display = entry.Creator + " - " + display
+		}
+		seconds := -1
+		if entry.Duration > 0 {
+			seconds = int(entry.Duration.Round(time.Second) / time.Second)
+		}
+		if display != "" || seconds > 0 {
+			if _, err := fmt.Fprintf(writer, "#EXTINF:%d,%s\n", seconds, display); err != nil {
+				return err
+			}
+		}
+		if _, err := writer.WriteString(entry.Location + "\n"); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,82 @@
+// Package playlistfmt reads and writes playlist files exchanged with other
+// players.
+package playlistfmt
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Entry is one track of a playlist file. Location is a path or URL as it
+// appears in the file, except that relative XSPF locations are
+// percent-decoded into paths; the remaining fields are whatever metadata the
+// format carries and may be empty.
+type Entry struct {
+	Line     int
+	Location string
+	Title    string
+	Creator  string
+	Album    string
+	Duration time.Duration
+	ISRC     string
+}
+
+// urlPattern matches locations that are URLs rather than paths. A scheme
+// needs at least two characters so Windows drive letters are paths, and
+// "://" so a relative path such as "Artist: Title.mp3" is not taken for one.
+var urlPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]+://`)
+
+// IsURL reports whether a playlist location is a URL: it has a scheme
+// followed by "://", or starts with "file:".
+func IsURL(location string) bool {
+	return urlPattern.MatchString(location) || (len(location) >= 5 && strings.EqualFold(location[:5], "file:"))
+}
+
+var ErrUnsupportedFormat = errors.New("unsupported playlist format")
+
+// Read parses a playlist, choosing the format from the file name's
+// extension.
+func Read(name string, r io.Reader) ([]Entry, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".m3u", ".m3u8":
+		return ReadM3U(r)
+	case ".xspf":
+		return ReadXSPF(r)
+	case ".pls":
+		return ReadPLS(r)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// Write writes a playlist, choosing the format from the file name's
+// extension. Title is only stored by formats that have a playlist title.
+func Write(name string, title string, w io.Writer, entries []Entry) error {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".m3u", ".m3u8":
+		return WriteM3U(w, entries)
+	case ".xspf":
+		return WriteXSPF(w, title, entries)
+	case ".pls":
+		return WritePLS(w, entries)
+	}
+	return ErrUnsupportedFormat
+}
+
+// UsesURLs reports whether the format stores locations as URLs rather than
+// plain paths.
+func UsesURLs(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".xspf")
+}
+
+// IsSupported reports whether Read and Write handle the file's extension.
+func IsSupported(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".m3u", ".m3u8", ".xspf", ".pls":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package playlistfmt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadPLS parses a PLS playlist. Entries are returned in the order of their
+// FileN numbers.
+func ReadPLS(r io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	byIndex := make(map[int]*Entry)
+	for i, line := range splitLines(decodeText(data)) {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		var field string
+		switch {
+		case strings.HasPrefix(key, "file"):
+			field = "file"
+		case strings.HasPrefix(key, "title"):
+			field = "title"
+		case strings.HasPrefix(key, "length"):
+			field = "length"
+		default:
+			continue
+		}
+		index, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			continue
+		}
+		entry, ok := byIndex[index]
+		if !ok {
+			entry = &Entry{}
+			byIndex[index] = entry
+		}
+		switch field {
+		case "file":
+			entry.Location = value
+			entry.Line = i + 1
+		case "title":
+			entry.Title = value
+		case "length":
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				entry.Duration = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	indexes := make([]int, 0, len(byIndex))
+	for index, entry := range byIndex {
+		if entry.Location != "" {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+	entries := make([]Entry, 0, len(indexes))
+	for _, index := range indexes {
+		entries = append(entries, *byIndex[index])
+	}
+	return entries, nil
+}
+
+// WritePLS writes a version 2 PLS playlist.
+func WritePLS(w io.Writer, entries []Entry) error {
+	writer := bufio.NewWriter(w)
+	if _, err := writer.WriteString("[playlist]\n"); err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		n := i + 1
+		if _, err := fmt.Fprintf(writer, "File%d=%s\n", n, entry.Location); err != nil {
+			return err
+		}
+		title := entry.Title
+		if entry.Creator != "" && title != "" {
+			title = entry.Creator + " - " + title
+		}
+		if title != "" {
+			if _, err := fmt.Fprintf(writer, "Title%d=%s\n", n, title); err != nil {
+				return err
+			}
+		}
+		seconds := -1
+		if entry.Duration > 0 {
+			seconds = int(entry.Duration.Round(time.Second) / time.Second)
+		}
+		if _, err := fmt.Fprintf(writer, "Length%d=%d\n", n, seconds); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(writer, "NumberOfEntries=%d\nVersion=2\n", len(entries)); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
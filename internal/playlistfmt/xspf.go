@@ -0,0 +1,90 @@
+package playlistfmt
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const xspfNamespace = "http://xspf.org/ns/0/"
+
+type xspfPlaylist struct {
+	XMLName   xml.Name    `xml:"playlist"`
+	Version   string      `xml:"version,attr"`
+	Namespace string      `xml:"xmlns,attr"`
+	Title     string      `xml:"title,omitempty"`
+	Tracks    []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Locations []string `xml:"location"`
+	Title     string   `xml:"title,omitempty"`
+	Creator   string   `xml:"creator,omitempty"`
+	Album     string   `xml:"album,omitempty"`
+	Duration  int64    `xml:"duration,omitempty"`
+}
+
+// ReadXSPF parses an XSPF playlist. Only the first location of each track is
+// used; tracks without one are kept so they can be matched by metadata.
+// Locations are URI references, so relative ones are percent-decoded.
+func ReadXSPF(r io.Reader) ([]Entry, error) {
+	var playlist xspfPlaylist
+	if err := xml.NewDecoder(r).Decode(&playlist); err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(playlist.Tracks))
+	for i, track := range playlist.Tracks {
+		entry := Entry{
+			Line:     i + 1,
+			Title:    strings.TrimSpace(track.Title),
+			Creator:  strings.TrimSpace(track.Creator),
+			Album:    strings.TrimSpace(track.Album),
+			Duration: time.Duration(track.Duration) * time.Millisecond,
+		}
+		if len(track.Locations) > 0 {
+			entry.Location = strings.TrimSpace(track.Locations[0])
+			if !IsURL(entry.Location) {
+				if decoded, err := url.PathUnescape(entry.Location); err == nil {
+					entry.Location = decoded
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// WriteXSPF writes an XSPF playlist. Locations are written as given, so
+// callers should pass URLs.
+func WriteXSPF(w io.Writer, title string, entries []Entry) error {
+	playlist := xspfPlaylist{
+		Version:   "1",
+		Namespace: xspfNamespace,
+		Title:     title,
+		Tracks:    make([]xspfTrack, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		track := xspfTrack{
+			Title:    entry.Title,
+			Creator:  entry.Creator,
+			Album:    entry.Album,
+			Duration: entry.Duration.Milliseconds(),
+		}
+		if entry.Location != "" {
+			track.Locations = []string{entry.Location}
+		}
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(playlist); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
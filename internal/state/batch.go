@@ -0,0 +1,199 @@
+package state
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+type PathFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// BatchResult reports how a batch playlist operation went. Paths that could
+// not be used are listed in Failures instead of aborting the whole batch.
+type BatchResult struct {
+	Applied  int           `json:"applied"`
+	Skipped  int           `json:"skipped"`
+	Failures []PathFailure `json:"failures"`
+}
+
+func (r *BatchResult) fail(path string, err error) {
+	r.Failures = append(r.Failures, PathFailure{Path: path, Error: err.Error()})
+}
+
+// resolveTrackPaths validates paths against the music directories, resolving
+// the directories only once.
+func (s *Store) resolveTrackPaths(paths []string, result *BatchResult) ([]string, error) {
+	dirs, err := s.ResolveMusicDirs()
+	if err != nil {
+		return nil, err
+	}
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		absFile, err := resolveTrackPathIn(dirs, path)
+		if err != nil {
+			result.fail(path, err)
+			continue
+		}
+		resolved = append(resolved, absFile)
+	}
+	return resolved, nil
+}
+
+// AddTracksToPlaylist appends tracks in one update. Like AddToPlaylist it
+// skips tracks that are already in the playlist.
+func (s *Store) AddTracksToPlaylist(name string, paths []string) (BatchResult, error) {
+	result := BatchResult{Failures: []PathFailure{}}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return result, errors.New("playlist name is required")
+	}
+	resolved, err := s.resolveTrackPaths(paths, &result)
+	if err != nil {
+		return result, err
+	}
+	_, err = s.Update(func(state *State) error {
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			return playlistNotFound(state, name)
+		}
+		playlist := &state.Playlists[index]
+		for _, absFile := range resolved {
+			if playlist.containsPath(absFile) {
+				result.Skipped++
+				continue
+			}
+			playlist.Entries = append(playlist.Entries, newPlaylistEntry(absFile))
+			result.Applied++
+		}
+		if result.Applied == 0 {
+			return errUnchanged
+		}
+		playlist.touch()
+		return nil
+	})
+	if err != nil {
+		return BatchResult{Failures: []PathFailure{}}, err
+	}
+	return result, nil
+}
+
+// RemoveTracksFromPlaylist removes every entry for each path in one update.
+// Paths that no longer exist on disk are matched by their cleaned form so
+// stale entries can still be removed; such a path that matches no entry is
+// reported in Failures with the reason it did not resolve, like
+// AddTracksToPlaylist does.
+func (s *Store) RemoveTracksFromPlaylist(name string, paths []string) (BatchResult, error) {
+	result := BatchResult{Failures: []PathFailure{}}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return result, errors.New("playlist name is required")
+	}
+	dirs, err := s.ResolveMusicDirs()
+	if err != nil {
+		return result, err
+	}
+	type removal struct {
+		path       string
+		target     string
+		resolveErr error
+	}
+	targets := make([]removal, 0, len(paths))
+	for _, path := range paths {
+		if strings.TrimSpace(path) == "" {
+			result.fail(path, errors.New("path is required"))
+			continue
+		}
+		absFile, err := resolveTrackPathIn(dirs, path)
+		if err != nil {
+			absFile = filepath.Clean(path)
+		}
+		targets = append(targets, removal{path: path, target: absFile, resolveErr: err})
+	}
+	_, err = s.updateWithSnapshot(SnapshotRemoveTracks, func(state *State) error {
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			return playlistNotFound(state, name)
+		}
+		playlist := &state.Playlists[index]
+		for _, target := range targets {
+			updated := make([]PlaylistEntry, 0, len(playlist.Entries))
+			for _, entry := range playlist.Entries {
+				if strings.EqualFold(entry.Path, target.target) {
+					continue
+				}
+				updated = append(updated, entry)
+			}
+			if len(updated) == len(playlist.Entries) {
+				if target.resolveErr != nil {
+					result.fail(target.path, target.resolveErr)
+				} else {
+					result.Skipped++
+				}
+				continue
+			}
+			playlist.Entries = updated
+			result.Applied++
+		}
+		if result.Applied == 0 {
+			return errUnchanged
+		}
+		playlist.touch()
+		return nil
+	})
+	if err != nil {
+		return BatchResult{Failures: []PathFailure{}}, err
+	}
+	return result, nil
+}
+
+// ReplacePlaylistTracks sets the playlist to the valid paths, in order.
+// Entries for tracks that stay in the playlist keep their IDs and added
+// times.
+func (s *Store) ReplacePlaylistTracks(name string, paths []string) (BatchResult, error) {
+	result := BatchResult{Failures: []PathFailure{}}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return result, errors.New("playlist name is required")
+	}
+	resolved, err := s.resolveTrackPaths(paths, &result)
+	if err != nil {
+		return result, err
+	}
+	_, err = s.updateWithSnapshot(SnapshotReplaceTracks, func(state *State) error {
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			return playlistNotFound(state, name)
+		}
+		playlist := &state.Playlists[index]
+		playlist.Entries = reuseEntries(playlist.Entries, resolved)
+		playlist.touch()
+		result.Applied = len(resolved)
+		return nil
+	})
+	if err != nil {
+		return BatchResult{Failures: []PathFailure{}}, err
+	}
+	return result, nil
+}
+
+func reuseEntries(existing []PlaylistEntry, paths []string) []PlaylistEntry {
+	available := make(map[string][]PlaylistEntry, len(existing))
+	for _, entry := range existing {
+		key := strings.ToLower(entry.Path)
+		available[key] = append(available[key], entry)
+	}
+	entries := make([]PlaylistEntry, 0, len(paths))
+	for _, path := range paths {
+		key := strings.ToLower(path)
+		if matches := available[key]; len(matches) > 0 {
+			entries = append(entries, matches[0])
+			available[key] = matches[1:]
+			continue
+		}
+		entries = append(entries, newPlaylistEntry(path))
+	}
+	return entries
+}
@@ -0,0 +1,36 @@
+package state
+
+import (
+	"maps"
+	"slices"
+)
+
+// clone returns a deep copy of the state, so the copy can be changed or
+// handed out without affecting the store's own state.
+func (state State) clone() State {
+	state.MusicDirs = slices.Clone(state.MusicDirs)
+	state.MusicRoots = slices.Clone(state.MusicRoots)
+	state.Playlists = slices.Clone(state.Playlists)
+	for i := range state.Playlists {
+		playlist := &state.Playlists[i]
+		playlist.Entries = slices.Clone(playlist.Entries)
+		playlist.Tracks = slices.Clone(playlist.Tracks)
+		if playlist.Source != nil {
+			source := *playlist.Source
+			playlist.Source = &source
+		}
+	}
+	state.PlaylistFolders = slices.Clone(state.PlaylistFolders)
+	state.SmartPlaylists = slices.Clone(state.SmartPlaylists)
+	for i := range state.SmartPlaylists {
+		state.SmartPlaylists[i].Rules = slices.Clone(state.SmartPlaylists[i].Rules)
+	}
+	state.Exclusions = Exclusions{
+		HiddenTracks:      slices.Clone(state.Exclusions.HiddenTracks),
+		HiddenAlbums:      slices.Clone(state.Exclusions.HiddenAlbums),
+		SkipShuffleTracks: slices.Clone(state.Exclusions.SkipShuffleTracks),
+		SkipShuffleAlbums: slices.Clone(state.Exclusions.SkipShuffleAlbums),
+	}
+	state.TrackStats = maps.Clone(state.TrackStats)
+	return state
+}
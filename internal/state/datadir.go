@@ -0,0 +1,238 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Where a data directory was chosen from, in order of precedence.
+const (
+	DataDirFromFlag     = "flag"
+	DataDirFromEnv      = "env"
+	DataDirFromPortable = "portable"
+	DataDirDefault      = "default"
+)
+
+const (
+	// DataDirFlag is the command-line flag that sets the data directory,
+	// given as --data-dir=<path> or --data-dir <path>.
+	DataDirFlag = "data-dir"
+	// DataDirEnv is the environment variable that sets the data directory.
+	DataDirEnv = "LITESOUND_DATA_DIR"
+	// PortableMarker is the file that, placed next to the executable, keeps
+	// the data in a "data" folder beside it.
+	PortableMarker = "portable"
+)
+
+// DataDir is the directory holding state.json and its backups and
+// snapshots. Source is one of the DataDirFrom… constants or DataDirDefault.
+type DataDir struct {
+	Path   string `json:"path"`
+	Source string `json:"source"`
+}
+
+// ResolveDataDir picks the data directory from the --data-dir flag in args,
+// the LITESOUND_DATA_DIR environment variable, a portable marker next to the
+// executable, or the user config directory, in that order.
+func ResolveDataDir(appName string, args []string) (DataDir, error) {
+	if dir := dataDirArg(args); dir != "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return DataDir{}, err
+		}
+		return DataDir{Path: abs, Source: DataDirFromFlag}, nil
+	}
+	if dir := strings.TrimSpace(os.Getenv(DataDirEnv)); dir != "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return DataDir{}, err
+		}
+		return DataDir{Path: abs, Source: DataDirFromEnv}, nil
+	}
+	if exe, err := os.Executable(); err == nil {
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+		exeDir := filepath.Dir(exe)
+		if info, err := os.Stat(filepath.Join(exeDir, PortableMarker)); err == nil && !info.IsDir() {
+			return DataDir{Path: filepath.Join(exeDir, "data"), Source: DataDirFromPortable}, nil
+		}
+	}
+	dir, err := DefaultDataDir(appName)
+	if err != nil {
+		return DataDir{}, err
+	}
+	return DataDir{Path: dir, Source: DataDirDefault}, nil
+}
+
+// DefaultDataDir is the data directory used when nothing else is set.
+func DefaultDataDir(appName string) (string, error) {
+	if strings.TrimSpace(appName) == "" {
+		appName = "LiteSound"
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, appName), nil
+}
+
+func dataDirArg(args []string) string {
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if value, ok := strings.CutPrefix(name, DataDirFlag+"="); ok {
+			return strings.TrimSpace(value)
+		}
+		if name == DataDirFlag && i+1 < len(args) {
+			return strings.TrimSpace(args[i+1])
+		}
+	}
+	return ""
+}
+
+// DataDirInfo describes the data directory in use and whether state from
+// the default location can be moved into it.
+type DataDirInfo struct {
+	DataDir
+	DefaultPath        string `json:"defaultPath"`
+	MigrationAvailable bool   `json:"migrationAvailable"`
+}
+
+// DataDirInfo reports the store's data directory. A migration is available
+// when the directory is not the default one, has no state.json yet, and the
+// default location has one.
+func (s *Store) DataDirInfo() (DataDirInfo, error) {
+	info := DataDirInfo{DataDir: s.dataDir}
+	base, err := s.baseDir()
+	if err != nil {
+		return info, err
+	}
+	info.Path = base
+	if info.Source == "" {
+		info.Source = DataDirDefault
+	}
+	defaultDir, err := DefaultDataDir(s.appName)
+	if err != nil {
+		return info, err
+	}
+	info.DefaultPath = defaultDir
+	if filepath.Clean(defaultDir) == filepath.Clean(info.Path) {
+		return info, nil
+	}
+	if _, err := os.Stat(filepath.Join(base, "state.json")); err == nil {
+		return info, nil
+	}
+	if _, err := os.Stat(filepath.Join(defaultDir, "state.json")); err == nil {
+		info.MigrationAvailable = true
+	}
+	return info, nil
+}
+
+// MigrateDataDir copies state.json, its backup, the snapshots and the
+// profiles from the default location into the store's data directory and
+// loads them. It refuses when the data directory already has a state file,
+// so nothing there is overwritten. The default location is left as it was.
+func (s *Store) MigrateDataDir() (State, error) {
+	info, err := s.DataDirInfo()
+	if err != nil {
+		return State{}, err
+	}
+	if filepath.Clean(info.DefaultPath) == filepath.Clean(info.Path) {
+		return State{}, errors.New("data directory is the default location")
+	}
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	if err := s.Flush(); err != nil {
+		return State{}, err
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statePath := filepath.Join(info.Path, "state.json")
+	if _, err := os.Stat(statePath); err == nil {
+		return State{}, errors.New("data directory already has a state file")
+	}
+	source := filepath.Join(info.DefaultPath, "state.json")
+	if _, err := os.Stat(source); err != nil {
+		return State{}, errors.New("no state file in the default location")
+	}
+	files, err := dataFiles(info.DefaultPath)
+	if err != nil {
+		return State{}, err
+	}
+	for _, name := range files {
+		if err := copyDataFile(filepath.Join(info.DefaultPath, name), filepath.Join(info.Path, name)); err != nil {
+			return State{}, err
+		}
+	}
+	// state.json goes last so an interrupted migration can be retried.
+	if err := copyDataFile(source, statePath); err != nil {
+		return State{}, err
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.profileMu.Lock()
+	s.profileResolved = false
+	s.profileMu.Unlock()
+	previous := s.state
+	s.loaded = false
+	s.dirty = false
+	if err := s.ensureLoaded(); err != nil {
+		return State{}, err
+	}
+	s.publish(&previous, &s.state, ChangeFromApp)
+	return s.state.clone(), nil
+}
+
+// dataFiles lists the files under dir, relative to it, that belong to the
+// store other than state.json itself: the backup, the snapshots, the sync
+// setup, the play history, and profiles.json with each profile's own files.
+func dataFiles(dir string) ([]string, error) {
+	files := make([]string, 0)
+	for _, name := range []string{"state.backup.json", "profiles.json", syncConfigFileName, historyFileName} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			files = append(files, name)
+		}
+	}
+	for _, sub := range []string{"snapshots", "profiles"} {
+		err := filepath.WalkDir(filepath.Join(dir, sub), func(path string, d os.DirEntry, walkErr error) error {
+			if walkErr != nil {
+				if os.IsNotExist(walkErr) {
+					return nil
+				}
+				return walkErr
+			}
+			if d.IsDir() || !(strings.HasSuffix(d.Name(), ".json") || d.Name() == historyFileName) {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func copyDataFile(src string, dest string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dest, data)
+}
@@ -0,0 +1,117 @@
+package state
+
+import (
+	"reflect"
+	"slices"
+)
+
+// Kinds of state change that subscribers are told about.
+const (
+	ChangePlaylists      = "playlists"
+	ChangeActivePlaylist = "activePlaylist"
+	ChangeTheme          = "theme"
+	ChangeMusicDirs      = "musicDirs"
+	ChangeFilters        = "filters"
+	ChangePreferences    = "preferences"
+)
+
+// Where a change came from: the app itself, or an edit of state.json by
+// something else that the store picked up.
+const (
+	ChangeFromApp  = "app"
+	ChangeFromFile = "file"
+)
+
+// Change reports that one part of the state changed. Subscribers read the
+// new value from the store.
+type Change struct {
+	Kind   string `json:"kind"`
+	Source string `json:"source"`
+}
+
+// Subscribe registers fn to be called for every change, in order, on a
+// goroutine of the store's. fn may call back into the store. The returned
+// function unsubscribes.
+func (s *Store) Subscribe(fn func(Change)) func() {
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[int]func(Change))
+	}
+	id := s.nextSubscriber
+	s.nextSubscriber++
+	s.subscribers[id] = fn
+	return func() {
+		s.eventsMu.Lock()
+		delete(s.subscribers, id)
+		s.eventsMu.Unlock()
+	}
+}
+
+// publish queues a change event for each part of the state that differs
+// between previous and current.
+func (s *Store) publish(previous *State, current *State, source string) {
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+	if len(s.subscribers) == 0 {
+		return
+	}
+	kinds := changedKinds(previous, current)
+	if len(kinds) == 0 {
+		return
+	}
+	for _, kind := range kinds {
+		s.pendingEvents = append(s.pendingEvents, Change{Kind: kind, Source: source})
+	}
+	if !s.dispatching {
+		s.dispatching = true
+		go s.dispatch()
+	}
+}
+
+// dispatch delivers queued events until the queue is empty.
+func (s *Store) dispatch() {
+	for {
+		s.eventsMu.Lock()
+		if len(s.pendingEvents) == 0 {
+			s.dispatching = false
+			s.eventsMu.Unlock()
+			return
+		}
+		change := s.pendingEvents[0]
+		s.pendingEvents = s.pendingEvents[1:]
+		subscribers := make([]func(Change), 0, len(s.subscribers))
+		for _, fn := range s.subscribers {
+			subscribers = append(subscribers, fn)
+		}
+		s.eventsMu.Unlock()
+		for _, fn := range subscribers {
+			fn(change)
+		}
+	}
+}
+
+func changedKinds(previous *State, current *State) []string {
+	kinds := make([]string, 0)
+	if !reflect.DeepEqual(previous.Playlists, current.Playlists) ||
+		!reflect.DeepEqual(previous.PlaylistFolders, current.PlaylistFolders) ||
+		!reflect.DeepEqual(previous.SmartPlaylists, current.SmartPlaylists) {
+		kinds = append(kinds, ChangePlaylists)
+	}
+	if previous.ActivePlaylist != current.ActivePlaylist {
+		kinds = append(kinds, ChangeActivePlaylist)
+	}
+	if previous.Theme != current.Theme {
+		kinds = append(kinds, ChangeTheme)
+	}
+	if !slices.Equal(previous.MusicDirs, current.MusicDirs) {
+		kinds = append(kinds, ChangeMusicDirs)
+	}
+	if previous.ComposerFilter != current.ComposerFilter || previous.AlbumFilter != current.AlbumFilter {
+		kinds = append(kinds, ChangeFilters)
+	}
+	if previous.Preferences != current.Preferences {
+		kinds = append(kinds, ChangePreferences)
+	}
+	return kinds
+}
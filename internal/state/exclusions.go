@@ -0,0 +1,146 @@
+package state
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// Exclusions lists tracks and albums that are hidden from the library or
+// skipped when the player shuffles or auto-advances. Albums are matched by
+// name, case-insensitively.
+type Exclusions struct {
+	HiddenTracks      []string `json:"hiddenTracks"`
+	HiddenAlbums      []string `json:"hiddenAlbums"`
+	SkipShuffleTracks []string `json:"skipShuffleTracks"`
+	SkipShuffleAlbums []string `json:"skipShuffleAlbums"`
+}
+
+func (e *Exclusions) normalize() {
+	if e.HiddenTracks == nil {
+		e.HiddenTracks = []string{}
+	}
+	if e.HiddenAlbums == nil {
+		e.HiddenAlbums = []string{}
+	}
+	if e.SkipShuffleTracks == nil {
+		e.SkipShuffleTracks = []string{}
+	}
+	if e.SkipShuffleAlbums == nil {
+		e.SkipShuffleAlbums = []string{}
+	}
+}
+
+func (e Exclusions) IsHidden(path string, album string) bool {
+	return containsFold(e.HiddenTracks, path) || (strings.TrimSpace(album) != "" && containsFold(e.HiddenAlbums, album))
+}
+
+func (e Exclusions) IsSkippedInShuffle(path string, album string) bool {
+	return containsFold(e.SkipShuffleTracks, path) || (strings.TrimSpace(album) != "" && containsFold(e.SkipShuffleAlbums, album))
+}
+
+func (s *Store) GetExclusions() (Exclusions, error) {
+	state, err := s.Load()
+	if err != nil {
+		return Exclusions{}, err
+	}
+	return state.Exclusions, nil
+}
+
+func (s *Store) SetTrackHidden(path string, hidden bool) error {
+	absFile, err := s.resolveExclusionTrack(path, hidden)
+	if err != nil {
+		return err
+	}
+	_, err = s.Update(func(state *State) error {
+		state.Exclusions.HiddenTracks = toggleFold(state.Exclusions.HiddenTracks, absFile, hidden)
+		return nil
+	})
+	return err
+}
+
+func (s *Store) SetAlbumHidden(album string, hidden bool) error {
+	album = strings.TrimSpace(album)
+	if album == "" {
+		return errors.New("album is required")
+	}
+	_, err := s.Update(func(state *State) error {
+		state.Exclusions.HiddenAlbums = toggleFold(state.Exclusions.HiddenAlbums, album, hidden)
+		return nil
+	})
+	return err
+}
+
+func (s *Store) SetTrackSkipShuffle(path string, skip bool) error {
+	absFile, err := s.resolveExclusionTrack(path, skip)
+	if err != nil {
+		return err
+	}
+	_, err = s.Update(func(state *State) error {
+		state.Exclusions.SkipShuffleTracks = toggleFold(state.Exclusions.SkipShuffleTracks, absFile, skip)
+		return nil
+	})
+	return err
+}
+
+func (s *Store) SetAlbumSkipShuffle(album string, skip bool) error {
+	album = strings.TrimSpace(album)
+	if album == "" {
+		return errors.New("album is required")
+	}
+	_, err := s.Update(func(state *State) error {
+		state.Exclusions.SkipShuffleAlbums = toggleFold(state.Exclusions.SkipShuffleAlbums, album, skip)
+		return nil
+	})
+	return err
+}
+
+// RestoreHiddenItems clears every hidden track and album. Shuffle skips are
+// left untouched.
+func (s *Store) RestoreHiddenItems() error {
+	_, err := s.Update(func(state *State) error {
+		state.Exclusions.HiddenTracks = []string{}
+		state.Exclusions.HiddenAlbums = []string{}
+		return nil
+	})
+	return err
+}
+
+// resolveExclusionTrack validates a track before it is flagged. Clearing a
+// flag only needs a clean path, so entries for files that have since been
+// moved or deleted can still be restored.
+func (s *Store) resolveExclusionTrack(path string, set bool) (string, error) {
+	if set {
+		return s.resolveTrackPath(path)
+	}
+	if strings.TrimSpace(path) == "" {
+		return "", errors.New("path is required")
+	}
+	if resolved, err := s.resolveTrackPath(path); err == nil {
+		return resolved, nil
+	}
+	return filepath.Clean(path), nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, existing := range values {
+		if strings.EqualFold(existing, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func toggleFold(values []string, value string, present bool) []string {
+	updated := make([]string, 0, len(values)+1)
+	for _, existing := range values {
+		if strings.EqualFold(existing, value) {
+			continue
+		}
+		updated = append(updated, existing)
+	}
+	if present {
+		updated = append(updated, value)
+	}
+	return updated
+}
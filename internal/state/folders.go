@@ -0,0 +1,331 @@
+package state
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// PlaylistFolder groups playlists and other folders. An empty ParentID puts
+// the folder at the root.
+type PlaylistFolder struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ParentID string `json:"parentId"`
+	Order    int    `json:"order"`
+}
+
+// PlaylistTree is one level of the playlist hierarchy. The root node has a
+// zero Folder.
+type PlaylistTree struct {
+	Folder    PlaylistFolder `json:"folder"`
+	Folders   []PlaylistTree `json:"folders"`
+	Playlists []Playlist     `json:"playlists"`
+}
+
+func (s *Store) GetPlaylistTree() (PlaylistTree, error) {
+	state, err := s.Load()
+	if err != nil {
+		return PlaylistTree{}, err
+	}
+	return buildPlaylistTree(&state, PlaylistFolder{}), nil
+}
+
+func (s *Store) CreatePlaylistFolder(name string, parentID string) (PlaylistFolder, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return PlaylistFolder{}, errors.New("folder name is required")
+	}
+	var result PlaylistFolder
+	_, err := s.Update(func(state *State) error {
+		if parentID != "" && findFolder(state.PlaylistFolders, parentID) < 0 {
+			return errors.New("parent folder not found")
+		}
+		if folderNameTaken(state.PlaylistFolders, parentID, name, "") {
+			return errors.New("folder already exists")
+		}
+		result = PlaylistFolder{
+			ID:       newID(),
+			Name:     name,
+			ParentID: parentID,
+			Order:    nextFolderOrder(state.PlaylistFolders, parentID),
+		}
+		state.PlaylistFolders = append(state.PlaylistFolders, result)
+		return nil
+	})
+	return result, err
+}
+
+func (s *Store) RenamePlaylistFolder(id string, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("folder name is required")
+	}
+	_, err := s.Update(func(state *State) error {
+		index := findFolder(state.PlaylistFolders, id)
+		if index < 0 {
+			return errors.New("folder not found")
+		}
+		folder := &state.PlaylistFolders[index]
+		if folderNameTaken(state.PlaylistFolders, folder.ParentID, name, folder.ID) {
+			return errors.New("folder already exists")
+		}
+		folder.Name = name
+		return nil
+	})
+	return err
+}
+
+// DeletePlaylistFolder removes a folder. Its playlists and subfolders move up
+// to the folder's parent rather than being deleted.
+func (s *Store) DeletePlaylistFolder(id string) error {
+	_, err := s.updateWithSnapshot(SnapshotDeleteFolder, func(state *State) error {
+		index := findFolder(state.PlaylistFolders, id)
+		if index < 0 {
+			return errors.New("folder not found")
+		}
+		parentID := state.PlaylistFolders[index].ParentID
+		state.PlaylistFolders = append(state.PlaylistFolders[:index], state.PlaylistFolders[index+1:]...)
+		nextFolder := nextFolderOrder(state.PlaylistFolders, parentID)
+		for i := range state.PlaylistFolders {
+			if state.PlaylistFolders[i].ParentID == id {
+				state.PlaylistFolders[i].ParentID = parentID
+				state.PlaylistFolders[i].Order += nextFolder
+			}
+		}
+		nextPlaylist := nextPlaylistOrder(state.Playlists, parentID)
+		for i := range state.Playlists {
+			if state.Playlists[i].FolderID == id {
+				state.Playlists[i].FolderID = parentID
+				state.Playlists[i].Order += nextPlaylist
+			}
+		}
+		normalizeFolders(state)
+		return nil
+	})
+	return err
+}
+
+// MovePlaylistToFolder moves a playlist into folderID (empty for the root)
+// at index among that folder's playlists. An index outside the folder
+// appends the playlist.
+func (s *Store) MovePlaylistToFolder(name string, folderID string, index int) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("playlist name is required")
+	}
+	_, err := s.Update(func(state *State) error {
+		playlistIndex := findPlaylist(state.Playlists, name)
+		if playlistIndex < 0 {
+			return playlistNotFound(state, name)
+		}
+		if folderID != "" && findFolder(state.PlaylistFolders, folderID) < 0 {
+			return errors.New("folder not found")
+		}
+		moving := &state.Playlists[playlistIndex]
+		moving.FolderID = folderID
+		siblings := make([]*Playlist, 0)
+		for i := range state.Playlists {
+			playlist := &state.Playlists[i]
+			if playlist.FolderID == folderID && playlist != moving {
+				siblings = append(siblings, playlist)
+			}
+		}
+		sort.SliceStable(siblings, func(i, j int) bool { return siblings[i].Order < siblings[j].Order })
+		siblings = insertAt(siblings, moving, index)
+		for order, playlist := range siblings {
+			playlist.Order = order
+		}
+		return nil
+	})
+	return err
+}
+
+// MovePlaylistFolder moves a folder under parentID (empty for the root) at
+// index among that parent's folders.
+func (s *Store) MovePlaylistFolder(id string, parentID string, index int) error {
+	_, err := s.Update(func(state *State) error {
+		folderIndex := findFolder(state.PlaylistFolders, id)
+		if folderIndex < 0 {
+			return errors.New("folder not found")
+		}
+		if parentID != "" {
+			if findFolder(state.PlaylistFolders, parentID) < 0 {
+				return errors.New("parent folder not found")
+			}
+			for ancestor := parentID; ancestor != ""; {
+				if ancestor == id {
+					return errors.New("cannot move a folder into itself")
+				}
+				ancestorIndex := findFolder(state.PlaylistFolders, ancestor)
+				if ancestorIndex < 0 {
+					break
+				}
+				ancestor = state.PlaylistFolders[ancestorIndex].ParentID
+			}
+		}
+		moving := &state.PlaylistFolders[folderIndex]
+		if folderNameTaken(state.PlaylistFolders, parentID, moving.Name, moving.ID) {
+			return errors.New("folder already exists")
+		}
+		moving.ParentID = parentID
+		siblings := make([]*PlaylistFolder, 0)
+		for i := range state.PlaylistFolders {
+			folder := &state.PlaylistFolders[i]
+			if folder.ParentID == parentID && folder != moving {
+				siblings = append(siblings, folder)
+			}
+		}
+		sort.SliceStable(siblings, func(i, j int) bool { return siblings[i].Order < siblings[j].Order })
+		siblings = insertAt(siblings, moving, index)
+		for order, folder := range siblings {
+			folder.Order = order
+		}
+		return nil
+	})
+	return err
+}
+
+func buildPlaylistTree(state *State, folder PlaylistFolder) PlaylistTree {
+	node := PlaylistTree{
+		Folder:    folder,
+		Folders:   []PlaylistTree{},
+		Playlists: []Playlist{},
+	}
+	children := make([]PlaylistFolder, 0)
+	for _, child := range state.PlaylistFolders {
+		if child.ParentID == folder.ID {
+			children = append(children, child)
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool { return children[i].Order < children[j].Order })
+	for _, child := range children {
+		node.Folders = append(node.Folders, buildPlaylistTree(state, child))
+	}
+	for _, playlist := range state.Playlists {
+		if playlist.FolderID == folder.ID {
+			node.Playlists = append(node.Playlists, playlist)
+		}
+	}
+	sort.SliceStable(node.Playlists, func(i, j int) bool { return node.Playlists[i].Order < node.Playlists[j].Order })
+	return node
+}
+
+// normalizeFolders moves playlists and folders whose parent no longer exists
+// to the root, breaks parent cycles by moving a folder of each cycle to the
+// root, and renumbers every level so orders are dense. Playlists from state
+// files without folders all end up at the root in their stored order.
+func normalizeFolders(state *State) {
+	if state.PlaylistFolders == nil {
+		state.PlaylistFolders = []PlaylistFolder{}
+	}
+	known := make(map[string]int, len(state.PlaylistFolders))
+	for i, folder := range state.PlaylistFolders {
+		known[folder.ID] = i
+	}
+	for i := range state.PlaylistFolders {
+		folder := &state.PlaylistFolders[i]
+		if _, ok := known[folder.ParentID]; !ok || folder.ParentID == folder.ID {
+			folder.ParentID = ""
+		}
+	}
+	// A folder in a cycle is never reached from the root, so it and its
+	// playlists would disappear from the tree. Hand edits and imports can
+	// produce such cycles.
+	for i := range state.PlaylistFolders {
+		folder := &state.PlaylistFolders[i]
+		visited := map[string]struct{}{folder.ID: {}}
+		for parent := folder.ParentID; parent != ""; parent = state.PlaylistFolders[known[parent]].ParentID {
+			if parent == folder.ID {
+				folder.ParentID = ""
+				break
+			}
+			if _, ok := visited[parent]; ok {
+				break
+			}
+			visited[parent] = struct{}{}
+		}
+	}
+	folderGroups := make(map[string][]*PlaylistFolder)
+	for i := range state.PlaylistFolders {
+		folder := &state.PlaylistFolders[i]
+		folderGroups[folder.ParentID] = append(folderGroups[folder.ParentID], folder)
+	}
+	for _, group := range folderGroups {
+		sort.SliceStable(group, func(i, j int) bool { return group[i].Order < group[j].Order })
+		for order, folder := range group {
+			folder.Order = order
+		}
+	}
+	playlistGroups := make(map[string][]*Playlist)
+	for i := range state.Playlists {
+		playlist := &state.Playlists[i]
+		if _, ok := known[playlist.FolderID]; !ok {
+			playlist.FolderID = ""
+		}
+		playlistGroups[playlist.FolderID] = append(playlistGroups[playlist.FolderID], playlist)
+	}
+	for _, group := range playlistGroups {
+		sort.SliceStable(group, func(i, j int) bool { return group[i].Order < group[j].Order })
+		for order, playlist := range group {
+			playlist.Order = order
+		}
+	}
+}
+
+func appendPlaylist(state *State, playlist Playlist) Playlist {
+	playlist.Order = nextPlaylistOrder(state.Playlists, playlist.FolderID)
+	state.Playlists = append(state.Playlists, playlist)
+	return playlist
+}
+
+func findFolder(folders []PlaylistFolder, id string) int {
+	if id == "" {
+		return -1
+	}
+	for i, folder := range folders {
+		if folder.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func folderNameTaken(folders []PlaylistFolder, parentID string, name string, exceptID string) bool {
+	for _, folder := range folders {
+		if folder.ParentID == parentID && folder.ID != exceptID && strings.EqualFold(folder.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func nextFolderOrder(folders []PlaylistFolder, parentID string) int {
+	next := 0
+	for _, folder := range folders {
+		if folder.ParentID == parentID && folder.Order >= next {
+			next = folder.Order + 1
+		}
+	}
+	return next
+}
+
+func nextPlaylistOrder(playlists []Playlist, folderID string) int {
+	next := 0
+	for _, playlist := range playlists {
+		if playlist.FolderID == folderID && playlist.Order >= next {
+			next = playlist.Order + 1
+		}
+	}
+	return next
+}
+
+func insertAt[T any](items []T, item T, index int) []T {
+	if index < 0 || index >= len(items) {
+		return append(items, item)
+	}
+	items = append(items, item)
+	copy(items[index+1:], items[index:])
+	items[index] = item
+	return items
+}
@@ -0,0 +1,308 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How a play ended.
+const (
+	PlayCompleted = "completed"
+	PlaySkipped   = "skipped"
+)
+
+// Where a played track was started from.
+const (
+	PlayFromLibrary  = "library"
+	PlayFromPlaylist = "playlist"
+	PlayFromShuffle  = "shuffle"
+	PlayFromSearch   = "search"
+)
+
+// historyFileName is the play history log next to state.json. It is only
+// ever appended to, one JSON record per line.
+const historyFileName = "history.jsonl"
+
+// Page sizes for QueryHistory.
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// PlayRecord is one play of a track. StartedAt is in Unix milliseconds;
+// Listened and Duration are in seconds.
+type PlayRecord struct {
+	Path      string  `json:"path"`
+	StartedAt int64   `json:"startedAt"`
+	Listened  float64 `json:"listened"`
+	Duration  float64 `json:"duration"`
+	Outcome   string  `json:"outcome"`
+	Source    string  `json:"source"`
+	Playlist  string  `json:"playlist,omitempty"`
+}
+
+// HistoryQuery selects plays started in [From, To), in Unix milliseconds;
+// zero leaves that end open. Results come newest first, Limit at a time
+// from Offset.
+type HistoryQuery struct {
+	From   int64 `json:"from"`
+	To     int64 `json:"to"`
+	Offset int   `json:"offset"`
+	Limit  int   `json:"limit"`
+}
+
+type HistoryPage struct {
+	Records []PlayRecord `json:"records"`
+	Total   int          `json:"total"`
+	Offset  int          `json:"offset"`
+	Limit   int          `json:"limit"`
+}
+
+// historyLog is the history as last read, kept until the file changes.
+type historyLog struct {
+	stamp   fileStamp
+	records []PlayRecord
+}
+
+func (s *Store) historyPath() (string, error) {
+	statePath, err := s.stateFilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(statePath), historyFileName), nil
+}
+
+// ErrPlayStatsNotSaved is returned, wrapped, by RecordPlay when the play was
+// added to the history but could not be counted in the track's statistics.
+// The play is recorded, so it must not be recorded again.
+var ErrPlayStatsNotSaved = errors.New("play statistics not saved")
+
+// RecordPlay appends a finished or skipped play to the history and counts
+// it in the track's statistics under the track's resolved path, which must
+// be inside a music folder. A missing start time is worked out from the time
+// listened.
+func (s *Store) RecordPlay(record PlayRecord) (PlayRecord, error) {
+	path, err := s.resolveTrackPath(strings.TrimSpace(record.Path))
+	if err != nil {
+		return PlayRecord{}, err
+	}
+	record.Path = path
+	if math.IsNaN(record.Listened) || math.IsInf(record.Listened, 0) || record.Listened < 0 {
+		return PlayRecord{}, errors.New("invalid listened time")
+	}
+	if math.IsNaN(record.Duration) || math.IsInf(record.Duration, 0) || record.Duration < 0 {
+		return PlayRecord{}, errors.New("invalid duration")
+	}
+	switch record.Outcome {
+	case PlayCompleted, PlaySkipped:
+	default:
+		return PlayRecord{}, errors.New("invalid outcome")
+	}
+	switch record.Source {
+	case "":
+		record.Source = PlayFromLibrary
+	case PlayFromLibrary, PlayFromPlaylist, PlayFromShuffle, PlayFromSearch:
+	default:
+		return PlayRecord{}, errors.New("invalid source")
+	}
+	if record.Source != PlayFromPlaylist {
+		record.Playlist = ""
+	}
+	if record.StartedAt <= 0 {
+		record.StartedAt = time.Now().UnixMilli() - int64(record.Listened*1000)
+	}
+	if err := s.appendHistory(record); err != nil {
+		return PlayRecord{}, err
+	}
+	if err := s.recordPlayStats(record); err != nil {
+		return record, fmt.Errorf("%w: %v", ErrPlayStatsNotSaved, err)
+	}
+	return record, nil
+}
+
+func (s *Store) appendHistory(record PlayRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	path, err := s.historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	// A line cut short by a crash is finished off so the new record starts
+	// on a line of its own.
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readHistory returns every play in the order recorded. Lines that do not
+// parse are skipped.
+func (s *Store) readHistory() ([]PlayRecord, error) {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	path, err := s.historyPath()
+	if err != nil {
+		return nil, err
+	}
+	stamp := stampFile(path)
+	if s.history != nil && s.history.stamp == stamp {
+		return s.history.records, nil
+	}
+	records := make([]PlayRecord, 0)
+	file, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var record PlayRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Path == "" {
+				continue
+			}
+			records = append(records, record)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	s.history = &historyLog{stamp: stamp, records: records}
+	return records, nil
+}
+
+// historyBetween returns the plays started in the query's time range,
+// newest first.
+func (s *Store) historyBetween(query HistoryQuery) ([]PlayRecord, error) {
+	records, err := s.readHistory()
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]PlayRecord, 0)
+	for _, record := range records {
+		if query.From > 0 && record.StartedAt < query.From {
+			continue
+		}
+		if query.To > 0 && record.StartedAt >= query.To {
+			continue
+		}
+		matched = append(matched, record)
+	}
+	// Records are appended when a play ends, so sort by start time rather
+	// than trusting file order.
+	slices.SortStableFunc(matched, func(a, b PlayRecord) int {
+		switch {
+		case a.StartedAt > b.StartedAt:
+			return -1
+		case a.StartedAt < b.StartedAt:
+			return 1
+		}
+		return 0
+	})
+	return matched, nil
+}
+
+// QueryHistory returns one page of the plays in a time range.
+func (s *Store) QueryHistory(query HistoryQuery) (HistoryPage, error) {
+	if query.Offset < 0 {
+		return HistoryPage{}, errors.New("invalid offset")
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultHistoryLimit
+	}
+	query.Limit = min(query.Limit, maxHistoryLimit)
+	matched, err := s.historyBetween(query)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	start := min(query.Offset, len(matched))
+	end := min(start+query.Limit, len(matched))
+	return HistoryPage{
+		Records: slices.Clone(matched[start:end]),
+		Total:   len(matched),
+		Offset:  query.Offset,
+		Limit:   query.Limit,
+	}, nil
+}
+
+// ExportHistory writes the plays in the query's time range to path, as CSV
+// when it ends in .csv and as a JSON array otherwise. Offset and Limit are
+// ignored. It returns the number of plays written.
+func (s *Store) ExportHistory(path string, query HistoryQuery) (int, error) {
+	if strings.TrimSpace(path) == "" {
+		return 0, errors.New("destination is required")
+	}
+	records, err := s.historyBetween(query)
+	if err != nil {
+		return 0, err
+	}
+	var buffer bytes.Buffer
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = writeHistoryCSV(&buffer, records)
+	} else {
+		encoder := json.NewEncoder(&buffer)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(records)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := writeFileAtomic(path, buffer.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+func writeHistoryCSV(w io.Writer, records []PlayRecord) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"started_at", "path", "listened_seconds", "duration_seconds", "outcome", "source", "playlist"}); err != nil {
+		return err
+	}
+	for _, record := range records {
+		row := []string{
+			time.UnixMilli(record.StartedAt).UTC().Format(time.RFC3339),
+			record.Path,
+			strconv.FormatFloat(record.Listened, 'f', -1, 64),
+			strconv.FormatFloat(record.Duration, 'f', -1, 64),
+			record.Outcome,
+			record.Source,
+			record.Playlist,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,82 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// currentStateVersion is the schema version written to state.json. Bump it
+// together with a new entry in migrations.
+const currentStateVersion = 1
+
+type migration struct {
+	version int
+	apply   func(raw map[string]json.RawMessage) error
+}
+
+// migrations bring a state file up to currentStateVersion one version at a
+// time, in order. They work on the raw JSON so they can reshape fields that
+// State no longer has. Files without a version are version 0.
+var migrations = []migration{
+	{version: 1, apply: migrateMusicDirs},
+}
+
+// migrateState runs the migrations that data has not seen yet. Data already
+// at the current version, or written by a newer release, is returned as is.
+func migrateState(data []byte) ([]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, errors.New("state file is not a JSON object")
+	}
+	version := 0
+	if value, ok := raw["version"]; ok {
+		if err := json.Unmarshal(value, &version); err != nil {
+			return nil, fmt.Errorf("invalid state version: %w", err)
+		}
+	}
+	if version >= currentStateVersion {
+		return data, nil
+	}
+	for _, step := range migrations {
+		if step.version <= version {
+			continue
+		}
+		if err := step.apply(raw); err != nil {
+			return nil, fmt.Errorf("migrating state to version %d: %w", step.version, err)
+		}
+	}
+	raw["version"] = json.RawMessage(strconv.Itoa(currentStateVersion))
+	return json.Marshal(raw)
+}
+
+// migrateMusicDirs moves the single musicDir of the first releases into
+// musicDirs.
+func migrateMusicDirs(raw map[string]json.RawMessage) error {
+	var dir string
+	if value, ok := raw["musicDir"]; ok {
+		if err := json.Unmarshal(value, &dir); err != nil {
+			return err
+		}
+	}
+	var dirs []string
+	if value, ok := raw["musicDirs"]; ok {
+		if err := json.Unmarshal(value, &dirs); err != nil {
+			return err
+		}
+	}
+	if len(dirs) == 0 && strings.TrimSpace(dir) != "" {
+		encoded, err := json.Marshal([]string{dir})
+		if err != nil {
+			return err
+		}
+		raw["musicDirs"] = encoded
+	}
+	raw["musicDir"] = json.RawMessage(`""`)
+	return nil
+}
@@ -0,0 +1,666 @@
+package state
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"LiteSound/internal/media"
+)
+
+const FavoritesKey = "__favorites__"
+
+var allowedCoverExt = map[string]struct{}{
+	".jpg":  {},
+	".jpeg": {},
+	".png":  {},
+	".webp": {},
+	".gif":  {},
+}
+
+// IsCoverImage reports whether path has an extension accepted for playlist
+// covers.
+func IsCoverImage(path string) bool {
+	_, ok := allowedCoverExt[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// PlaylistEntry is one track in a playlist. Path is absolute once loaded.
+// On disk it is relative to the music root named by Root; Root is only left
+// set in memory for entries that could not be found under any current root.
+type PlaylistEntry struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	Root    string `json:"root,omitempty"`
+	AddedAt int64  `json:"addedAt"`
+}
+
+type Playlist struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CoverImage  string `json:"coverImage"`
+	CreatedAt   int64  `json:"createdAt"`
+	ModifiedAt  int64  `json:"modifiedAt"`
+	FolderID    string `json:"folderId"`
+	Order       int    `json:"order"`
+	// Source is set on playlists kept in sync with a music folder.
+	Source  *FolderSource   `json:"source,omitempty"`
+	Entries []PlaylistEntry `json:"entries"`
+	// Tracks mirrors the entry paths in order for clients that predate
+	// playlist entries. It is rebuilt from Entries on every change, leaves
+	// out entries whose root could not be resolved, and is not saved.
+	Tracks []string `json:"tracks"`
+}
+
+// PlaylistView is a playlist as listed to the frontend. Smart and ReadOnly
+// are only set on the views of smart playlists listed alongside regular
+// playlists; they are never stored.
+type PlaylistView struct {
+	Playlist
+	Smart    bool `json:"smart"`
+	ReadOnly bool `json:"readOnly"`
+}
+
+type MergeOptions struct {
+	// Dedupe skips tracks that are already in the target or that an earlier
+	// source already contributed.
+	Dedupe bool `json:"dedupe"`
+	// DeleteSources removes the source playlists once they are merged.
+	DeleteSources bool `json:"deleteSources"`
+}
+
+func (p *Playlist) touch() {
+	p.ModifiedAt = time.Now().UnixMilli()
+	p.syncTracks()
+}
+
+func (p *Playlist) syncTracks() {
+	tracks := make([]string, 0, len(p.Entries))
+	for _, entry := range p.Entries {
+		if entry.Root != "" {
+			continue
+		}
+		tracks = append(tracks, entry.Path)
+	}
+	p.Tracks = tracks
+}
+
+func (p *Playlist) entryIndex(entryID string) int {
+	for i, entry := range p.Entries {
+		if entry.ID == entryID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *Playlist) containsPath(path string) bool {
+	for _, entry := range p.Entries {
+		if strings.EqualFold(entry.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func newPlaylist(name string) Playlist {
+	now := time.Now().UnixMilli()
+	return Playlist{
+		ID:         newID(),
+		Name:       name,
+		CreatedAt:  now,
+		ModifiedAt: now,
+		Entries:    []PlaylistEntry{},
+		Tracks:     []string{},
+	}
+}
+
+func newPlaylistEntry(path string) PlaylistEntry {
+	return PlaylistEntry{
+		ID:      newID(),
+		Path:    path,
+		AddedAt: time.Now().UnixMilli(),
+	}
+}
+
+func (s *Store) GetPlaylists() ([]Playlist, error) {
+	state, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	if state.Playlists == nil {
+		return []Playlist{}, nil
+	}
+	return state.Playlists, nil
+}
+
+func (s *Store) GetPlaylist(name string) (Playlist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Playlist{}, errors.New("playlist name is required")
+	}
+	state, err := s.Load()
+	if err != nil {
+		return Playlist{}, err
+	}
+	index := findPlaylist(state.Playlists, name)
+	if index < 0 {
+		return Playlist{}, errors.New("playlist not found")
+	}
+	return state.Playlists[index], nil
+}
+
+func (s *Store) CreatePlaylist(name string) error {
+	name, err := validatePlaylistName(name)
+	if err != nil {
+		return err
+	}
+	_, err = s.Update(func(state *State) error {
+		if playlistNameInUse(state, name, "") {
+			return errors.New("playlist already exists")
+		}
+		appendPlaylist(state, newPlaylist(name))
+		return nil
+	})
+	return err
+}
+
+// ImportPlaylist creates a playlist holding paths in a single update. If the
+// name is taken a numeric suffix is added. Paths that are not valid tracks
+// are left out.
+func (s *Store) ImportPlaylist(name string, paths []string) (Playlist, error) {
+	name, err := validatePlaylistName(name)
+	if err != nil {
+		return Playlist{}, err
+	}
+	dirs, err := s.ResolveMusicDirs()
+	if err != nil {
+		return Playlist{}, err
+	}
+	var result Playlist
+	_, err = s.Update(func(state *State) error {
+		unique := name
+		for n := 2; playlistNameInUse(state, unique, ""); n++ {
+			unique = name + " (" + strconv.Itoa(n) + ")"
+		}
+		playlist := newPlaylist(unique)
+		for _, path := range paths {
+			absFile, err := resolveTrackPathIn(dirs, path)
+			if err != nil {
+				continue
+			}
+			playlist.Entries = append(playlist.Entries, newPlaylistEntry(absFile))
+		}
+		playlist.syncTracks()
+		result = appendPlaylist(state, playlist)
+		return nil
+	})
+	return result, err
+}
+
+func (s *Store) DeletePlaylist(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("playlist name is required")
+	}
+	if strings.EqualFold(name, FavoritesKey) {
+		return errors.New("playlist name is reserved")
+	}
+	_, err := s.updateWithSnapshot(SnapshotDeletePlaylist, func(state *State) error {
+		updated := make([]Playlist, 0, len(state.Playlists))
+		found := false
+		for _, playlist := range state.Playlists {
+			if strings.EqualFold(playlist.Name, name) {
+				found = true
+				continue
+			}
+			updated = append(updated, playlist)
+		}
+		if !found {
+			smartIndex := findSmartPlaylist(state.SmartPlaylists, name)
+			if smartIndex < 0 {
+				return errors.New("playlist not found")
+			}
+			state.SmartPlaylists = append(state.SmartPlaylists[:smartIndex], state.SmartPlaylists[smartIndex+1:]...)
+		}
+		if strings.EqualFold(state.ActivePlaylist, name) {
+			state.ActivePlaylist = ""
+		}
+		state.Playlists = updated
+		return nil
+	})
+	return err
+}
+
+func (s *Store) RenamePlaylist(name string, newName string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("playlist name is required")
+	}
+	if strings.EqualFold(name, FavoritesKey) {
+		return errors.New("playlist name is reserved")
+	}
+	newName, err := validatePlaylistName(newName)
+	if err != nil {
+		return err
+	}
+	_, err = s.Update(func(state *State) error {
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			return playlistNotFound(state, name)
+		}
+		if playlistNameInUse(state, newName, state.Playlists[index].ID) {
+			return errors.New("playlist already exists")
+		}
+		playlist := &state.Playlists[index]
+		if strings.EqualFold(state.ActivePlaylist, playlist.Name) {
+			state.ActivePlaylist = newName
+		}
+		playlist.Name = newName
+		playlist.touch()
+		return nil
+	})
+	return err
+}
+
+func (s *Store) DuplicatePlaylist(name string, newName string) (Playlist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Playlist{}, errors.New("playlist name is required")
+	}
+	newName, err := validatePlaylistName(newName)
+	if err != nil {
+		return Playlist{}, err
+	}
+	var result Playlist
+	_, err = s.Update(func(state *State) error {
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			return errors.New("playlist not found")
+		}
+		if playlistNameInUse(state, newName, "") {
+			return errors.New("playlist already exists")
+		}
+		source := state.Playlists[index]
+		copied := newPlaylist(newName)
+		copied.Description = source.Description
+		copied.CoverImage = source.CoverImage
+		for _, entry := range source.Entries {
+			copied.Entries = append(copied.Entries, newPlaylistEntry(entry.Path))
+		}
+		copied.FolderID = source.FolderID
+		copied.syncTracks()
+		result = appendPlaylist(state, copied)
+		return nil
+	})
+	return result, err
+}
+
+// MergePlaylists appends the entries of each source playlist, in order, to the
+// target playlist.
+func (s *Store) MergePlaylists(target string, sources []string, options MergeOptions) (Playlist, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return Playlist{}, errors.New("playlist name is required")
+	}
+	names := make([]string, 0, len(sources))
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if source == "" || strings.EqualFold(source, target) {
+			continue
+		}
+		if options.DeleteSources && strings.EqualFold(source, FavoritesKey) {
+			return Playlist{}, errors.New("playlist name is reserved")
+		}
+		names = append(names, source)
+	}
+	if len(names) == 0 {
+		return Playlist{}, errors.New("at least one source playlist is required")
+	}
+	var result Playlist
+	_, err := s.updateWithSnapshot(SnapshotMergePlaylists, func(state *State) error {
+		targetIndex := findPlaylist(state.Playlists, target)
+		if targetIndex < 0 {
+			return playlistNotFound(state, target)
+		}
+		merged := state.Playlists[targetIndex]
+		merged.Entries = append([]PlaylistEntry{}, merged.Entries...)
+		for _, name := range names {
+			index := findPlaylist(state.Playlists, name)
+			if index < 0 {
+				return errors.New("playlist not found: " + name)
+			}
+			for _, entry := range state.Playlists[index].Entries {
+				if options.Dedupe && merged.containsPath(entry.Path) {
+					continue
+				}
+				merged.Entries = append(merged.Entries, newPlaylistEntry(entry.Path))
+			}
+		}
+		merged.touch()
+		state.Playlists[targetIndex] = merged
+		if options.DeleteSources {
+			updated := make([]Playlist, 0, len(state.Playlists))
+			for _, playlist := range state.Playlists {
+				if containsFold(names, playlist.Name) {
+					if strings.EqualFold(state.ActivePlaylist, playlist.Name) {
+						state.ActivePlaylist = merged.Name
+					}
+					continue
+				}
+				updated = append(updated, playlist)
+			}
+			state.Playlists = updated
+		}
+		result = merged
+		return nil
+	})
+	return result, err
+}
+
+func (s *Store) UpdatePlaylistDetails(name string, description string, coverImage string) (Playlist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Playlist{}, errors.New("playlist name is required")
+	}
+	cover := strings.TrimSpace(coverImage)
+	if cover != "" {
+		resolved, err := resolveCoverImage(cover)
+		if err != nil {
+			return Playlist{}, err
+		}
+		cover = resolved
+	}
+	var result Playlist
+	_, err := s.Update(func(state *State) error {
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			return playlistNotFound(state, name)
+		}
+		playlist := &state.Playlists[index]
+		playlist.Description = strings.TrimSpace(description)
+		playlist.CoverImage = cover
+		playlist.touch()
+		result = *playlist
+		return nil
+	})
+	return result, err
+}
+
+// AddToPlaylist appends a track unless the playlist already contains it. Use
+// InsertIntoPlaylist to add a track more than once.
+func (s *Store) AddToPlaylist(name string, path string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("playlist name is required")
+	}
+	absFile, err := s.resolveTrackPath(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Update(func(state *State) error {
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			return playlistNotFound(state, name)
+		}
+		playlist := &state.Playlists[index]
+		if playlist.containsPath(absFile) {
+			return nil
+		}
+		playlist.Entries = append(playlist.Entries, newPlaylistEntry(absFile))
+		playlist.touch()
+		return nil
+	})
+	return err
+}
+
+// InsertIntoPlaylist adds a track at index, even if the playlist already
+// contains it. An index outside the playlist appends the track.
+func (s *Store) InsertIntoPlaylist(name string, path string, index int) (PlaylistEntry, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return PlaylistEntry{}, errors.New("playlist name is required")
+	}
+	absFile, err := s.resolveTrackPath(path)
+	if err != nil {
+		return PlaylistEntry{}, err
+	}
+	entry := newPlaylistEntry(absFile)
+	_, err = s.Update(func(state *State) error {
+		playlistIndex := findPlaylist(state.Playlists, name)
+		if playlistIndex < 0 {
+			return playlistNotFound(state, name)
+		}
+		playlist := &state.Playlists[playlistIndex]
+		playlist.Entries = insertAt(playlist.Entries, entry, index)
+		playlist.touch()
+		return nil
+	})
+	if err != nil {
+		return PlaylistEntry{}, err
+	}
+	return entry, nil
+}
+
+// RemoveFromPlaylist removes every entry for path.
+func (s *Store) RemoveFromPlaylist(name string, path string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("playlist name is required")
+	}
+	absFile, err := s.resolveTrackPath(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.updateWithSnapshot(SnapshotRemoveTracks, func(state *State) error {
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			return playlistNotFound(state, name)
+		}
+		playlist := &state.Playlists[index]
+		updated := make([]PlaylistEntry, 0, len(playlist.Entries))
+		for _, entry := range playlist.Entries {
+			if strings.EqualFold(entry.Path, absFile) {
+				continue
+			}
+			updated = append(updated, entry)
+		}
+		if len(updated) == len(playlist.Entries) {
+			return errUnchanged
+		}
+		playlist.Entries = updated
+		playlist.touch()
+		return nil
+	})
+	return err
+}
+
+func (s *Store) RemovePlaylistEntry(name string, entryID string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("playlist name is required")
+	}
+	if entryID == "" {
+		return errors.New("entry id is required")
+	}
+	_, err := s.updateWithSnapshot(SnapshotRemoveTracks, func(state *State) error {
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			return playlistNotFound(state, name)
+		}
+		playlist := &state.Playlists[index]
+		entryIndex := playlist.entryIndex(entryID)
+		if entryIndex < 0 {
+			return errors.New("playlist entry not found")
+		}
+		playlist.Entries = append(playlist.Entries[:entryIndex], playlist.Entries[entryIndex+1:]...)
+		playlist.touch()
+		return nil
+	})
+	return err
+}
+
+// MovePlaylistEntry moves an entry so that it ends up at index. An index
+// outside the playlist moves the entry to the end.
+func (s *Store) MovePlaylistEntry(name string, entryID string, index int) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("playlist name is required")
+	}
+	if entryID == "" {
+		return errors.New("entry id is required")
+	}
+	_, err := s.Update(func(state *State) error {
+		playlistIndex := findPlaylist(state.Playlists, name)
+		if playlistIndex < 0 {
+			return playlistNotFound(state, name)
+		}
+		playlist := &state.Playlists[playlistIndex]
+		from := playlist.entryIndex(entryID)
+		if from < 0 {
+			return errors.New("playlist entry not found")
+		}
+		entry := playlist.Entries[from]
+		remaining := append(playlist.Entries[:from:from], playlist.Entries[from+1:]...)
+		playlist.Entries = insertAt(remaining, entry, index)
+		playlist.touch()
+		return nil
+	})
+	return err
+}
+
+// ReorderPlaylist rearranges the playlist to follow entryIDs, which must list
+// every entry exactly once.
+func (s *Store) ReorderPlaylist(name string, entryIDs []string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("playlist name is required")
+	}
+	_, err := s.Update(func(state *State) error {
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			return playlistNotFound(state, name)
+		}
+		playlist := &state.Playlists[index]
+		if len(entryIDs) != len(playlist.Entries) {
+			return errors.New("entry ids must list every playlist entry")
+		}
+		byID := make(map[string]PlaylistEntry, len(playlist.Entries))
+		for _, entry := range playlist.Entries {
+			byID[entry.ID] = entry
+		}
+		reordered := make([]PlaylistEntry, 0, len(entryIDs))
+		for _, id := range entryIDs {
+			entry, ok := byID[id]
+			if !ok {
+				return errors.New("entry ids must list every playlist entry")
+			}
+			delete(byID, id)
+			reordered = append(reordered, entry)
+		}
+		playlist.Entries = reordered
+		playlist.touch()
+		return nil
+	})
+	return err
+}
+
+func validatePlaylistName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("playlist name is required")
+	}
+	if strings.EqualFold(name, FavoritesKey) {
+		return "", errors.New("playlist name is reserved")
+	}
+	return name, nil
+}
+
+func findPlaylist(playlists []Playlist, name string) int {
+	for i, playlist := range playlists {
+		if strings.EqualFold(playlist.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func resolveCoverImage(path string) (string, error) {
+	if !IsCoverImage(path) {
+		return "", errors.New("unsupported cover image type")
+	}
+	abs, err := media.ResolveExistingPath(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", errors.New("cover image is not a file")
+	}
+	return abs, nil
+}
+
+// normalizePlaylists fills in the fields that older state files lack. IDs
+// given to legacy playlists and entries are derived from their content so
+// they stay stable across loads until the state is next saved.
+func normalizePlaylists(state *State) {
+	if state.Playlists == nil {
+		state.Playlists = []Playlist{}
+	}
+	ensureFavoritesPlaylist(state)
+	for i := range state.Playlists {
+		playlist := &state.Playlists[i]
+		if playlist.ID == "" {
+			playlist.ID = legacyID("playlist", playlist.Name)
+		}
+		if playlist.Entries == nil {
+			playlist.Entries = make([]PlaylistEntry, 0, len(playlist.Tracks))
+			for j, track := range playlist.Tracks {
+				playlist.Entries = append(playlist.Entries, PlaylistEntry{
+					ID:   legacyID("entry", playlist.ID, strconv.Itoa(j), track),
+					Path: track,
+				})
+			}
+		}
+		playlist.syncTracks()
+	}
+	normalizeFolders(state)
+}
+
+func ensureFavoritesPlaylist(state *State) {
+	if findPlaylist(state.Playlists, FavoritesKey) >= 0 {
+		return
+	}
+	favorites := Playlist{
+		ID:      legacyID("playlist", FavoritesKey),
+		Name:    FavoritesKey,
+		Entries: []PlaylistEntry{},
+		Tracks:  []string{},
+	}
+	state.Playlists = append([]Playlist{favorites}, state.Playlists...)
+}
+
+func newID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func legacyID(parts ...string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(strings.Join(parts, "\x00"))))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,211 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"LiteSound/internal/media"
+)
+
+// MusicRoot gives a music directory a stable identifier. Playlist entries
+// are saved relative to the root that contains them, so the same state
+// works on machines that mount the music under different paths.
+type MusicRoot struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+}
+
+// normalizeMusicRoots rebuilds MusicRoots from MusicDirs. Directories keep
+// the ID they already had; a directory that replaced one with the same
+// folder name inherits that ID, and any other directory gets an ID derived
+// from its folder name, which two machines naming their music folder alike
+// will agree on.
+func normalizeMusicRoots(state *State) {
+	previous := state.MusicRoots
+	roots := make([]MusicRoot, 0, len(state.MusicDirs))
+	taken := make(map[string]struct{}, len(state.MusicDirs))
+	used := make(map[int]struct{}, len(previous))
+	pending := make([]int, 0)
+	for i, dir := range state.MusicDirs {
+		roots = append(roots, MusicRoot{Path: dir})
+		for j, root := range previous {
+			if _, ok := used[j]; ok || !strings.EqualFold(root.Path, dir) || root.ID == "" {
+				continue
+			}
+			roots[i].ID = root.ID
+			used[j] = struct{}{}
+			taken[root.ID] = struct{}{}
+			break
+		}
+		if roots[i].ID == "" {
+			pending = append(pending, i)
+		}
+	}
+	for _, i := range pending {
+		base := filepath.Base(roots[i].Path)
+		for j, root := range previous {
+			if _, ok := used[j]; ok || root.ID == "" || !strings.EqualFold(filepath.Base(root.Path), base) {
+				continue
+			}
+			if _, ok := taken[root.ID]; ok {
+				continue
+			}
+			roots[i].ID = root.ID
+			used[j] = struct{}{}
+			taken[root.ID] = struct{}{}
+			break
+		}
+		if roots[i].ID == "" {
+			roots[i].ID = rootID(roots[i].Path, taken)
+			taken[roots[i].ID] = struct{}{}
+		}
+	}
+	state.MusicRoots = roots
+}
+
+func (s *Store) GetMusicRoots() ([]MusicRoot, error) {
+	state, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	roots := musicRootsFor(&state)
+	if roots == nil {
+		return []MusicRoot{}, nil
+	}
+	return roots, nil
+}
+
+// musicRootsFor returns the roots playlist paths are stored against. With no
+// configured directories that is the default music directory, matching
+// ResolveMusicDirs.
+func musicRootsFor(state *State) []MusicRoot {
+	if len(state.MusicRoots) > 0 {
+		return state.MusicRoots
+	}
+	dir, err := media.DefaultMusicDir()
+	if err != nil {
+		return nil
+	}
+	return []MusicRoot{{ID: rootID(dir, nil), Path: dir}}
+}
+
+func rootID(path string, taken map[string]struct{}) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(filepath.Base(path)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			builder.WriteRune(r)
+		} else if builder.Len() > 0 {
+			builder.WriteByte('-')
+		}
+	}
+	base := strings.Trim(builder.String(), "-")
+	if base == "" {
+		base = "root"
+	}
+	id := base
+	for n := 2; ; n++ {
+		if _, ok := taken[id]; !ok {
+			return id
+		}
+		id = base + "-" + strconv.Itoa(n)
+	}
+}
+
+// resolvePortableEntries turns root-relative entries read from disk into
+// absolute paths. An entry whose root is not configured here is looked up
+// under every current root; if the file is not found anywhere it stays
+// relative, with its root kept, so it is saved back unchanged.
+func resolvePortableEntries(state *State) {
+	roots := musicRootsFor(state)
+	for i := range state.Playlists {
+		playlist := &state.Playlists[i]
+		for j := range playlist.Entries {
+			entry := &playlist.Entries[j]
+			if entry.Root == "" {
+				continue
+			}
+			relative := filepath.FromSlash(entry.Path)
+			if resolved, ok := resolveRootRelative(roots, entry.Root, relative); ok {
+				entry.Path = resolved
+				entry.Root = ""
+			}
+		}
+		playlist.syncTracks()
+		if source := playlist.Source; source != nil && source.Root != "" {
+			if resolved, ok := resolveRootRelative(roots, source.Root, filepath.FromSlash(source.Dir)); ok {
+				source.Dir = resolved
+				source.Root = ""
+			}
+		}
+	}
+}
+
+func resolveRootRelative(roots []MusicRoot, id string, relative string) (string, bool) {
+	for _, root := range roots {
+		if root.ID == id {
+			return filepath.Join(root.Path, relative), true
+		}
+	}
+	for _, root := range roots {
+		candidate := filepath.Join(root.Path, relative)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// portableCopy returns a copy of state whose playlist entries and folder
+// sources are stored relative to the music root containing them. Paths
+// outside every root stay absolute. Tracks is dropped, as it would repeat
+// the entries as absolute paths; loading rebuilds it.
+func portableCopy(state State) State {
+	roots := musicRootsFor(&state)
+	playlists := make([]Playlist, len(state.Playlists))
+	for i, playlist := range state.Playlists {
+		entries := make([]PlaylistEntry, len(playlist.Entries))
+		for j, entry := range playlist.Entries {
+			if entry.Root == "" {
+				if root, relative, ok := relativeToRoot(roots, entry.Path); ok {
+					entry.Root = root
+					entry.Path = relative
+				}
+			}
+			entries[j] = entry
+		}
+		playlist.Entries = entries
+		playlist.Tracks = nil
+		if playlist.Source != nil && playlist.Source.Root == "" {
+			source := *playlist.Source
+			if root, relative, ok := relativeToRoot(roots, source.Dir); ok {
+				source.Root = root
+				source.Dir = relative
+			}
+			playlist.Source = &source
+		}
+		playlists[i] = playlist
+	}
+	state.Playlists = playlists
+	return state
+}
+
+// relativeToRoot finds the deepest root that lexically contains path.
+func relativeToRoot(roots []MusicRoot, path string) (string, string, bool) {
+	if !filepath.IsAbs(path) {
+		return "", "", false
+	}
+	bestID, bestRelative, bestLength := "", "", -1
+	for _, root := range roots {
+		relative, err := filepath.Rel(root.Path, path)
+		if err != nil || relative == "." || relative == ".." || strings.HasPrefix(relative, ".."+string(os.PathSeparator)) {
+			continue
+		}
+		if len(root.Path) > bestLength {
+			bestID, bestRelative, bestLength = root.ID, filepath.ToSlash(relative), len(root.Path)
+		}
+	}
+	return bestID, bestRelative, bestLength >= 0
+}
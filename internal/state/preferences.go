@@ -0,0 +1,205 @@
+package state
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// The smallest window the frontend's layout fits in.
+const (
+	MinWindowWidth  = 904
+	MinWindowHeight = 500
+)
+
+// Preferences are the app settings besides the theme. Values missing from
+// state.json take their defaults, and invalid ones are reset to them.
+type Preferences struct {
+	// CloseToTray hides the window instead of quitting when it is closed.
+	// It takes effect at the next start.
+	CloseToTray bool `json:"closeToTray"`
+	// WindowWidth and WindowHeight are the window's size at startup.
+	WindowWidth  int `json:"windowWidth"`
+	WindowHeight int `json:"windowHeight"`
+	// Language is a BCP 47 tag such as "en" or "zh-CN", or "system" to
+	// follow the system language.
+	Language string `json:"language"`
+	// ScanSkipHidden leaves files and folders whose names start with a dot
+	// out of library scans.
+	ScanSkipHidden bool `json:"scanSkipHidden"`
+	// ScanMinDuration leaves tracks shorter than this many seconds out of
+	// library scans; 0 keeps every track.
+	ScanMinDuration int `json:"scanMinDuration"`
+	// RatingTags reads ratings and play counts from file tags during
+	// library scans and writes them back when they change. Only MP3, FLAC
+	// and Ogg files have such tags; other formats keep them in the store.
+	RatingTags bool `json:"ratingTags"`
+	// StartMinimized starts the app with its window minimized.
+	StartMinimized bool `json:"startMinimized"`
+	// CheckForUpdates looks for a new release shortly after startup.
+	CheckForUpdates bool `json:"checkForUpdates"`
+}
+
+func DefaultPreferences() Preferences {
+	return Preferences{
+		CloseToTray:     true,
+		WindowWidth:     1024,
+		WindowHeight:    768,
+		Language:        "system",
+		CheckForUpdates: true,
+	}
+}
+
+// preference describes one entry of Preferences: get reads it and set
+// validates a value and stores it. Values arrive as decoded from JSON, so
+// numbers are float64.
+type preference struct {
+	key string
+	get func(p *Preferences) any
+	set func(p *Preferences, value any) error
+}
+
+var preferences = []preference{
+	boolPreference("closeToTray", func(p *Preferences) *bool { return &p.CloseToTray }),
+	intPreference("windowWidth", MinWindowWidth, 16384, func(p *Preferences) *int { return &p.WindowWidth }),
+	intPreference("windowHeight", MinWindowHeight, 16384, func(p *Preferences) *int { return &p.WindowHeight }),
+	stringPreference("language", normalizeLanguage, func(p *Preferences) *string { return &p.Language }),
+	boolPreference("scanSkipHidden", func(p *Preferences) *bool { return &p.ScanSkipHidden }),
+	intPreference("scanMinDuration", 0, 3600, func(p *Preferences) *int { return &p.ScanMinDuration }),
+	boolPreference("ratingTags", func(p *Preferences) *bool { return &p.RatingTags }),
+	boolPreference("startMinimized", func(p *Preferences) *bool { return &p.StartMinimized }),
+	boolPreference("checkForUpdates", func(p *Preferences) *bool { return &p.CheckForUpdates }),
+}
+
+func boolPreference(key string, field func(p *Preferences) *bool) preference {
+	return preference{
+		key: key,
+		get: func(p *Preferences) any { return *field(p) },
+		set: func(p *Preferences, value any) error {
+			b, ok := value.(bool)
+			if !ok {
+				return errors.New(key + " must be true or false")
+			}
+			*field(p) = b
+			return nil
+		},
+	}
+}
+
+func intPreference(key string, minValue int, maxValue int, field func(p *Preferences) *int) preference {
+	return preference{
+		key: key,
+		get: func(p *Preferences) any { return *field(p) },
+		set: func(p *Preferences, value any) error {
+			var n float64
+			switch v := value.(type) {
+			case int:
+				n = float64(v)
+			case float64:
+				n = v
+			default:
+				return errors.New(key + " must be a number")
+			}
+			if n != math.Trunc(n) || n < float64(minValue) || n > float64(maxValue) {
+				return errors.New(key + " is out of range")
+			}
+			*field(p) = int(n)
+			return nil
+		},
+	}
+}
+
+func stringPreference(key string, normalize func(string) (string, error), field func(p *Preferences) *string) preference {
+	return preference{
+		key: key,
+		get: func(p *Preferences) any { return *field(p) },
+		set: func(p *Preferences, value any) error {
+			s, ok := value.(string)
+			if !ok {
+				return errors.New(key + " must be a string")
+			}
+			normalized, err := normalize(s)
+			if err != nil {
+				return err
+			}
+			*field(p) = normalized
+			return nil
+		},
+	}
+}
+
+// normalizeLanguage accepts "system" or a tag of letter and digit subtags
+// separated by hyphens, casing the language and region subtags the usual
+// way, as in "zh-CN".
+func normalizeLanguage(language string) (string, error) {
+	language = strings.ReplaceAll(strings.TrimSpace(language), "_", "-")
+	if language == "" || strings.EqualFold(language, "system") {
+		return "system", nil
+	}
+	subtags := strings.Split(language, "-")
+	for i, subtag := range subtags {
+		if len(subtag) < 1 || len(subtag) > 8 {
+			return "", errors.New("invalid language")
+		}
+		for _, r := range subtag {
+			if r >= unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) || (i == 0 && !unicode.IsLetter(r)) {
+				return "", errors.New("invalid language")
+			}
+		}
+	}
+	if len(subtags[0]) < 2 || len(subtags[0]) > 3 {
+		return "", errors.New("invalid language")
+	}
+	subtags[0] = strings.ToLower(subtags[0])
+	for i := 1; i < len(subtags); i++ {
+		if len(subtags[i]) == 2 {
+			subtags[i] = strings.ToUpper(subtags[i])
+		}
+	}
+	return strings.Join(subtags, "-"), nil
+}
+
+func findPreference(key string) *preference {
+	for i := range preferences {
+		if preferences[i].key == key {
+			return &preferences[i]
+		}
+	}
+	return nil
+}
+
+// normalize resets invalid values, such as ones edited into state.json by
+// hand, to their defaults.
+func (p *Preferences) normalize() {
+	defaults := DefaultPreferences()
+	for _, preference := range preferences {
+		if err := preference.set(p, preference.get(p)); err != nil {
+			_ = preference.set(p, preference.get(&defaults))
+		}
+	}
+}
+
+func (s *Store) GetPreferences() (Preferences, error) {
+	state, err := s.Load()
+	if err != nil {
+		return DefaultPreferences(), err
+	}
+	return state.Preferences, nil
+}
+
+// SetPreference validates value and stores it under key, one of the JSON
+// names of the Preferences fields. It returns all preferences.
+func (s *Store) SetPreference(key string, value any) (Preferences, error) {
+	preference := findPreference(key)
+	if preference == nil {
+		return Preferences{}, errors.New("unknown preference: " + key)
+	}
+	updated, err := s.Update(func(state *State) error {
+		return preference.set(&state.Preferences, value)
+	})
+	if err != nil {
+		return Preferences{}, err
+	}
+	return updated.Preferences, nil
+}
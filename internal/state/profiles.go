@@ -0,0 +1,315 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultProfileID is the profile whose state is the data directory's own
+// state.json. It always exists and cannot be deleted.
+const DefaultProfileID = "default"
+
+// Profile is a named set of state. Every profile but the default one keeps
+// its state.json, backup and snapshots in profiles/<id> under the data
+// directory. Profiles with SharedRoots use the same music directories;
+// the others keep their own.
+type Profile struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	SharedRoots bool   `json:"sharedRoots"`
+	CreatedAt   int64  `json:"createdAt"`
+	Active      bool   `json:"active"`
+}
+
+// profileFile is the content of profiles.json. SharedRoots holds the music
+// directories of the shared-root profiles as of the last switch away from
+// one of them.
+type profileFile struct {
+	Active      string      `json:"active"`
+	Profiles    []Profile   `json:"profiles"`
+	SharedRoots []MusicRoot `json:"sharedRoots"`
+}
+
+func (s *Store) baseDir() (string, error) {
+	if s.dataDir.Path != "" {
+		return s.dataDir.Path, nil
+	}
+	return DefaultDataDir(s.appName)
+}
+
+// profileDir returns the directory holding a profile's state.json.
+func profileDir(base string, id string) string {
+	if id == "" || id == DefaultProfileID {
+		return base
+	}
+	return filepath.Join(base, "profiles", id)
+}
+
+// activeProfile returns the ID of the profile in use, reading it from
+// profiles.json the first time.
+func (s *Store) activeProfile(base string) string {
+	s.profileMu.Lock()
+	defer s.profileMu.Unlock()
+	if !s.profileResolved {
+		s.profile = DefaultProfileID
+		if file, err := readProfiles(base); err == nil && findProfile(file.Profiles, file.Active) >= 0 {
+			s.profile = file.Active
+		}
+		s.profileResolved = true
+	}
+	return s.profile
+}
+
+func (s *Store) setActiveProfile(id string) {
+	s.profileMu.Lock()
+	defer s.profileMu.Unlock()
+	s.profile = id
+	s.profileResolved = true
+}
+
+// readProfiles reads profiles.json. Without one there is just the default
+// profile, which shares its roots.
+func readProfiles(base string) (profileFile, error) {
+	file := profileFile{}
+	data, err := os.ReadFile(filepath.Join(base, "profiles.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return file, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &file); err != nil {
+			return profileFile{}, err
+		}
+	}
+	if findProfile(file.Profiles, DefaultProfileID) < 0 {
+		file.Profiles = append([]Profile{{ID: DefaultProfileID, Name: "Default", SharedRoots: true}}, file.Profiles...)
+	}
+	if findProfile(file.Profiles, file.Active) < 0 {
+		file.Active = DefaultProfileID
+	}
+	for i := range file.Profiles {
+		file.Profiles[i].Active = false
+	}
+	return file, nil
+}
+
+func writeProfiles(base string, file profileFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(base, "profiles.json"), data)
+}
+
+func findProfile(profiles []Profile, id string) int {
+	for i, profile := range profiles {
+		if profile.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// ListProfiles returns the profiles in the order they were created, the
+// default one first, with the one in use marked active.
+func (s *Store) ListProfiles() ([]Profile, error) {
+	base, err := s.baseDir()
+	if err != nil {
+		return nil, err
+	}
+	file, err := readProfiles(base)
+	if err != nil {
+		return nil, err
+	}
+	active := s.activeProfile(base)
+	for i := range file.Profiles {
+		file.Profiles[i].Active = file.Profiles[i].ID == active
+	}
+	return file.Profiles, nil
+}
+
+// ActiveProfile returns the profile in use.
+func (s *Store) ActiveProfile() (Profile, error) {
+	profiles, err := s.ListProfiles()
+	if err != nil {
+		return Profile{}, err
+	}
+	for _, profile := range profiles {
+		if profile.Active {
+			return profile, nil
+		}
+	}
+	return Profile{}, errors.New("profile not found")
+}
+
+// CreateProfile adds a profile with empty state. With sharedRoots it will
+// use the same music directories as the other shared-root profiles.
+func (s *Store) CreateProfile(name string, sharedRoots bool) (Profile, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Profile{}, errors.New("profile name is required")
+	}
+	base, err := s.baseDir()
+	if err != nil {
+		return Profile{}, err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	file, err := readProfiles(base)
+	if err != nil {
+		return Profile{}, err
+	}
+	taken := make(map[string]struct{}, len(file.Profiles))
+	for _, profile := range file.Profiles {
+		if strings.EqualFold(profile.Name, name) {
+			return Profile{}, errors.New("profile already exists")
+		}
+		taken[profile.ID] = struct{}{}
+	}
+	profile := Profile{
+		ID:          profileID(name, taken),
+		Name:        name,
+		SharedRoots: sharedRoots,
+		CreatedAt:   time.Now().UnixMilli(),
+	}
+	if err := os.MkdirAll(profileDir(base, profile.ID), 0o755); err != nil {
+		return Profile{}, err
+	}
+	file.Profiles = append(file.Profiles, profile)
+	if err := writeProfiles(base, file); err != nil {
+		return Profile{}, err
+	}
+	return profile, nil
+}
+
+// SwitchProfile writes out the current profile's pending changes and makes
+// id the profile in use, returning its state. Music directories of a
+// shared-root profile carry over to the next shared-root profile used.
+func (s *Store) SwitchProfile(id string) (State, error) {
+	base, err := s.baseDir()
+	if err != nil {
+		return State{}, err
+	}
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	if err := s.Flush(); err != nil {
+		return State{}, err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := readProfiles(base)
+	if err != nil {
+		return State{}, err
+	}
+	index := findProfile(file.Profiles, id)
+	if index < 0 {
+		return State{}, errors.New("profile not found")
+	}
+	target := file.Profiles[index]
+	current := s.activeProfile(base)
+	if current == id {
+		if err := s.ensureLoaded(); err != nil {
+			return State{}, err
+		}
+		return s.state.clone(), nil
+	}
+	if i := findProfile(file.Profiles, current); i >= 0 && file.Profiles[i].SharedRoots {
+		if err := s.ensureLoaded(); err != nil {
+			return State{}, err
+		}
+		file.SharedRoots = slices.Clone(s.state.MusicRoots)
+	}
+	file.Active = id
+	if err := writeProfiles(base, file); err != nil {
+		return State{}, err
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	previous := s.state
+	s.setActiveProfile(id)
+	s.loaded = false
+	s.dirty = false
+	s.recovery = nil
+	s.recoveryPending = false
+	if err := s.ensureLoaded(); err != nil {
+		return State{}, err
+	}
+	if target.SharedRoots && file.SharedRoots != nil && !slices.Equal(s.state.MusicRoots, file.SharedRoots) {
+		s.state.MusicDir = ""
+		s.state.MusicRoots = slices.Clone(file.SharedRoots)
+		s.state.MusicDirs = make([]string, 0, len(file.SharedRoots))
+		for _, root := range file.SharedRoots {
+			s.state.MusicDirs = append(s.state.MusicDirs, root.Path)
+		}
+		normalizeMusicRoots(&s.state)
+		resolvePortableEntries(&s.state)
+		s.markDirty()
+	}
+	s.publish(&previous, &s.state, ChangeFromApp)
+	return s.state.clone(), nil
+}
+
+// DeleteProfile removes a profile and its files. The default profile and
+// the one in use cannot be deleted.
+func (s *Store) DeleteProfile(id string) error {
+	if id == DefaultProfileID {
+		return errors.New("cannot delete the default profile")
+	}
+	base, err := s.baseDir()
+	if err != nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.activeProfile(base) == id {
+		return errors.New("cannot delete the active profile")
+	}
+	file, err := readProfiles(base)
+	if err != nil {
+		return err
+	}
+	index := findProfile(file.Profiles, id)
+	if index < 0 {
+		return errors.New("profile not found")
+	}
+	file.Profiles = append(file.Profiles[:index], file.Profiles[index+1:]...)
+	if err := writeProfiles(base, file); err != nil {
+		return err
+	}
+	return os.RemoveAll(profileDir(base, id))
+}
+
+// profileID derives a directory-safe ID from a profile name, numbering it
+// when taken.
+func profileID(name string, taken map[string]struct{}) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			builder.WriteRune(r)
+		} else if builder.Len() > 0 {
+			builder.WriteByte('-')
+		}
+	}
+	base := strings.Trim(builder.String(), "-")
+	if base == "" {
+		base = "profile"
+	}
+	id := base
+	for n := 2; ; n++ {
+		if _, ok := taken[id]; !ok {
+			return id
+		}
+		id = base + "-" + strconv.Itoa(n)
+	}
+}
@@ -0,0 +1,150 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	RecoveredFromBackup   = "backup"
+	RecoveredFromSnapshot = "snapshot"
+	RecoveredFromDefaults = "defaults"
+)
+
+// Recovery describes how an unreadable state.json was replaced. Quarantined
+// is where the bad file was moved, Source where the state came from
+// instead, and Snapshot the snapshot ID when Source is "snapshot".
+type Recovery struct {
+	Quarantined string `json:"quarantined"`
+	Source      string `json:"source"`
+	Snapshot    string `json:"snapshot"`
+	Error       string `json:"error"`
+	RecoveredAt int64  `json:"recoveredAt"`
+}
+
+// GetRecovery returns the recovery performed since the store was created,
+// or nil if state.json loaded normally.
+func (s *Store) GetRecovery() *Recovery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.recovery == nil {
+		return nil
+	}
+	recovery := *s.recovery
+	return &recovery
+}
+
+// SetRecoveryHandler registers fn to be told about a recovery. A recovery
+// that happened before fn was registered is reported at once.
+func (s *Store) SetRecoveryHandler(fn func(Recovery)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onRecovery = fn
+	if fn != nil && s.recoveryPending && s.recovery != nil {
+		s.recoveryPending = false
+		go fn(*s.recovery)
+	}
+}
+
+func (s *Store) backupFilePath() (string, error) {
+	statePath, err := s.stateFilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(statePath), "state.backup.json"), nil
+}
+
+// loadFromDisk reads state.json. A file that reads but is empty or does not
+// parse is moved aside and the state recovered from the newest readable backup or
+// snapshot, or from defaults; a file that parses is kept as the backup for
+// next time. The caller must hold mu for writing.
+func (s *Store) loadFromDisk() (State, error) {
+	statePath, err := s.stateFilePath()
+	if err != nil {
+		return State{}, err
+	}
+	data, err := os.ReadFile(statePath)
+	missing := os.IsNotExist(err)
+	if err != nil && !missing {
+		return State{}, err
+	}
+	s.stamp = stampFile(statePath)
+	state, decodeErr := decodeState(data)
+	// An empty file is what a crash or a full disk usually leaves behind,
+	// so it is recovered rather than read as a fresh start.
+	if decodeErr == nil && !missing && len(data) == 0 {
+		decodeErr = errors.New("state file is empty")
+	}
+	if decodeErr == nil {
+		if len(data) > 0 {
+			if backupPath, err := s.backupFilePath(); err == nil {
+				_ = writeFileAtomic(backupPath, data)
+			}
+		}
+		return state, nil
+	}
+
+	quarantined := strings.TrimSuffix(statePath, ".json") + ".corrupt-" + time.Now().Format("20060102-150405") + ".json"
+	if err := os.Rename(statePath, quarantined); err != nil {
+		return State{}, err
+	}
+	recovery := Recovery{
+		Quarantined: quarantined,
+		Error:       decodeErr.Error(),
+		RecoveredAt: time.Now().UnixMilli(),
+	}
+	state, recovery.Source, recovery.Snapshot = s.recoverState()
+	s.recovery = &recovery
+	s.recoveryPending = true
+	if s.onRecovery != nil {
+		s.recoveryPending = false
+		go s.onRecovery(recovery)
+	}
+	s.markDirty()
+	return state, nil
+}
+
+// recoverState returns the newest state among the backup and the snapshots
+// that still decodes, falling back to the default state.
+func (s *Store) recoverState() (State, string, string) {
+	type candidate struct {
+		at       int64
+		source   string
+		snapshot string
+		path     string
+	}
+	candidates := make([]candidate, 0)
+	if backupPath, err := s.backupFilePath(); err == nil {
+		if info, err := os.Stat(backupPath); err == nil {
+			candidates = append(candidates, candidate{at: info.ModTime().UnixMilli(), source: RecoveredFromBackup, path: backupPath})
+		}
+	}
+	if dir, err := s.snapshotDir(); err == nil {
+		if snapshots, err := s.listSnapshots(); err == nil {
+			for _, snapshot := range snapshots {
+				candidates = append(candidates, candidate{
+					at:       snapshot.CreatedAt,
+					source:   RecoveredFromSnapshot,
+					snapshot: snapshot.ID,
+					path:     filepath.Join(dir, snapshot.ID+".json"),
+				})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].at > candidates[j].at })
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate.path)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		if state, err := decodeState(data); err == nil {
+			return state, candidate.source, candidate.snapshot
+		}
+	}
+	state, _ := decodeState(nil)
+	return state, RecoveredFromDefaults, ""
+}
@@ -0,0 +1,574 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Sections of the state that settings archives carry.
+const (
+	SettingsMusicDirs   = "musicDirs"
+	SettingsTheme       = "theme"
+	SettingsFilters     = "filters"
+	SettingsPlaylists   = "playlists"
+	SettingsExclusions  = "exclusions"
+	SettingsStats       = "stats"
+	SettingsPreferences = "preferences"
+)
+
+// SettingsSections lists every section in the order they are applied.
+var SettingsSections = []string{
+	SettingsMusicDirs,
+	SettingsTheme,
+	SettingsFilters,
+	SettingsPlaylists,
+	SettingsExclusions,
+	SettingsStats,
+	SettingsPreferences,
+}
+
+// Import modes. Replace overwrites each imported section; merge adds to it.
+const (
+	SettingsReplace = "replace"
+	SettingsMerge   = "merge"
+)
+
+const (
+	settingsFormat  = "litesound-settings"
+	settingsVersion = 1
+)
+
+// settingsArchive is the file ExportSettings writes. State is in state.json
+// form, with playlist entries relative to its music roots, and only holds
+// the listed sections; the roots are always included so entries resolve
+// even when the music directories are not imported.
+type settingsArchive struct {
+	Format       string          `json:"format"`
+	Version      int             `json:"version"`
+	StateVersion int             `json:"stateVersion"`
+	ExportedAt   int64           `json:"exportedAt"`
+	Sections     []string        `json:"sections"`
+	State        json.RawMessage `json:"state"`
+}
+
+// PathRemap rewrites paths starting with From to start with To instead.
+type PathRemap struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type SettingsImportOptions struct {
+	// Mode is SettingsReplace or SettingsMerge; empty means merge.
+	Mode string `json:"mode"`
+	// Sections limits the import to some of the archive's sections; empty
+	// imports all of them.
+	Sections []string    `json:"sections"`
+	Remap    []PathRemap `json:"remap"`
+}
+
+type SettingsImportResult struct {
+	Sections          []string `json:"sections"`
+	MusicDirs         []string `json:"musicDirs"`
+	PlaylistsCreated  []string `json:"playlistsCreated"`
+	PlaylistsUpdated  []string `json:"playlistsUpdated"`
+	UnresolvedEntries int      `json:"unresolvedEntries"`
+	StatsUpdated      int      `json:"statsUpdated"`
+}
+
+// ExportSettings writes the chosen sections of the state to path as a
+// settings archive. No sections means all of them.
+func (s *Store) ExportSettings(path string, sections []string) error {
+	if strings.TrimSpace(path) == "" {
+		return errors.New("destination is required")
+	}
+	sections, err := normalizeSections(sections, SettingsSections)
+	if err != nil {
+		return err
+	}
+	state, err := s.Load()
+	if err != nil {
+		return err
+	}
+	exported := State{
+		Version:    currentStateVersion,
+		MusicDirs:  state.MusicDirs,
+		MusicRoots: musicRootsFor(&state),
+	}
+	for _, section := range sections {
+		switch section {
+		case SettingsTheme:
+			exported.Theme = state.Theme
+		case SettingsFilters:
+			exported.ComposerFilter = state.ComposerFilter
+			exported.AlbumFilter = state.AlbumFilter
+		case SettingsPlaylists:
+			exported.Playlists = state.Playlists
+			exported.PlaylistFolders = state.PlaylistFolders
+			exported.SmartPlaylists = state.SmartPlaylists
+			exported.ActivePlaylist = state.ActivePlaylist
+		case SettingsExclusions:
+			exported.Exclusions = state.Exclusions
+		case SettingsStats:
+			exported.TrackStats = state.TrackStats
+		case SettingsPreferences:
+			exported.Preferences = state.Preferences
+		}
+	}
+	encoded, err := json.Marshal(portableCopy(exported))
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settingsArchive{
+		Format:       settingsFormat,
+		Version:      settingsVersion,
+		StateVersion: currentStateVersion,
+		ExportedAt:   time.Now().UnixMilli(),
+		Sections:     sections,
+		State:        encoded,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// ImportSettings reads a settings archive and applies it. The whole archive
+// is checked first, including that imported music directories exist after
+// remapping, so a bad archive changes nothing. The state is snapshotted
+// before it is changed. With dryRun set nothing is saved and the result
+// describes what would change.
+func (s *Store) ImportSettings(path string, options SettingsImportOptions, dryRun bool) (SettingsImportResult, error) {
+	archive, sections, err := readSettingsArchive(path, options)
+	if err != nil {
+		return SettingsImportResult{}, err
+	}
+	mode := strings.ToLower(strings.TrimSpace(options.Mode))
+	switch mode {
+	case "":
+		mode = SettingsMerge
+	case SettingsReplace, SettingsMerge:
+	default:
+		return SettingsImportResult{}, errors.New("mode must be replace or merge")
+	}
+	if err := validateSettings(&archive, sections); err != nil {
+		return SettingsImportResult{}, err
+	}
+	var result SettingsImportResult
+	if dryRun {
+		state, err := s.Load()
+		if err != nil {
+			return SettingsImportResult{}, err
+		}
+		return applySettings(&state, archive, sections, mode), nil
+	}
+	_, err = s.updateWithSnapshot(SnapshotImportSettings, func(state *State) error {
+		result = applySettings(state, archive, sections, mode)
+		return nil
+	})
+	return result, err
+}
+
+// readSettingsArchive decodes an archive, migrates its state and applies
+// the path remapping. It returns the sections to import.
+func readSettingsArchive(path string, options SettingsImportOptions) (State, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return State{}, nil, err
+	}
+	var archive settingsArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return State{}, nil, err
+	}
+	if archive.Format != settingsFormat {
+		return State{}, nil, errors.New("not a settings archive")
+	}
+	if archive.Version > settingsVersion {
+		return State{}, nil, errors.New("settings archive is from a newer version")
+	}
+	available, err := normalizeSections(archive.Sections, SettingsSections)
+	if err != nil {
+		return State{}, nil, err
+	}
+	sections := available
+	if len(options.Sections) > 0 {
+		sections, err = normalizeSections(options.Sections, available)
+		if err != nil {
+			return State{}, nil, err
+		}
+	}
+	if len(archive.State) == 0 {
+		return State{}, nil, errors.New("settings archive has no state")
+	}
+	migrated, err := migrateState(archive.State)
+	if err != nil {
+		return State{}, nil, err
+	}
+	state := State{Preferences: DefaultPreferences()}
+	if err := json.Unmarshal(migrated, &state); err != nil {
+		return State{}, nil, err
+	}
+	remapPaths(&state, options.Remap)
+	return state, sections, nil
+}
+
+// normalizeSections checks sections against allowed and returns them in
+// the order of SettingsSections, without duplicates. No sections means all
+// allowed ones.
+func normalizeSections(sections []string, allowed []string) ([]string, error) {
+	if len(sections) == 0 {
+		return slices.Clone(allowed), nil
+	}
+	wanted := make(map[string]struct{}, len(sections))
+	for _, section := range sections {
+		section = strings.TrimSpace(section)
+		if !slices.Contains(allowed, section) {
+			if slices.Contains(SettingsSections, section) {
+				return nil, errors.New("section not in settings archive: " + section)
+			}
+			return nil, errors.New("unknown settings section: " + section)
+		}
+		wanted[section] = struct{}{}
+	}
+	normalized := make([]string, 0, len(wanted))
+	for _, section := range SettingsSections {
+		if _, ok := wanted[section]; ok {
+			normalized = append(normalized, section)
+		}
+	}
+	return normalized, nil
+}
+
+func validateSettings(archive *State, sections []string) error {
+	for _, section := range sections {
+		switch section {
+		case SettingsMusicDirs:
+			for _, dir := range archive.MusicDirs {
+				info, err := os.Stat(dir)
+				if err != nil || !info.IsDir() {
+					return errors.New("music directory not found: " + dir)
+				}
+			}
+		case SettingsTheme:
+			theme, err := NormalizeTheme(archive.Theme)
+			if err != nil {
+				return err
+			}
+			archive.Theme = theme
+		case SettingsPreferences:
+			archive.Preferences.normalize()
+		case SettingsPlaylists:
+			seen := make(map[string]struct{}, len(archive.Playlists)+len(archive.SmartPlaylists))
+			for i := range archive.Playlists {
+				name := archive.Playlists[i].Name
+				if name != FavoritesKey {
+					validated, err := validatePlaylistName(name)
+					if err != nil {
+						return err
+					}
+					name = validated
+				}
+				key := strings.ToLower(name)
+				if _, ok := seen[key]; ok {
+					return errors.New("duplicate playlist in settings archive: " + name)
+				}
+				seen[key] = struct{}{}
+				archive.Playlists[i].Name = name
+			}
+			for i := range archive.SmartPlaylists {
+				definition, err := normalizeSmartPlaylist(archive.SmartPlaylists[i])
+				if err != nil {
+					return err
+				}
+				key := strings.ToLower(definition.Name)
+				if _, ok := seen[key]; ok {
+					return errors.New("duplicate playlist in settings archive: " + definition.Name)
+				}
+				seen[key] = struct{}{}
+				archive.SmartPlaylists[i] = definition
+			}
+		}
+	}
+	return nil
+}
+
+func applySettings(state *State, archive State, sections []string, mode string) SettingsImportResult {
+	result := SettingsImportResult{
+		Sections:         sections,
+		PlaylistsCreated: []string{},
+		PlaylistsUpdated: []string{},
+	}
+	replace := mode == SettingsReplace
+	archive = archive.clone()
+	for _, section := range sections {
+		switch section {
+		case SettingsMusicDirs:
+			if replace {
+				state.MusicDirs = archive.MusicDirs
+				state.MusicRoots = archive.MusicRoots
+			} else {
+				for _, dir := range archive.MusicDirs {
+					if !containsString(state.MusicDirs, dir) {
+						state.MusicDirs = append(state.MusicDirs, dir)
+						if root := findRootByPath(archive.MusicRoots, dir); root != nil {
+							state.MusicRoots = append(state.MusicRoots, *root)
+						}
+					}
+				}
+			}
+			state.MusicDir = ""
+			normalizeMusicRoots(state)
+		case SettingsTheme:
+			state.Theme = archive.Theme
+		case SettingsPreferences:
+			state.Preferences = archive.Preferences
+		case SettingsFilters:
+			state.ComposerFilter = archive.ComposerFilter
+			state.AlbumFilter = archive.AlbumFilter
+		case SettingsPlaylists:
+			applyPlaylistSettings(state, archive, replace, &result)
+		case SettingsExclusions:
+			if replace {
+				state.Exclusions = archive.Exclusions
+			} else {
+				state.Exclusions.HiddenTracks = unionStrings(state.Exclusions.HiddenTracks, archive.Exclusions.HiddenTracks)
+				state.Exclusions.HiddenAlbums = unionStrings(state.Exclusions.HiddenAlbums, archive.Exclusions.HiddenAlbums)
+				state.Exclusions.SkipShuffleTracks = unionStrings(state.Exclusions.SkipShuffleTracks, archive.Exclusions.SkipShuffleTracks)
+				state.Exclusions.SkipShuffleAlbums = unionStrings(state.Exclusions.SkipShuffleAlbums, archive.Exclusions.SkipShuffleAlbums)
+			}
+			state.Exclusions.normalize()
+		case SettingsStats:
+			if replace {
+				state.TrackStats = archive.TrackStats
+				result.StatsUpdated = len(archive.TrackStats)
+			} else {
+				result.StatsUpdated = mergeLibrary(state, LibraryMerge{Stats: archive.TrackStats}, nil).StatsUpdated
+			}
+		}
+	}
+	if state.MusicDirs == nil {
+		state.MusicDirs = []string{}
+	}
+	if state.SmartPlaylists == nil {
+		state.SmartPlaylists = []SmartPlaylist{}
+	}
+	if state.TrackStats == nil {
+		state.TrackStats = map[string]TrackStats{}
+	}
+	result.MusicDirs = slices.Clone(state.MusicDirs)
+	return result
+}
+
+// applyPlaylistSettings brings in the archive's playlists, folders and smart
+// playlists. Entries are resolved against this state's music roots first,
+// so roots with the same ID on both machines line up, and then against the
+// archive's own (remapped) roots.
+func applyPlaylistSettings(state *State, archive State, replace bool, result *SettingsImportResult) {
+	roots := slices.Clone(musicRootsFor(state))
+	for _, root := range archive.MusicRoots {
+		if !slices.ContainsFunc(roots, func(existing MusicRoot) bool { return existing.ID == root.ID }) {
+			roots = append(roots, root)
+		}
+	}
+	playlists := make([]Playlist, 0, len(archive.Playlists))
+	for _, playlist := range archive.Playlists {
+		for i := range playlist.Entries {
+			entry := &playlist.Entries[i]
+			if entry.Root == "" {
+				continue
+			}
+			if resolved, ok := resolveRootRelative(roots, entry.Root, filepath.FromSlash(entry.Path)); ok {
+				entry.Path = resolved
+				entry.Root = ""
+			} else {
+				result.UnresolvedEntries++
+			}
+		}
+		if source := playlist.Source; source != nil && source.Root != "" {
+			if resolved, ok := resolveRootRelative(roots, source.Root, filepath.FromSlash(source.Dir)); ok {
+				source.Dir = resolved
+				source.Root = ""
+			}
+		}
+		playlist.syncTracks()
+		playlists = append(playlists, playlist)
+	}
+
+	if replace {
+		state.Playlists = playlists
+		state.PlaylistFolders = archive.PlaylistFolders
+		state.SmartPlaylists = archive.SmartPlaylists
+		state.ActivePlaylist = archive.ActivePlaylist
+		for _, playlist := range playlists {
+			if playlist.Name != FavoritesKey {
+				result.PlaylistsCreated = append(result.PlaylistsCreated, playlist.Name)
+			}
+		}
+		normalizePlaylists(state)
+		return
+	}
+
+	folderIDs := make(map[string]string, len(archive.PlaylistFolders))
+	for _, folder := range archive.PlaylistFolders {
+		folderIDs[folder.ID] = ""
+	}
+	// Folders are added parents first so a child can find its parent's ID.
+	for pending := slices.Clone(archive.PlaylistFolders); len(pending) > 0; {
+		next := pending[:0]
+		for _, folder := range pending {
+			parentID, known := folderIDs[folder.ParentID]
+			if folder.ParentID != "" && known && parentID == "" {
+				next = append(next, folder)
+				continue
+			}
+			if !known {
+				parentID = ""
+			}
+			folderIDs[folder.ID] = mergeFolder(state, folder, parentID)
+		}
+		if len(next) == len(pending) {
+			for _, folder := range next {
+				folderIDs[folder.ID] = mergeFolder(state, folder, "")
+			}
+			break
+		}
+		pending = next
+	}
+
+	for _, playlist := range playlists {
+		index := findPlaylist(state.Playlists, playlist.Name)
+		if index < 0 {
+			if slices.ContainsFunc(state.Playlists, func(existing Playlist) bool { return existing.ID == playlist.ID }) {
+				playlist.ID = newID()
+			}
+			playlist.FolderID = folderIDs[playlist.FolderID]
+			appendPlaylist(state, playlist)
+			result.PlaylistsCreated = append(result.PlaylistsCreated, playlist.Name)
+			continue
+		}
+		existing := &state.Playlists[index]
+		added := 0
+		for _, entry := range playlist.Entries {
+			if entry.Root != "" || existing.containsPath(entry.Path) {
+				continue
+			}
+			existing.Entries = append(existing.Entries, newPlaylistEntry(entry.Path))
+			added++
+		}
+		if added > 0 {
+			existing.touch()
+			result.PlaylistsUpdated = append(result.PlaylistsUpdated, existing.Name)
+		}
+	}
+	for _, definition := range archive.SmartPlaylists {
+		if playlistNameInUse(state, definition.Name, "") {
+			continue
+		}
+		if findSmartPlaylistByID(state.SmartPlaylists, definition.ID) >= 0 {
+			definition.ID = newID()
+		}
+		state.SmartPlaylists = append(state.SmartPlaylists, definition)
+		result.PlaylistsCreated = append(result.PlaylistsCreated, definition.Name)
+	}
+	normalizePlaylists(state)
+}
+
+// mergeFolder returns the ID of the folder named like folder under
+// parentID, creating it if there is none.
+func mergeFolder(state *State, folder PlaylistFolder, parentID string) string {
+	for _, existing := range state.PlaylistFolders {
+		if existing.ParentID == parentID && strings.EqualFold(existing.Name, folder.Name) {
+			return existing.ID
+		}
+	}
+	if findFolder(state.PlaylistFolders, folder.ID) >= 0 {
+		folder.ID = newID()
+	}
+	folder.ParentID = parentID
+	folder.Order = nextFolderOrder(state.PlaylistFolders, parentID)
+	state.PlaylistFolders = append(state.PlaylistFolders, folder)
+	return folder.ID
+}
+
+func findRootByPath(roots []MusicRoot, path string) *MusicRoot {
+	for i := range roots {
+		if roots[i].Path == path {
+			return &roots[i]
+		}
+	}
+	return nil
+}
+
+func unionStrings(values []string, more []string) []string {
+	for _, value := range more {
+		if !containsString(values, value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// remapPaths applies the remapping to every absolute path in the archive:
+// music directories and roots, entries outside the roots, folder sources,
+// exclusions, statistics and the last played track. Separators are
+// compared loosely so archives from Windows map onto other systems.
+func remapPaths(state *State, remaps []PathRemap) {
+	if len(remaps) == 0 {
+		return
+	}
+	remap := func(path string) string { return remapPath(path, remaps) }
+	for i := range state.MusicDirs {
+		state.MusicDirs[i] = remap(state.MusicDirs[i])
+	}
+	for i := range state.MusicRoots {
+		state.MusicRoots[i].Path = remap(state.MusicRoots[i].Path)
+	}
+	for i := range state.Playlists {
+		playlist := &state.Playlists[i]
+		for j := range playlist.Entries {
+			if playlist.Entries[j].Root == "" {
+				playlist.Entries[j].Path = remap(playlist.Entries[j].Path)
+			}
+		}
+		if playlist.Source != nil && playlist.Source.Root == "" {
+			playlist.Source.Dir = remap(playlist.Source.Dir)
+		}
+	}
+	for _, list := range []*[]string{&state.Exclusions.HiddenTracks, &state.Exclusions.SkipShuffleTracks} {
+		for i := range *list {
+			(*list)[i] = remap((*list)[i])
+		}
+	}
+	if len(state.TrackStats) > 0 {
+		stats := make(map[string]TrackStats, len(state.TrackStats))
+		for path, value := range state.TrackStats {
+			stats[remap(path)] = value
+		}
+		state.TrackStats = stats
+	}
+	state.LastPlayedPath = remap(state.LastPlayedPath)
+}
+
+func remapPath(path string, remaps []PathRemap) string {
+	slashed := strings.ReplaceAll(path, "\\", "/")
+	for _, remap := range remaps {
+		from := strings.TrimRight(strings.ReplaceAll(strings.TrimSpace(remap.From), "\\", "/"), "/")
+		if from == "" || len(slashed) < len(from) || !strings.EqualFold(slashed[:len(from)], from) {
+			continue
+		}
+		rest := slashed[len(from):]
+		if rest != "" && rest[0] != '/' {
+			continue
+		}
+		to := strings.TrimSpace(remap.To)
+		if rest == "" {
+			return filepath.Clean(to)
+		}
+		return filepath.Join(to, filepath.FromSlash(rest))
+	}
+	return path
+}
@@ -0,0 +1,309 @@
+package state
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SmartFieldText   = "text"
+	SmartFieldNumber = "number"
+	SmartFieldDate   = "date"
+)
+
+var smartFields = map[string]string{
+	"name":       SmartFieldText,
+	"title":      SmartFieldText,
+	"artist":     SmartFieldText,
+	"composer":   SmartFieldText,
+	"album":      SmartFieldText,
+	"genre":      SmartFieldText,
+	"ext":        SmartFieldText,
+	"path":       SmartFieldText,
+	"year":       SmartFieldNumber,
+	"track":      SmartFieldNumber,
+	"playCount":  SmartFieldNumber,
+	"skipCount":  SmartFieldNumber,
+	"rating":     SmartFieldNumber,
+	"added":      SmartFieldDate,
+	"lastPlayed": SmartFieldDate,
+}
+
+var smartOperators = map[string][]string{
+	SmartFieldText:   {"is", "isNot", "contains", "notContains", "startsWith", "endsWith"},
+	SmartFieldNumber: {"is", "isNot", "lt", "lte", "gt", "gte"},
+	SmartFieldDate:   {"inLast", "notInLast", "before", "after"},
+}
+
+// SmartRule compares one track field with Value. Numbers are given as
+// decimal strings, periods for inLast/notInLast as a count with an optional
+// d, w, m or y suffix (days by default), and dates as YYYY-MM-DD.
+type SmartRule struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// SmartPlaylist is a playlist whose tracks are the library tracks matching
+// its rules. Match is "all" or "any".
+type SmartPlaylist struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Match      string      `json:"match"`
+	Rules      []SmartRule `json:"rules"`
+	SortBy     string      `json:"sortBy"`
+	SortDesc   bool        `json:"sortDesc"`
+	Limit      int         `json:"limit"`
+	CreatedAt  int64       `json:"createdAt"`
+	ModifiedAt int64       `json:"modifiedAt"`
+}
+
+// SmartFieldType reports whether field is compared as text, a number or a
+// date. It returns "" for unknown fields.
+func SmartFieldType(field string) string {
+	return smartFields[field]
+}
+
+func ParseSmartNumber(value string) (float64, error) {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, errors.New("invalid number: " + value)
+	}
+	return number, nil
+}
+
+func ParseSmartPeriod(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	unit := 24 * time.Hour
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'd':
+			value = value[:len(value)-1]
+		case 'w':
+			unit = 7 * 24 * time.Hour
+			value = value[:len(value)-1]
+		case 'm':
+			unit = 30 * 24 * time.Hour
+			value = value[:len(value)-1]
+		case 'y':
+			unit = 365 * 24 * time.Hour
+			value = value[:len(value)-1]
+		}
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || count < 0 {
+		return 0, errors.New("invalid period")
+	}
+	return time.Duration(count) * unit, nil
+}
+
+func ParseSmartDate(value string) (time.Time, error) {
+	parsed, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(value), time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("invalid date: " + value)
+	}
+	return parsed, nil
+}
+
+func (s *Store) GetSmartPlaylists() ([]SmartPlaylist, error) {
+	state, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	if state.SmartPlaylists == nil {
+		return []SmartPlaylist{}, nil
+	}
+	return state.SmartPlaylists, nil
+}
+
+func (s *Store) GetSmartPlaylist(name string) (SmartPlaylist, error) {
+	state, err := s.Load()
+	if err != nil {
+		return SmartPlaylist{}, err
+	}
+	index := findSmartPlaylist(state.SmartPlaylists, strings.TrimSpace(name))
+	if index < 0 {
+		return SmartPlaylist{}, errors.New("playlist not found")
+	}
+	return state.SmartPlaylists[index], nil
+}
+
+func (s *Store) CreateSmartPlaylist(definition SmartPlaylist) (SmartPlaylist, error) {
+	definition, err := normalizeSmartPlaylist(definition)
+	if err != nil {
+		return SmartPlaylist{}, err
+	}
+	now := time.Now().UnixMilli()
+	definition.ID = newID()
+	definition.CreatedAt = now
+	definition.ModifiedAt = now
+	_, err = s.Update(func(state *State) error {
+		if playlistNameInUse(state, definition.Name, "") {
+			return errors.New("playlist already exists")
+		}
+		state.SmartPlaylists = append(state.SmartPlaylists, definition)
+		return nil
+	})
+	if err != nil {
+		return SmartPlaylist{}, err
+	}
+	return definition, nil
+}
+
+// UpdateSmartPlaylist replaces the name, rules and options of the smart
+// playlist with the definition's ID.
+func (s *Store) UpdateSmartPlaylist(definition SmartPlaylist) (SmartPlaylist, error) {
+	definition, err := normalizeSmartPlaylist(definition)
+	if err != nil {
+		return SmartPlaylist{}, err
+	}
+	var result SmartPlaylist
+	_, err = s.Update(func(state *State) error {
+		index := findSmartPlaylistByID(state.SmartPlaylists, definition.ID)
+		if index < 0 {
+			return errors.New("playlist not found")
+		}
+		if playlistNameInUse(state, definition.Name, definition.ID) {
+			return errors.New("playlist already exists")
+		}
+		existing := state.SmartPlaylists[index]
+		if strings.EqualFold(state.ActivePlaylist, existing.Name) {
+			state.ActivePlaylist = definition.Name
+		}
+		definition.CreatedAt = existing.CreatedAt
+		definition.ModifiedAt = time.Now().UnixMilli()
+		state.SmartPlaylists[index] = definition
+		result = definition
+		return nil
+	})
+	return result, err
+}
+
+func (s *Store) DeleteSmartPlaylist(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("playlist name is required")
+	}
+	_, err := s.updateWithSnapshot(SnapshotDeleteSmartPlaylist, func(state *State) error {
+		index := findSmartPlaylist(state.SmartPlaylists, name)
+		if index < 0 {
+			return errors.New("playlist not found")
+		}
+		state.SmartPlaylists = append(state.SmartPlaylists[:index], state.SmartPlaylists[index+1:]...)
+		if strings.EqualFold(state.ActivePlaylist, name) {
+			state.ActivePlaylist = ""
+		}
+		return nil
+	})
+	return err
+}
+
+func normalizeSmartPlaylist(definition SmartPlaylist) (SmartPlaylist, error) {
+	name, err := validatePlaylistName(definition.Name)
+	if err != nil {
+		return SmartPlaylist{}, err
+	}
+	definition.Name = name
+	switch strings.ToLower(strings.TrimSpace(definition.Match)) {
+	case "", "all":
+		definition.Match = "all"
+	case "any":
+		definition.Match = "any"
+	default:
+		return SmartPlaylist{}, errors.New("match must be all or any")
+	}
+	if len(definition.Rules) == 0 {
+		return SmartPlaylist{}, errors.New("at least one rule is required")
+	}
+	rules := make([]SmartRule, 0, len(definition.Rules))
+	for _, rule := range definition.Rules {
+		rule.Field = strings.TrimSpace(rule.Field)
+		rule.Operator = strings.TrimSpace(rule.Operator)
+		if err := validateSmartRule(rule); err != nil {
+			return SmartPlaylist{}, err
+		}
+		rules = append(rules, rule)
+	}
+	definition.Rules = rules
+	definition.SortBy = strings.TrimSpace(definition.SortBy)
+	if definition.SortBy != "" && SmartFieldType(definition.SortBy) == "" {
+		return SmartPlaylist{}, errors.New("unknown sort field: " + definition.SortBy)
+	}
+	if definition.Limit < 0 {
+		return SmartPlaylist{}, errors.New("limit must not be negative")
+	}
+	return definition, nil
+}
+
+func validateSmartRule(rule SmartRule) error {
+	kind := SmartFieldType(rule.Field)
+	if kind == "" {
+		return errors.New("unknown rule field: " + rule.Field)
+	}
+	if !containsString(smartOperators[kind], rule.Operator) {
+		return errors.New("operator " + rule.Operator + " does not apply to " + rule.Field)
+	}
+	switch {
+	case kind == SmartFieldNumber:
+		_, err := ParseSmartNumber(rule.Value)
+		return err
+	case rule.Operator == "inLast" || rule.Operator == "notInLast":
+		_, err := ParseSmartPeriod(rule.Value)
+		return err
+	case kind == SmartFieldDate:
+		_, err := ParseSmartDate(rule.Value)
+		return err
+	}
+	return nil
+}
+
+// playlistNameInUse reports whether a regular or smart playlist other than
+// exceptID already uses name.
+func playlistNameInUse(state *State, name string, exceptID string) bool {
+	if index := findPlaylist(state.Playlists, name); index >= 0 && state.Playlists[index].ID != exceptID {
+		return true
+	}
+	index := findSmartPlaylist(state.SmartPlaylists, name)
+	return index >= 0 && state.SmartPlaylists[index].ID != exceptID
+}
+
+// playlistNotFound explains why a playlist cannot be edited: smart playlists
+// are read-only, anything else does not exist.
+func playlistNotFound(state *State, name string) error {
+	if findSmartPlaylist(state.SmartPlaylists, name) >= 0 {
+		return errors.New("playlist is read-only")
+	}
+	return errors.New("playlist not found")
+}
+
+func findSmartPlaylist(playlists []SmartPlaylist, name string) int {
+	for i, playlist := range playlists {
+		if strings.EqualFold(playlist.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func findSmartPlaylistByID(playlists []SmartPlaylist, id string) int {
+	if id == "" {
+		return -1
+	}
+	for i, playlist := range playlists {
+		if playlist.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsString(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSnapshots is how many snapshots are kept; older ones are deleted as new
+// ones are taken.
+const maxSnapshots = 20
+
+// Operations recorded with snapshots. All but SnapshotRestore, the imports
+// and SnapshotReload are playlist operations that UndoPlaylistOperation can
+// reverse.
+const (
+	SnapshotDeletePlaylist      = "deletePlaylist"
+	SnapshotRemoveTracks        = "removeTracks"
+	SnapshotReplaceTracks       = "replaceTracks"
+	SnapshotMergePlaylists      = "mergePlaylists"
+	SnapshotDeleteFolder        = "deleteFolder"
+	SnapshotDeleteSmartPlaylist = "deleteSmartPlaylist"
+	SnapshotImportLibrary       = "importLibrary"
+	SnapshotImportSettings      = "importSettings"
+	SnapshotRestore             = "restore"
+)
+
+// Snapshot is a copy of the state taken just before a destructive
+// operation, stored in the same form as state.json. ID names the snapshot
+// file.
+type Snapshot struct {
+	ID        string `json:"id"`
+	CreatedAt int64  `json:"createdAt"`
+	Operation string `json:"operation"`
+	Size      int64  `json:"size"`
+}
+
+func (s *Store) snapshotDir() (string, error) {
+	statePath, err := s.stateFilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(statePath), "snapshots"), nil
+}
+
+// ListSnapshots returns the snapshots, newest first.
+func (s *Store) ListSnapshots() ([]Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listSnapshots()
+}
+
+// RestoreSnapshot replaces the whole state with a snapshot. The state being
+// replaced is snapshotted first, so a restore can itself be undone by
+// restoring that snapshot.
+func (s *Store) RestoreSnapshot(id string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureLoaded(); err != nil {
+		return State{}, err
+	}
+	restored, err := s.readSnapshot(id)
+	if err != nil {
+		return State{}, err
+	}
+	if _, err := s.takeSnapshot(SnapshotRestore, s.state); err != nil {
+		return State{}, err
+	}
+	previous := s.state
+	s.state = restored
+	s.publish(&previous, &s.state, ChangeFromApp)
+	s.markDirty()
+	return restored.clone(), nil
+}
+
+// UndoPlaylistOperation reverses the most recent playlist operation by
+// restoring playlists, playlist folders, smart playlists and the active
+// playlist from the snapshot taken before it. Everything else, such as
+// settings and play statistics, is left as it is. The snapshot is used up,
+// so undoing again goes one operation further back. Undo is refused when
+// the playlists have changed since the operation, since restoring would
+// silently lose those changes.
+func (s *Store) UndoPlaylistOperation() (Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureLoaded(); err != nil {
+		return Snapshot{}, err
+	}
+	snapshots, err := s.listSnapshots()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	dir, err := s.snapshotDir()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	for _, snapshot := range snapshots {
+		if !isPlaylistOperation(snapshot.Operation) {
+			continue
+		}
+		after, err := os.ReadFile(filepath.Join(dir, snapshot.ID+afterSuffix))
+		if err != nil || string(after) != playlistFingerprint(s.state) {
+			return Snapshot{}, errors.New("playlists have changed since the last operation")
+		}
+		previous, err := s.readSnapshot(snapshot.ID)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		current := s.state
+		s.state.Playlists = previous.Playlists
+		s.state.PlaylistFolders = previous.PlaylistFolders
+		s.state.SmartPlaylists = previous.SmartPlaylists
+		s.state.ActivePlaylist = previous.ActivePlaylist
+		s.publish(&current, &s.state, ChangeFromApp)
+		s.markDirty()
+		removeSnapshot(dir, snapshot.ID)
+		return snapshot, nil
+	}
+	return Snapshot{}, errors.New("nothing to undo")
+}
+
+// afterSuffix names the file kept next to a playlist operation's snapshot
+// with the fingerprint of the playlists the operation left behind. It ends
+// in .json so it moves with the snapshots, but is not itself a snapshot.
+const afterSuffix = ".after.json"
+
+// playlistFingerprint identifies the parts of state that
+// UndoPlaylistOperation restores, apart from the active playlist, in their
+// stored form.
+func playlistFingerprint(state State) string {
+	portable := portableCopy(state)
+	data, err := json.Marshal(struct {
+		Playlists       []Playlist       `json:"playlists"`
+		PlaylistFolders []PlaylistFolder `json:"playlistFolders"`
+		SmartPlaylists  []SmartPlaylist  `json:"smartPlaylists"`
+	}{portable.Playlists, portable.PlaylistFolders, portable.SmartPlaylists})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// takeSnapshot saves state, as it would be written to state.json, in the
+// snapshot directory and prunes old snapshots. It returns the snapshot's
+// ID.
+func (s *Store) takeSnapshot(operation string, state State) (string, error) {
+	data, err := encodeState(state)
+	if err != nil {
+		return "", err
+	}
+	dir, err := s.snapshotDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	id := strconv.FormatInt(time.Now().UnixNano(), 10) + "_" + operation
+	if err := os.WriteFile(filepath.Join(dir, id+".json"), data, 0o644); err != nil {
+		return "", err
+	}
+	snapshots, err := s.listSnapshots()
+	if err != nil {
+		return "", err
+	}
+	for _, snapshot := range snapshots[min(len(snapshots), maxSnapshots):] {
+		removeSnapshot(dir, snapshot.ID)
+	}
+	return id, nil
+}
+
+// recordPlaylistOperation takes the snapshot for a playlist operation
+// along with the fingerprint of the playlists it leaves, which
+// UndoPlaylistOperation checks before undoing it.
+func (s *Store) recordPlaylistOperation(operation string, before State, after State) error {
+	id, err := s.takeSnapshot(operation, before)
+	if err != nil {
+		return err
+	}
+	dir, err := s.snapshotDir()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, id+afterSuffix), []byte(playlistFingerprint(after)), 0o644)
+}
+
+func removeSnapshot(dir string, id string) {
+	_ = os.Remove(filepath.Join(dir, id+".json"))
+	_ = os.Remove(filepath.Join(dir, id+afterSuffix))
+}
+
+func (s *Store) listSnapshots() ([]Snapshot, error) {
+	dir, err := s.snapshotDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Snapshot{}, nil
+		}
+		return nil, err
+	}
+	snapshots := make([]Snapshot, 0, len(entries))
+	for _, entry := range entries {
+		snapshot, ok := parseSnapshotName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			snapshot.Size = info.Size()
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID > snapshots[j].ID })
+	return snapshots, nil
+}
+
+func (s *Store) readSnapshot(id string) (State, error) {
+	if _, ok := parseSnapshotName(id + ".json"); !ok {
+		return State{}, errors.New("snapshot not found")
+	}
+	dir, err := s.snapshotDir()
+	if err != nil {
+		return State{}, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return State{}, errors.New("snapshot not found")
+		}
+		return State{}, err
+	}
+	return decodeState(data)
+}
+
+// parseSnapshotName reads a snapshot file name of the form
+// <unix nanoseconds>_<operation>.json.
+func parseSnapshotName(name string) (Snapshot, bool) {
+	id, ok := strings.CutSuffix(name, ".json")
+	if !ok {
+		return Snapshot{}, false
+	}
+	stamp, operation, ok := strings.Cut(id, "_")
+	if !ok || operation == "" || strings.ContainsAny(operation, `/\.`) {
+		return Snapshot{}, false
+	}
+	nanos, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil || len(stamp) != 19 {
+		return Snapshot{}, false
+	}
+	return Snapshot{ID: id, CreatedAt: nanos / int64(time.Millisecond), Operation: operation}, true
+}
+
+func isPlaylistOperation(operation string) bool {
+	switch operation {
+	case SnapshotRestore, SnapshotImportLibrary, SnapshotImportSettings, SnapshotReload, SnapshotSync:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package state
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	FolderSortTrack = "track"
+	FolderSortName  = "name"
+)
+
+// FolderSource links a playlist to the music folder it was created from so
+// a rescan can bring it up to date. Recursive playlists also take the
+// tracks of subfolders.
+type FolderSource struct {
+	Dir       string `json:"dir"`
+	Root      string `json:"root,omitempty"`
+	Recursive bool   `json:"recursive"`
+	SortBy    string `json:"sortBy"`
+}
+
+// FolderPlaylist is a playlist built from a music folder, with its tracks in
+// order. Source is nil unless the playlist should follow the folder.
+type FolderPlaylist struct {
+	Name   string
+	Tracks []string
+	Source *FolderSource
+}
+
+// ImportFolderPlaylists creates a playlist for each folder. A folder that
+// already has a synced playlist updates that playlist instead, so importing
+// the same directory again does not duplicate anything. Names that are
+// taken get a numeric suffix.
+func (s *Store) ImportFolderPlaylists(folders []FolderPlaylist) ([]Playlist, []Playlist, error) {
+	dirs, err := s.ResolveMusicDirs()
+	if err != nil {
+		return nil, nil, err
+	}
+	created := make([]Playlist, 0)
+	updated := make([]Playlist, 0)
+	_, err = s.Update(func(state *State) error {
+		for _, folder := range folders {
+			name, err := validatePlaylistName(folder.Name)
+			if err != nil {
+				return err
+			}
+			tracks := make([]string, 0, len(folder.Tracks))
+			for _, path := range folder.Tracks {
+				if absFile, err := resolveTrackPathIn(dirs, path); err == nil {
+					tracks = append(tracks, absFile)
+				}
+			}
+			if folder.Source != nil {
+				if index := findSourcePlaylist(state.Playlists, folder.Source.Dir); index >= 0 {
+					playlist := &state.Playlists[index]
+					playlist.Entries = reuseEntries(playlist.Entries, tracks)
+					playlist.Source = folder.Source
+					playlist.touch()
+					updated = append(updated, *playlist)
+					continue
+				}
+			}
+			unique := name
+			for n := 2; playlistNameInUse(state, unique, ""); n++ {
+				unique = name + " (" + strconv.Itoa(n) + ")"
+			}
+			playlist := newPlaylist(unique)
+			playlist.Source = folder.Source
+			playlist.Entries = reuseEntries(nil, tracks)
+			playlist.syncTracks()
+			created = append(created, appendPlaylist(state, playlist))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return created, updated, nil
+}
+
+// SyncFolderPlaylists replaces the tracks of synced playlists, keyed by
+// playlist ID, and returns the names of those that changed. Nothing is
+// written when every playlist is already current.
+func (s *Store) SyncFolderPlaylists(contents map[string][]string) ([]string, error) {
+	changed := make([]string, 0)
+	current, err := s.Load()
+	if err != nil {
+		return changed, err
+	}
+	if !folderPlaylistsDiffer(current.Playlists, contents) {
+		return changed, nil
+	}
+	_, err = s.Update(func(state *State) error {
+		changed = changed[:0]
+		for i := range state.Playlists {
+			playlist := &state.Playlists[i]
+			tracks, ok := contents[playlist.ID]
+			if !ok || playlist.Source == nil || samePaths(playlist.Entries, tracks) {
+				continue
+			}
+			playlist.Entries = reuseEntries(playlist.Entries, tracks)
+			playlist.touch()
+			changed = append(changed, playlist.Name)
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// StopFolderSync detaches a playlist from its folder. Its tracks stay as
+// they are and further rescans leave it alone.
+func (s *Store) StopFolderSync(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("playlist name is required")
+	}
+	_, err := s.Update(func(state *State) error {
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			return playlistNotFound(state, name)
+		}
+		if state.Playlists[index].Source == nil {
+			return errors.New("playlist is not synced with a folder")
+		}
+		state.Playlists[index].Source = nil
+		return nil
+	})
+	return err
+}
+
+func findSourcePlaylist(playlists []Playlist, dir string) int {
+	for i, playlist := range playlists {
+		if playlist.Source != nil && strings.EqualFold(playlist.Source.Dir, dir) {
+			return i
+		}
+	}
+	return -1
+}
+
+func folderPlaylistsDiffer(playlists []Playlist, contents map[string][]string) bool {
+	for _, playlist := range playlists {
+		if tracks, ok := contents[playlist.ID]; ok && playlist.Source != nil && !samePaths(playlist.Entries, tracks) {
+			return true
+		}
+	}
+	return false
+}
+
+func samePaths(entries []PlaylistEntry, paths []string) bool {
+	if len(entries) != len(paths) {
+		return false
+	}
+	for i, entry := range entries {
+		if !strings.EqualFold(entry.Path, paths[i]) {
+			return false
+		}
+	}
+	return true
+}
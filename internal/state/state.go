@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -13,23 +14,23 @@ import (
 	"LiteSound/internal/media"
 )
 
-const FavoritesKey = "__favorites__"
-
-type Playlist struct {
-	Name   string   `json:"name"`
-	Tracks []string `json:"tracks"`
-}
-
 type State struct {
-	LastPlayedPath string     `json:"lastPlayedPath"`
-	LastPlayedAt   int64      `json:"lastPlayedAt"`
-	ComposerFilter string     `json:"composerFilter"`
-	AlbumFilter    string     `json:"albumFilter"`
-	Theme          string     `json:"theme"`
-	MusicDir       string     `json:"musicDir"`
-	MusicDirs      []string   `json:"musicDirs"`
-	Playlists      []Playlist `json:"playlists"`
-	ActivePlaylist string     `json:"activePlaylist"`
+	Version         int                   `json:"version"`
+	LastPlayedPath  string                `json:"lastPlayedPath"`
+	LastPlayedAt    int64                 `json:"lastPlayedAt"`
+	ComposerFilter  string                `json:"composerFilter"`
+	AlbumFilter     string                `json:"albumFilter"`
+	Theme           string                `json:"theme"`
+	MusicDir        string                `json:"musicDir"`
+	MusicDirs       []string              `json:"musicDirs"`
+	MusicRoots      []MusicRoot           `json:"musicRoots"`
+	Playlists       []Playlist            `json:"playlists"`
+	ActivePlaylist  string                `json:"activePlaylist"`
+	PlaylistFolders []PlaylistFolder      `json:"playlistFolders"`
+	SmartPlaylists  []SmartPlaylist       `json:"smartPlaylists"`
+	Exclusions      Exclusions            `json:"exclusions"`
+	TrackStats      map[string]TrackStats `json:"trackStats"`
+	Preferences     Preferences           `json:"preferences"`
 }
 
 type LastPlayedRecord struct {
@@ -37,9 +38,53 @@ type LastPlayedRecord struct {
 	PlayedAt int64  `json:"playedAt"`
 }
 
+// flushDelay is how long changes wait in memory before being written, so a
+// burst of updates costs one write.
+const flushDelay = time.Second
+
+// Store holds the state in memory, loading it from state.json on first use.
+// Changes are written back by a timer shortly after they are made, and by
+// Flush, which must be called before the process exits.
 type Store struct {
 	appName string
+	dataDir DataDir
 	mu      sync.RWMutex
+	loaded  bool
+	state   State
+	dirty   bool
+	timer   *time.Timer
+	// writeMu serializes file writes. It is taken before mu so writes land
+	// in the order their contents were captured.
+	writeMu sync.Mutex
+
+	recovery        *Recovery
+	onRecovery      func(Recovery)
+	recoveryPending bool
+
+	eventsMu       sync.Mutex
+	subscribers    map[int]func(Change)
+	nextSubscriber int
+	pendingEvents  []Change
+	dispatching    bool
+
+	// syncMu serializes syncs and is taken before writeMu, so a sync never
+	// straddles a profile switch.
+	syncMu   sync.Mutex
+	syncErr  string
+	syncLogs map[string]*syncLog
+
+	// historyMu serializes appends to and reads of the play history.
+	historyMu sync.Mutex
+	history   *historyLog
+
+	// stamp identifies the state.json last read or written by the store, so
+	// edits by anything else can be told apart.
+	stamp fileStamp
+
+	// profileMu guards the active profile. It is taken after mu.
+	profileMu       sync.Mutex
+	profile         string
+	profileResolved bool
 }
 
 func NewStore(appName string) *Store {
@@ -49,92 +94,233 @@ func NewStore(appName string) *Store {
 	return &Store{appName: appName}
 }
 
+// NewStoreInDir returns a store that keeps its files in dataDir instead of
+// the user config directory.
+func NewStoreInDir(appName string, dataDir DataDir) *Store {
+	store := NewStore(appName)
+	store.dataDir = dataDir
+	return store
+}
+
 func (s *Store) stateFilePath() (string, error) {
-	configDir, err := os.UserConfigDir()
+	base, err := s.baseDir()
 	if err != nil {
 		return "", err
 	}
-	dir := filepath.Join(configDir, s.appName)
-	return filepath.Join(dir, "state.json"), nil
+	return filepath.Join(profileDir(base, s.activeProfile(base)), "state.json"), nil
 }
 
+// Load returns a copy of the state that the caller may modify freely.
 func (s *Store) Load() (State, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.loadFromDisk()
+	var state State
+	err := s.view(func(current *State) {
+		state = current.clone()
+	})
+	return state, err
 }
 
 func (s *Store) Save(state State) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.saveToDisk(state)
+	previous := s.state
+	s.state = state.clone()
+	s.loaded = true
+	s.publish(&previous, &s.state, ChangeFromApp)
+	s.markDirty()
+	return nil
 }
 
+// Update applies updateFn to a copy of the state and keeps the result only
+// if updateFn succeeds. If updateFn returns errUnchanged the state is left
+// as it is and no change is announced.
 func (s *Store) Update(updateFn func(*State) error) (State, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	state, err := s.loadFromDisk()
-	if err != nil {
+	if err := s.ensureLoaded(); err != nil {
 		return State{}, err
 	}
+	state := s.state.clone()
 	if updateFn != nil {
 		if err := updateFn(&state); err != nil {
+			if errors.Is(err, errUnchanged) {
+				return s.state.clone(), nil
+			}
 			return State{}, err
 		}
 	}
-	if err := s.saveToDisk(state); err != nil {
+	previous := s.state
+	s.state = state
+	s.publish(&previous, &s.state, ChangeFromApp)
+	s.markDirty()
+	return state.clone(), nil
+}
+
+// errUnchanged is returned by an Update or updateWithSnapshot function that
+// found nothing to change, so that nothing is announced or snapshotted.
+var errUnchanged = errors.New("unchanged")
+
+// updateWithSnapshot is Update for destructive changes: once updateFn has
+// succeeded, the state as it was is kept as a snapshot labelled with
+// operation. If updateFn returns errUnchanged the state is left as it is
+// and no snapshot is taken.
+func (s *Store) updateWithSnapshot(operation string, updateFn func(*State) error) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureLoaded(); err != nil {
 		return State{}, err
 	}
-	return state, nil
+	state := s.state.clone()
+	if err := updateFn(&state); err != nil {
+		if errors.Is(err, errUnchanged) {
+			return s.state.clone(), nil
+		}
+		return State{}, err
+	}
+	var err error
+	if isPlaylistOperation(operation) {
+		err = s.recordPlaylistOperation(operation, s.state, state)
+	} else {
+		_, err = s.takeSnapshot(operation, s.state)
+	}
+	if err != nil {
+		return State{}, err
+	}
+	previous := s.state
+	s.state = state
+	s.publish(&previous, &s.state, ChangeFromApp)
+	s.markDirty()
+	return state.clone(), nil
 }
 
-func (s *Store) loadFromDisk() (State, error) {
-	state := State{}
-	statePath, err := s.stateFilePath()
-	if err != nil {
-		return state, err
+// view runs fn on the current state without copying it. fn must not modify
+// the state or keep references into it.
+func (s *Store) view(fn func(*State)) error {
+	s.mu.RLock()
+	if s.loaded {
+		defer s.mu.RUnlock()
+		fn(&s.state)
+		return nil
+	}
+	s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureLoaded(); err != nil {
+		return err
+	}
+	fn(&s.state)
+	return nil
+}
+
+// ensureLoaded reads state.json the first time the state is needed. The
+// caller must hold mu for writing.
+func (s *Store) ensureLoaded() error {
+	if s.loaded {
+		return nil
 	}
-	data, err := os.ReadFile(statePath)
+	state, err := s.loadFromDisk()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return state, nil
-		}
-		return state, err
+		return err
+	}
+	s.state = state
+	s.loaded = true
+	return nil
+}
+
+// markDirty schedules a write of the state. Further changes before the
+// write happens are carried by the same write. The caller must hold mu for
+// writing.
+func (s *Store) markDirty() {
+	s.dirty = true
+	if s.timer == nil {
+		s.timer = time.AfterFunc(flushDelay, func() {
+			_ = s.Flush()
+		})
 	}
-	if len(data) == 0 {
-		return state, nil
+}
+
+// Flush writes pending changes to state.json now. If the write fails the
+// changes stay pending and another write is scheduled.
+func (s *Store) Flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.mu.Lock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
 	}
-	if err := json.Unmarshal(data, &state); err != nil {
-		return State{}, err
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
 	}
-	if state.Playlists == nil {
-		state.Playlists = []Playlist{}
+	data, err := encodeState(s.state)
+	s.dirty = false
+	s.mu.Unlock()
+	if err == nil {
+		err = s.writeStateFile(data)
 	}
-	ensureFavoritesPlaylist(&state)
+	s.mu.Lock()
+	if err != nil {
+		s.markDirty()
+	} else if statePath, pathErr := s.stateFilePath(); pathErr == nil {
+		s.stamp = stampFile(statePath)
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// decodeState parses the contents of a state file, migrating it to the
+// current version and filling in defaults. Empty data gives the default
+// state.
+func decodeState(data []byte) (State, error) {
+	state := State{Preferences: DefaultPreferences()}
+	if len(data) > 0 {
+		migrated, err := migrateState(data)
+		if err != nil {
+			return State{}, err
+		}
+		if err := json.Unmarshal(migrated, &state); err != nil {
+			return State{}, err
+		}
+	}
+	state.Version = max(state.Version, currentStateVersion)
 	if state.MusicDirs == nil {
 		state.MusicDirs = []string{}
 	}
-	if len(state.MusicDirs) == 0 && strings.TrimSpace(state.MusicDir) != "" {
-		state.MusicDirs = []string{state.MusicDir}
-	}
+	normalizeMusicRoots(&state)
+	normalizePlaylists(&state)
+	resolvePortableEntries(&state)
 	if strings.TrimSpace(state.Theme) == "" {
 		state.Theme = "system"
 	}
+	if state.SmartPlaylists == nil {
+		state.SmartPlaylists = []SmartPlaylist{}
+	}
+	state.Exclusions.normalize()
+	if state.TrackStats == nil {
+		state.TrackStats = map[string]TrackStats{}
+	}
+	state.Preferences.normalize()
 	return state, nil
 }
 
-func (s *Store) saveToDisk(state State) error {
+func encodeState(state State) ([]byte, error) {
+	return json.MarshalIndent(portableCopy(state), "", "  ")
+}
+
+func (s *Store) writeStateFile(data []byte) error {
 	statePath, err := s.stateFilePath()
 	if err != nil {
 		return err
 	}
+	return writeFileAtomic(statePath, data)
+}
+
+// writeFileAtomic replaces statePath atomically: the data is written and
+// synced to a temporary file that is then renamed over the old one.
+func writeFileAtomic(statePath string, data []byte) error {
 	if err := os.MkdirAll(filepath.Dir(statePath), 0o755); err != nil {
 		return err
 	}
-	data, err := json.MarshalIndent(state, "", "  ")
-	if err != nil {
-		return err
-	}
 	tempFile, err := os.CreateTemp(filepath.Dir(statePath), "state-*.tmp")
 	if err != nil {
 		return err
@@ -168,16 +354,19 @@ func (s *Store) saveToDisk(state State) error {
 	return nil
 }
 
+// ResolveMusicDirs returns the configured music directories, or the default
+// one when none are set. The stream server calls it for every request, so
+// it reads the state without copying it.
 func (s *Store) ResolveMusicDirs() ([]string, error) {
-	state, err := s.Load()
+	var dirs []string
+	err := s.view(func(state *State) {
+		dirs = slices.Clone(state.MusicDirs)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if len(state.MusicDirs) > 0 {
-		return state.MusicDirs, nil
-	}
-	if strings.TrimSpace(state.MusicDir) != "" {
-		return []string{state.MusicDir}, nil
+	if len(dirs) > 0 {
+		return dirs, nil
 	}
 	dir, err := media.DefaultMusicDir()
 	if err != nil {
@@ -186,6 +375,34 @@ func (s *Store) ResolveMusicDirs() ([]string, error) {
 	return []string{dir}, nil
 }
 
+func (s *Store) resolveTrackPath(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("path is required")
+	}
+	dirs, err := s.ResolveMusicDirs()
+	if err != nil {
+		return "", err
+	}
+	return resolveTrackPathIn(dirs, path)
+}
+
+func resolveTrackPathIn(dirs []string, path string) (string, error) {
+	if path == "" {
+		return "", errors.New("path is required")
+	}
+	if !media.IsAllowedAudio(path) {
+		return "", errors.New("unsupported audio type")
+	}
+	absFile, err := media.ResolveExistingPath(path)
+	if err != nil {
+		return "", err
+	}
+	if !media.IsPathWithinAnyDir(dirs, absFile) {
+		return "", errors.New("file not in music directory")
+	}
+	return absFile, nil
+}
+
 func (s *Store) GetMusicDir() (string, error) {
 	dirs, err := s.ResolveMusicDirs()
 	if err != nil {
@@ -234,13 +451,9 @@ func (s *Store) SetMusicDirs(paths []string) ([]string, error) {
 		cleaned = append(cleaned, abs)
 	}
 	updateFn := func(state *State) error {
-		if len(cleaned) == 0 {
-			state.MusicDir = ""
-			state.MusicDirs = []string{}
-			return nil
-		}
 		state.MusicDir = ""
 		state.MusicDirs = cleaned
+		normalizeMusicRoots(state)
 		return nil
 	}
 	_, err := s.Update(updateFn)
@@ -296,23 +509,10 @@ func (s *Store) GetLastPlayedRecord() (LastPlayedRecord, error) {
 }
 
 func (s *Store) SetLastPlayed(path string) error {
-	if path == "" {
-		return errors.New("path is required")
-	}
-	if !media.IsAllowedAudio(path) {
-		return errors.New("unsupported audio type")
-	}
-	dirs, err := s.ResolveMusicDirs()
+	absFile, err := s.resolveTrackPath(path)
 	if err != nil {
 		return err
 	}
-	absFile, err := media.ResolveExistingPath(path)
-	if err != nil {
-		return err
-	}
-	if !media.IsPathWithinAnyDir(dirs, absFile) {
-		return errors.New("file not in music directory")
-	}
 	_, err = s.Update(func(state *State) error {
 		state.LastPlayedPath = absFile
 		state.LastPlayedAt = time.Now().UnixMilli()
@@ -342,151 +542,9 @@ func (s *Store) SetActivePlaylist(name string) error {
 				return nil
 			}
 		}
-		return errors.New("playlist not found")
-	})
-	return err
-}
-
-func (s *Store) GetPlaylists() ([]Playlist, error) {
-	state, err := s.Load()
-	if err != nil {
-		return nil, err
-	}
-	if state.Playlists == nil {
-		return []Playlist{}, nil
-	}
-	return state.Playlists, nil
-}
-
-func (s *Store) CreatePlaylist(name string) error {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return errors.New("playlist name is required")
-	}
-	if strings.EqualFold(name, FavoritesKey) {
-		return errors.New("playlist name is reserved")
-	}
-	_, err := s.Update(func(state *State) error {
-		for _, playlist := range state.Playlists {
-			if strings.EqualFold(playlist.Name, name) {
-				return errors.New("playlist already exists")
-			}
-		}
-		state.Playlists = append(state.Playlists, Playlist{Name: name, Tracks: []string{}})
-		return nil
-	})
-	return err
-}
-
-func (s *Store) DeletePlaylist(name string) error {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return errors.New("playlist name is required")
-	}
-	if strings.EqualFold(name, FavoritesKey) {
-		return errors.New("playlist name is reserved")
-	}
-	_, err := s.Update(func(state *State) error {
-		updated := make([]Playlist, 0, len(state.Playlists))
-		found := false
-		for _, playlist := range state.Playlists {
+		for _, playlist := range state.SmartPlaylists {
 			if strings.EqualFold(playlist.Name, name) {
-				found = true
-				continue
-			}
-			updated = append(updated, playlist)
-		}
-		if !found {
-			return errors.New("playlist not found")
-		}
-		if strings.EqualFold(state.ActivePlaylist, name) {
-			state.ActivePlaylist = ""
-		}
-		state.Playlists = updated
-		return nil
-	})
-	return err
-}
-
-func (s *Store) AddToPlaylist(name string, path string) error {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return errors.New("playlist name is required")
-	}
-	if path == "" {
-		return errors.New("path is required")
-	}
-	if !media.IsAllowedAudio(path) {
-		return errors.New("unsupported audio type")
-	}
-	dirs, err := s.ResolveMusicDirs()
-	if err != nil {
-		return err
-	}
-	absFile, err := media.ResolveExistingPath(path)
-	if err != nil {
-		return err
-	}
-	if !media.IsPathWithinAnyDir(dirs, absFile) {
-		return errors.New("file not in music directory")
-	}
-
-	_, err = s.Update(func(state *State) error {
-		for i, playlist := range state.Playlists {
-			if strings.EqualFold(playlist.Name, name) {
-				for _, existing := range playlist.Tracks {
-					if strings.EqualFold(existing, absFile) {
-						return nil
-					}
-				}
-				state.Playlists[i].Tracks = append(state.Playlists[i].Tracks, absFile)
-				return nil
-			}
-		}
-		return errors.New("playlist not found")
-	})
-	return err
-}
-
-func (s *Store) RemoveFromPlaylist(name string, path string) error {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return errors.New("playlist name is required")
-	}
-	if path == "" {
-		return errors.New("path is required")
-	}
-	if !media.IsAllowedAudio(path) {
-		return errors.New("unsupported audio type")
-	}
-	dirs, err := s.ResolveMusicDirs()
-	if err != nil {
-		return err
-	}
-	absFile, err := media.ResolveExistingPath(path)
-	if err != nil {
-		return err
-	}
-	if !media.IsPathWithinAnyDir(dirs, absFile) {
-		return errors.New("file not in music directory")
-	}
-
-	_, err = s.Update(func(state *State) error {
-		for i, playlist := range state.Playlists {
-			if strings.EqualFold(playlist.Name, name) {
-				updated := make([]string, 0, len(playlist.Tracks))
-				removed := false
-				for _, existing := range playlist.Tracks {
-					if strings.EqualFold(existing, absFile) {
-						removed = true
-						continue
-					}
-					updated = append(updated, existing)
-				}
-				if !removed {
-					return nil
-				}
-				state.Playlists[i].Tracks = updated
+				state.ActivePlaylist = playlist.Name
 				return nil
 			}
 		}
@@ -532,12 +590,3 @@ func (s *Store) SetTheme(theme string) (string, error) {
 	}
 	return normalized, nil
 }
-
-func ensureFavoritesPlaylist(state *State) {
-	for _, playlist := range state.Playlists {
-		if strings.EqualFold(playlist.Name, FavoritesKey) {
-			return
-		}
-	}
-	state.Playlists = append([]Playlist{{Name: FavoritesKey, Tracks: []string{}}}, state.Playlists...)
-}
@@ -0,0 +1,217 @@
+package state
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TrackStats holds listening statistics for one track, keyed by its path in
+// State.TrackStats.
+type TrackStats struct {
+	PlayCount    int     `json:"playCount"`
+	SkipCount    int     `json:"skipCount"`
+	LastPlayedAt int64   `json:"lastPlayedAt"`
+	Rating       float64 `json:"rating"`
+}
+
+func (s *Store) GetAllTrackStats() (map[string]TrackStats, error) {
+	state, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	if state.TrackStats == nil {
+		return map[string]TrackStats{}, nil
+	}
+	return state.TrackStats, nil
+}
+
+// GetTrackStats returns the statistics of the track at path, resolved the
+// same way as when they were recorded.
+func (s *Store) GetTrackStats(path string) (TrackStats, error) {
+	path, err := s.resolveTrackPath(strings.TrimSpace(path))
+	if err != nil {
+		return TrackStats{}, err
+	}
+	stats, err := s.GetAllTrackStats()
+	if err != nil {
+		return TrackStats{}, err
+	}
+	return stats[path], nil
+}
+
+// RateTrack sets a track's rating, 0 to 5 stars in half-star steps; 0
+// clears it. The path must be a track in a music folder; stats are kept
+// under its canonical path.
+func (s *Store) RateTrack(path string, rating float64) (TrackStats, error) {
+	path, err := s.resolveTrackPath(strings.TrimSpace(path))
+	if err != nil {
+		return TrackStats{}, err
+	}
+	if math.IsNaN(rating) || rating < 0 || rating > 5 || rating*2 != math.Trunc(rating*2) {
+		return TrackStats{}, errors.New("rating must be 0 to 5 in half-star steps")
+	}
+	var stats TrackStats
+	_, err = s.Update(func(state *State) error {
+		if state.TrackStats == nil {
+			state.TrackStats = make(map[string]TrackStats)
+		}
+		stats = state.TrackStats[path]
+		stats.Rating = rating
+		setTrackStats(state, path, stats)
+		return nil
+	})
+	return stats, err
+}
+
+// recordPlayStats counts a play in the track's statistics: completed plays
+// raise the play count and last-played time, skips the skip count.
+// RecordPlay has already resolved record.Path to the track's canonical path.
+func (s *Store) recordPlayStats(record PlayRecord) error {
+	_, err := s.Update(func(state *State) error {
+		if state.TrackStats == nil {
+			state.TrackStats = make(map[string]TrackStats)
+		}
+		stats := state.TrackStats[record.Path]
+		if record.Outcome == PlaySkipped {
+			stats.SkipCount++
+		} else {
+			stats.PlayCount++
+			stats.LastPlayedAt = max(stats.LastPlayedAt, record.StartedAt)
+		}
+		setTrackStats(state, record.Path, stats)
+		return nil
+	})
+	return err
+}
+
+// setTrackStats stores stats for path, dropping the entry once it holds
+// nothing.
+func setTrackStats(state *State, path string, stats TrackStats) {
+	if stats == (TrackStats{}) {
+		delete(state.TrackStats, path)
+		return
+	}
+	state.TrackStats[path] = stats
+}
+
+// MergeTrackStats folds statistics read from elsewhere, such as file tags,
+// into the state the way MergeLibrary does, without a snapshot. It returns
+// how many tracks changed and saves nothing when none did.
+func (s *Store) MergeTrackStats(stats map[string]TrackStats) (int, error) {
+	state, err := s.Load()
+	if err != nil {
+		return 0, err
+	}
+	if mergeLibrary(&state, LibraryMerge{Stats: stats}, nil).StatsUpdated == 0 {
+		return 0, nil
+	}
+	updated := 0
+	_, err = s.Update(func(state *State) error {
+		updated = mergeLibrary(state, LibraryMerge{Stats: stats}, nil).StatsUpdated
+		return nil
+	})
+	return updated, err
+}
+
+// ImportedPlaylist is a playlist brought over from another player, with its
+// tracks already mapped onto library paths.
+type ImportedPlaylist struct {
+	Name   string
+	Tracks []string
+}
+
+// LibraryMerge is listening data and playlists imported from another player.
+type LibraryMerge struct {
+	Stats     map[string]TrackStats
+	Playlists []ImportedPlaylist
+}
+
+type LibraryMergeResult struct {
+	StatsUpdated     int      `json:"statsUpdated"`
+	PlaylistsCreated []string `json:"playlistsCreated"`
+	PlaylistsUpdated []string `json:"playlistsUpdated"`
+	EntriesAdded     int      `json:"entriesAdded"`
+}
+
+// MergeLibrary folds imported data into the state. Play and skip counts and
+// the last-played time keep the larger value, so importing the same library
+// twice changes nothing, and an imported rating only fills in tracks that
+// have none. Playlists are created, or extended with the tracks they lack
+// when a playlist of the same name exists. With dryRun set nothing is saved
+// and the result describes what would change.
+func (s *Store) MergeLibrary(merge LibraryMerge, dryRun bool) (LibraryMergeResult, error) {
+	dirs, err := s.ResolveMusicDirs()
+	if err != nil {
+		return LibraryMergeResult{}, err
+	}
+	var result LibraryMergeResult
+	if dryRun {
+		state, err := s.Load()
+		if err != nil {
+			return LibraryMergeResult{}, err
+		}
+		return mergeLibrary(&state, merge, dirs), nil
+	}
+	_, err = s.updateWithSnapshot(SnapshotImportLibrary, func(state *State) error {
+		result = mergeLibrary(state, merge, dirs)
+		return nil
+	})
+	return result, err
+}
+
+func mergeLibrary(state *State, merge LibraryMerge, dirs []string) LibraryMergeResult {
+	result := LibraryMergeResult{PlaylistsCreated: []string{}, PlaylistsUpdated: []string{}}
+	if state.TrackStats == nil {
+		state.TrackStats = make(map[string]TrackStats)
+	}
+	for path, imported := range merge.Stats {
+		existing := state.TrackStats[path]
+		merged := existing
+		merged.PlayCount = max(existing.PlayCount, imported.PlayCount)
+		merged.SkipCount = max(existing.SkipCount, imported.SkipCount)
+		merged.LastPlayedAt = max(existing.LastPlayedAt, imported.LastPlayedAt)
+		if merged.Rating == 0 {
+			merged.Rating = imported.Rating
+		}
+		if merged != existing {
+			state.TrackStats[path] = merged
+			result.StatsUpdated++
+		}
+	}
+	for _, imported := range merge.Playlists {
+		name, err := validatePlaylistName(imported.Name)
+		if err != nil {
+			continue
+		}
+		index := findPlaylist(state.Playlists, name)
+		if index < 0 {
+			unique := name
+			for n := 2; playlistNameInUse(state, unique, ""); n++ {
+				unique = name + " (" + strconv.Itoa(n) + ")"
+			}
+			appendPlaylist(state, newPlaylist(unique))
+			index = len(state.Playlists) - 1
+			result.PlaylistsCreated = append(result.PlaylistsCreated, unique)
+		}
+		playlist := &state.Playlists[index]
+		added := 0
+		for _, path := range imported.Tracks {
+			absFile, err := resolveTrackPathIn(dirs, path)
+			if err != nil || playlist.containsPath(absFile) {
+				continue
+			}
+			playlist.Entries = append(playlist.Entries, newPlaylistEntry(absFile))
+			added++
+		}
+		if added > 0 {
+			playlist.touch()
+			result.EntriesAdded += added
+			if !containsString(result.PlaylistsCreated, playlist.Name) {
+				result.PlaylistsUpdated = append(result.PlaylistsUpdated, playlist.Name)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,464 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SnapshotSync labels the snapshot taken before changes from other devices
+// remove playlists or entries.
+const SnapshotSync = "sync"
+
+// ChangeFromSync marks changes merged in from other devices.
+const ChangeFromSync = "sync"
+
+// syncFolderName is the folder inside the shared directory that holds one
+// change log per device.
+const syncFolderName = "litesound-sync"
+
+// syncConfigFileName is this device's sync setup next to state.json.
+const syncConfigFileName = "sync.json"
+
+// syncConfig is this device's sync setup, kept in sync.json next to the
+// profile's state.json and never shared. Base is the shared part of the
+// state as of the last sync, which the next sync diffs against to find
+// local changes.
+type syncConfig struct {
+	Dir        string         `json:"dir"`
+	DeviceID   string         `json:"deviceId"`
+	DeviceName string         `json:"deviceName"`
+	Seq        int            `json:"seq"`
+	Seen       map[string]int `json:"seen"`
+	Base       *syncDoc       `json:"base"`
+	LastSyncAt int64          `json:"lastSyncAt"`
+	Dismissed  []string       `json:"dismissed"`
+	Conflicts  []SyncConflict `json:"conflicts"`
+}
+
+type SyncDevice struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	LastSeenAt int64  `json:"lastSeenAt"`
+	Changes    int    `json:"changes"`
+	This       bool   `json:"this"`
+}
+
+type SyncStatus struct {
+	Enabled    bool         `json:"enabled"`
+	Dir        string       `json:"dir"`
+	DeviceID   string       `json:"deviceId"`
+	DeviceName string       `json:"deviceName"`
+	LastSyncAt int64        `json:"lastSyncAt"`
+	LastError  string       `json:"lastError"`
+	Devices    []SyncDevice `json:"devices"`
+	Conflicts  int          `json:"conflicts"`
+}
+
+type SyncResult struct {
+	Exported int  `json:"exported"`
+	Imported int  `json:"imported"`
+	Changed  bool `json:"changed"`
+}
+
+// syncLog is a device's change log as last read, kept until the file
+// changes.
+type syncLog struct {
+	stamp   fileStamp
+	batches []*syncBatch
+}
+
+func (s *Store) syncConfigPath() (string, error) {
+	statePath, err := s.stateFilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(statePath), syncConfigFileName), nil
+}
+
+func (s *Store) readSyncConfig() (syncConfig, error) {
+	config := syncConfig{}
+	path, err := s.syncConfigPath()
+	if err != nil {
+		return config, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return syncConfig{}, err
+	}
+	return config, nil
+}
+
+func (s *Store) writeSyncConfig(config syncConfig) error {
+	path, err := s.syncConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// EnableSync starts sharing playlists, theme and filters through dir, a
+// folder that a tool such as Syncthing keeps the same on every device. The
+// first sync sends the whole shared state; devices already using the folder
+// keep their theme and filters.
+func (s *Store) EnableSync(dir string, deviceName string) (SyncStatus, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return SyncStatus{}, errors.New("sync folder is required")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return SyncStatus{}, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return SyncStatus{}, err
+	}
+	if !info.IsDir() {
+		return SyncStatus{}, errors.New("path is not a directory")
+	}
+	if err := os.MkdirAll(filepath.Join(abs, syncFolderName), 0o755); err != nil {
+		return SyncStatus{}, err
+	}
+	deviceName = strings.TrimSpace(deviceName)
+	if deviceName == "" {
+		deviceName, _ = os.Hostname()
+	}
+
+	s.syncMu.Lock()
+	config, err := s.readSyncConfig()
+	if err != nil {
+		s.syncMu.Unlock()
+		return SyncStatus{}, err
+	}
+	if config.DeviceID == "" {
+		config.DeviceID = newID()
+	}
+	if config.Dir != abs {
+		config.Base = nil
+		config.Seen = nil
+		config.Conflicts = nil
+	}
+	config.Dir = abs
+	config.DeviceName = deviceName
+	err = s.writeSyncConfig(config)
+	s.syncMu.Unlock()
+	if err != nil {
+		return SyncStatus{}, err
+	}
+	return s.SyncStatus()
+}
+
+// DisableSync stops syncing. The change logs stay in the shared folder.
+func (s *Store) DisableSync() error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	config, err := s.readSyncConfig()
+	if err != nil {
+		return err
+	}
+	config.Dir = ""
+	config.Base = nil
+	config.Seen = nil
+	config.Conflicts = nil
+	s.syncErr = ""
+	return s.writeSyncConfig(config)
+}
+
+func (s *Store) SyncStatus() (SyncStatus, error) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	config, err := s.readSyncConfig()
+	if err != nil {
+		return SyncStatus{}, err
+	}
+	status := SyncStatus{
+		Enabled:    config.Dir != "",
+		Dir:        config.Dir,
+		DeviceID:   config.DeviceID,
+		DeviceName: config.DeviceName,
+		LastSyncAt: config.LastSyncAt,
+		LastError:  s.syncErr,
+		Devices:    []SyncDevice{},
+		Conflicts:  len(activeConflicts(config)),
+	}
+	if !status.Enabled {
+		return status, nil
+	}
+	logs, err := s.readSyncLogs(config.Dir)
+	if err != nil {
+		return status, err
+	}
+	for device, batches := range logs {
+		entry := SyncDevice{ID: device, This: device == config.DeviceID}
+		for _, batch := range batches {
+			entry.Changes += len(batch.Ops)
+			if batch.At >= entry.LastSeenAt {
+				entry.LastSeenAt = batch.At
+				if batch.Name != "" {
+					entry.Name = batch.Name
+				}
+			}
+		}
+		status.Devices = append(status.Devices, entry)
+	}
+	slices.SortFunc(status.Devices, func(a SyncDevice, b SyncDevice) int { return strings.Compare(a.ID, b.ID) })
+	return status, nil
+}
+
+// SyncConflicts returns the conflicts found by the last sync that have not
+// been dismissed, newest first.
+func (s *Store) SyncConflicts() ([]SyncConflict, error) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	config, err := s.readSyncConfig()
+	if err != nil {
+		return nil, err
+	}
+	return activeConflicts(config), nil
+}
+
+func (s *Store) DismissSyncConflict(id string) error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	config, err := s.readSyncConfig()
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(config.Conflicts, func(conflict SyncConflict) bool { return conflict.ID == id }) {
+		return errors.New("conflict not found")
+	}
+	if !slices.Contains(config.Dismissed, id) {
+		config.Dismissed = append(config.Dismissed, id)
+	}
+	return s.writeSyncConfig(config)
+}
+
+func activeConflicts(config syncConfig) []SyncConflict {
+	conflicts := make([]SyncConflict, 0, len(config.Conflicts))
+	for _, conflict := range config.Conflicts {
+		if !slices.Contains(config.Dismissed, conflict.ID) {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts
+}
+
+// SyncNow writes local changes made since the last sync to this device's
+// change log, merges every device's log, and applies the result. The merge
+// only depends on the logs, so all devices end up with the same playlists,
+// theme and filters once they have each other's logs.
+func (s *Store) SyncNow() (SyncResult, error) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	result, err := s.syncNow()
+	s.syncErr = ""
+	if err != nil {
+		s.syncErr = err.Error()
+	}
+	return result, err
+}
+
+func (s *Store) syncNow() (SyncResult, error) {
+	var result SyncResult
+	config, err := s.readSyncConfig()
+	if err != nil {
+		return result, err
+	}
+	if config.Dir == "" {
+		return result, errors.New("sync is not enabled")
+	}
+	logs, err := s.readSyncLogs(config.Dir)
+	if err != nil {
+		return result, err
+	}
+	batches := make([]*syncBatch, 0)
+	seen := make(map[string]int)
+	remote := false
+	for device, deviceBatches := range logs {
+		for _, batch := range deviceBatches {
+			batches = append(batches, batch)
+			if device == config.DeviceID {
+				config.Seq = max(config.Seq, batch.Seq)
+				continue
+			}
+			remote = true
+			seen[device] = max(seen[device], batch.Seq)
+			if batch.Seq > config.Seen[device] {
+				result.Imported++
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureLoaded(); err != nil {
+		return result, err
+	}
+	base := syncDoc{}
+	if config.Base != nil {
+		base = *config.Base
+	}
+	// A device joining a folder that is already in use takes the theme and
+	// filters from it rather than imposing its own.
+	scalars := config.Base != nil || !remote
+	ops := diffSyncDocs(base, projectSyncDoc(&s.state), scalars)
+	if len(ops) > 0 {
+		batch := &syncBatch{
+			Device: config.DeviceID,
+			Name:   config.DeviceName,
+			Seq:    config.Seq + 1,
+			At:     time.Now().UnixMilli(),
+			Seen:   config.Seen,
+			Ops:    ops,
+		}
+		if err := appendSyncBatch(filepath.Join(config.Dir, syncFolderName, config.DeviceID+".jsonl"), batch); err != nil {
+			return result, err
+		}
+		config.Seq = batch.Seq
+		batches = append(batches, batch)
+		result.Exported = len(ops)
+	}
+
+	doc, conflicts := mergeSyncBatches(batches)
+	next := s.state.clone()
+	removed := applySyncDoc(&next, doc, base)
+	if len(changedKinds(&s.state, &next)) > 0 {
+		if removed {
+			if _, err := s.takeSnapshot(SnapshotSync, s.state); err != nil {
+				return result, err
+			}
+		}
+		previous := s.state
+		s.state = next
+		s.publish(&previous, &s.state, ChangeFromSync)
+		s.markDirty()
+		result.Changed = true
+	}
+
+	merged := projectSyncDoc(&s.state)
+	config.Base = &merged
+	config.Seen = seen
+	config.Conflicts = conflicts
+	config.LastSyncAt = time.Now().UnixMilli()
+	return result, s.writeSyncConfig(config)
+}
+
+// StartSync runs SyncNow every interval while sync is enabled, until the
+// returned function is called.
+func (s *Store) StartSync(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if status, err := s.SyncStatus(); err == nil && status.Enabled {
+					_, _ = s.SyncNow()
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func appendSyncBatch(path string, batch *syncBatch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	// A batch cut short by a crash or a partial copy is finished off so the
+	// new one starts on a line of its own.
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readSyncLogs returns every device's batches, by device ID. Logs that have
+// not changed since they were last read come from memory. Lines that do not
+// parse, such as one still being copied in by the sync tool, are skipped
+// and read again once the file changes.
+func (s *Store) readSyncLogs(dir string) (map[string][]*syncBatch, error) {
+	folder := filepath.Join(dir, syncFolderName)
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, err
+	}
+	if s.syncLogs == nil {
+		s.syncLogs = make(map[string]*syncLog)
+	}
+	logs := make(map[string][]*syncBatch)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+		device := strings.TrimSuffix(name, ".jsonl")
+		path := filepath.Join(folder, name)
+		stamp := stampFile(path)
+		cached := s.syncLogs[path]
+		if cached == nil || cached.stamp != stamp {
+			batches, err := parseSyncLog(path, device)
+			if err != nil {
+				return nil, err
+			}
+			cached = &syncLog{stamp: stamp, batches: batches}
+			s.syncLogs[path] = cached
+		}
+		logs[device] = cached.batches
+	}
+	return logs, nil
+}
+
+func parseSyncLog(path string, device string) ([]*syncBatch, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	batches := make([]*syncBatch, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		batch := &syncBatch{}
+		if err := json.Unmarshal(scanner.Bytes(), batch); err != nil || batch.Device != device || batch.Seq <= 0 {
+			continue
+		}
+		batches = append(batches, batch)
+	}
+	return batches, scanner.Err()
+}
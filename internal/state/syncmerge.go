@@ -0,0 +1,587 @@
+package state
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// syncDoc is the part of the state that sync shares between devices, with
+// entries stored relative to their music root like in state.json. Playlists
+// kept in sync with a local folder are left out, since each device builds
+// those from its own files.
+type syncDoc struct {
+	Theme          string         `json:"theme"`
+	ComposerFilter string         `json:"composerFilter"`
+	AlbumFilter    string         `json:"albumFilter"`
+	Playlists      []syncPlaylist `json:"playlists"`
+}
+
+type syncPlaylist struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Entries     []syncEntry `json:"entries"`
+}
+
+type syncEntry struct {
+	ID      string `json:"id"`
+	Root    string `json:"root,omitempty"`
+	Path    string `json:"path"`
+	AddedAt int64  `json:"addedAt"`
+}
+
+// Operations in a change log.
+const (
+	syncSet            = "set"
+	syncSetPlaylist    = "setPlaylist"
+	syncDeletePlaylist = "deletePlaylist"
+	syncAddEntry       = "addEntry"
+	syncRemoveEntry    = "removeEntry"
+	syncOrderEntries   = "orderEntries"
+)
+
+type syncOp struct {
+	Op       string     `json:"op"`
+	Playlist string     `json:"playlist,omitempty"`
+	Field    string     `json:"field,omitempty"`
+	Value    string     `json:"value,omitempty"`
+	Entry    *syncEntry `json:"entry,omitempty"`
+	EntryID  string     `json:"entryId,omitempty"`
+	Order    []string   `json:"order,omitempty"`
+}
+
+// syncBatch is one line of a device's change log: the changes it made
+// between two syncs. Seen holds, for every other device, the last batch it
+// had merged when it wrote this one, which tells concurrent changes from
+// ones made with knowledge of each other.
+type syncBatch struct {
+	Device string         `json:"device"`
+	Name   string         `json:"name"`
+	Seq    int            `json:"seq"`
+	At     int64          `json:"at"`
+	Seen   map[string]int `json:"seen"`
+	Ops    []syncOp       `json:"ops"`
+}
+
+// happenedBefore reports whether the device that wrote b knew of a.
+func (a *syncBatch) happenedBefore(b *syncBatch) bool {
+	if a.Device == b.Device {
+		return a.Seq < b.Seq
+	}
+	return b.Seen[a.Device] >= a.Seq
+}
+
+func concurrent(a *syncBatch, b *syncBatch) bool {
+	return !a.happenedBefore(b) && !b.happenedBefore(a)
+}
+
+// Kinds of sync conflict.
+const (
+	SyncConflictValue   = "value"
+	SyncConflictDeleted = "deleted"
+	SyncConflictName    = "name"
+)
+
+// SyncConflict is a change that lost to a concurrent change on another
+// device. Value conflicts are two devices setting the same field; the later
+// write is kept. Deleted conflicts are edits to a playlist that another
+// device deleted at the same time; the deletion is kept. Name conflicts are
+// two devices creating playlists with the same name; the later one is
+// renamed.
+type SyncConflict struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	Playlist   string `json:"playlist"`
+	Field      string `json:"field"`
+	Kept       string `json:"kept"`
+	Lost       string `json:"lost"`
+	KeptDevice string `json:"keptDevice"`
+	LostDevice string `json:"lostDevice"`
+	At         int64  `json:"at"`
+}
+
+// projectSyncDoc builds the shared part of state.
+func projectSyncDoc(state *State) syncDoc {
+	roots := musicRootsFor(state)
+	doc := syncDoc{
+		Theme:          state.Theme,
+		ComposerFilter: state.ComposerFilter,
+		AlbumFilter:    state.AlbumFilter,
+		Playlists:      make([]syncPlaylist, 0, len(state.Playlists)),
+	}
+	for _, playlist := range state.Playlists {
+		if playlist.Source != nil {
+			continue
+		}
+		shared := syncPlaylist{
+			ID:          playlist.ID,
+			Name:        playlist.Name,
+			Description: playlist.Description,
+			Entries:     make([]syncEntry, 0, len(playlist.Entries)),
+		}
+		for _, entry := range playlist.Entries {
+			item := syncEntry{ID: entry.ID, Root: entry.Root, Path: entry.Path, AddedAt: entry.AddedAt}
+			if item.Root == "" {
+				if root, relative, ok := relativeToRoot(roots, entry.Path); ok {
+					item.Root, item.Path = root, relative
+				}
+			}
+			shared.Entries = append(shared.Entries, item)
+		}
+		doc.Playlists = append(doc.Playlists, shared)
+	}
+	return doc
+}
+
+// diffSyncDocs returns the operations that turn base into current. With
+// scalars unset, theme and filter changes are left out.
+func diffSyncDocs(base syncDoc, current syncDoc, scalars bool) []syncOp {
+	ops := make([]syncOp, 0)
+	if scalars {
+		for _, field := range []struct{ name, before, after string }{
+			{"theme", base.Theme, current.Theme},
+			{"composerFilter", base.ComposerFilter, current.ComposerFilter},
+			{"albumFilter", base.AlbumFilter, current.AlbumFilter},
+		} {
+			if field.before != field.after {
+				ops = append(ops, syncOp{Op: syncSet, Field: field.name, Value: field.after})
+			}
+		}
+	}
+	previous := make(map[string]*syncPlaylist, len(base.Playlists))
+	for i := range base.Playlists {
+		previous[base.Playlists[i].ID] = &base.Playlists[i]
+	}
+	for _, playlist := range current.Playlists {
+		before, ok := previous[playlist.ID]
+		delete(previous, playlist.ID)
+		if !ok {
+			before = &syncPlaylist{ID: playlist.ID}
+		}
+		if playlist.Name != before.Name {
+			ops = append(ops, syncOp{Op: syncSetPlaylist, Playlist: playlist.ID, Field: "name", Value: playlist.Name})
+		}
+		if playlist.Description != before.Description {
+			ops = append(ops, syncOp{Op: syncSetPlaylist, Playlist: playlist.ID, Field: "description", Value: playlist.Description})
+		}
+		had := make(map[string]struct{}, len(before.Entries))
+		for _, entry := range before.Entries {
+			had[entry.ID] = struct{}{}
+		}
+		has := make(map[string]struct{}, len(playlist.Entries))
+		for _, entry := range playlist.Entries {
+			has[entry.ID] = struct{}{}
+			if _, ok := had[entry.ID]; !ok {
+				added := entry
+				ops = append(ops, syncOp{Op: syncAddEntry, Playlist: playlist.ID, Entry: &added})
+			}
+		}
+		for _, entry := range before.Entries {
+			if _, ok := has[entry.ID]; !ok {
+				ops = append(ops, syncOp{Op: syncRemoveEntry, Playlist: playlist.ID, EntryID: entry.ID})
+			}
+		}
+		order := entryIDs(playlist.Entries)
+		if !slices.Equal(order, entryIDs(before.Entries)) {
+			ops = append(ops, syncOp{Op: syncOrderEntries, Playlist: playlist.ID, Order: order})
+		}
+	}
+	for _, playlist := range base.Playlists {
+		if _, ok := previous[playlist.ID]; ok {
+			ops = append(ops, syncOp{Op: syncDeletePlaylist, Playlist: playlist.ID})
+		}
+	}
+	return ops
+}
+
+func entryIDs(entries []syncEntry) []string {
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	return ids
+}
+
+type syncValue struct {
+	value string
+	by    *syncBatch
+}
+
+type mergedEntry struct {
+	entry   syncEntry
+	removed bool
+}
+
+type mergedPlaylist struct {
+	id          string
+	created     *syncBatch
+	name        syncValue
+	description syncValue
+	order       []string
+	deleted     *syncBatch
+	editedBy    []*syncBatch
+	entries     map[string]*mergedEntry
+	added       []string
+}
+
+// syncMerge folds change logs into a document. Batches are applied in one
+// order that every device agrees on, by time, then device, then sequence,
+// so all devices arrive at the same result from the same logs.
+type syncMerge struct {
+	scalars   map[string]syncValue
+	playlists map[string]*mergedPlaylist
+	conflicts map[string]SyncConflict
+	names     map[string]string
+}
+
+func mergeSyncBatches(batches []*syncBatch) (syncDoc, []SyncConflict) {
+	sorted := slices.Clone(batches)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.At != b.At {
+			return a.At < b.At
+		}
+		if a.Device != b.Device {
+			return a.Device < b.Device
+		}
+		return a.Seq < b.Seq
+	})
+	merge := syncMerge{
+		scalars:   make(map[string]syncValue),
+		playlists: make(map[string]*mergedPlaylist),
+		conflicts: make(map[string]SyncConflict),
+		names:     make(map[string]string),
+	}
+	for _, batch := range sorted {
+		if batch.Name != "" {
+			merge.names[batch.Device] = batch.Name
+		}
+	}
+	for _, batch := range sorted {
+		for _, op := range batch.Ops {
+			merge.apply(batch, op)
+		}
+	}
+	return merge.result()
+}
+
+func (m *syncMerge) apply(batch *syncBatch, op syncOp) {
+	if op.Op == syncSet {
+		previous := m.scalars[op.Field]
+		if previous.by != nil && previous.value != op.Value && concurrent(previous.by, batch) {
+			m.conflict(SyncConflictValue, "", op.Field, op.Value, previous.value, batch, previous.by)
+		}
+		m.scalars[op.Field] = syncValue{value: op.Value, by: batch}
+		return
+	}
+	if op.Playlist == "" {
+		return
+	}
+	playlist := m.playlists[op.Playlist]
+	if playlist == nil {
+		playlist = &mergedPlaylist{id: op.Playlist, created: batch, entries: make(map[string]*mergedEntry)}
+		m.playlists[op.Playlist] = playlist
+	}
+	if op.Op == syncDeletePlaylist {
+		if playlist.deleted != nil {
+			return
+		}
+		playlist.deleted = batch
+		for _, editor := range playlist.editedBy {
+			if concurrent(editor, batch) {
+				m.conflict(SyncConflictDeleted, playlist.name.value, "", "", "", batch, editor)
+			}
+		}
+		return
+	}
+	if playlist.deleted != nil {
+		if concurrent(playlist.deleted, batch) {
+			m.conflict(SyncConflictDeleted, playlist.name.value, "", "", "", playlist.deleted, batch)
+		}
+		return
+	}
+	if !slices.Contains(playlist.editedBy, batch) {
+		playlist.editedBy = append(playlist.editedBy, batch)
+	}
+	switch op.Op {
+	case syncSetPlaylist:
+		target := &playlist.name
+		if op.Field == "description" {
+			target = &playlist.description
+		} else if op.Field != "name" {
+			return
+		}
+		if target.by != nil && target.value != op.Value && concurrent(target.by, batch) {
+			m.conflict(SyncConflictValue, playlist.name.value, op.Field, op.Value, target.value, batch, target.by)
+		}
+		*target = syncValue{value: op.Value, by: batch}
+	case syncAddEntry:
+		if op.Entry == nil || op.Entry.ID == "" {
+			return
+		}
+		if _, ok := playlist.entries[op.Entry.ID]; ok {
+			return
+		}
+		playlist.entries[op.Entry.ID] = &mergedEntry{entry: *op.Entry}
+		playlist.added = append(playlist.added, op.Entry.ID)
+	case syncRemoveEntry:
+		if entry, ok := playlist.entries[op.EntryID]; ok {
+			entry.removed = true
+		} else if op.EntryID != "" {
+			playlist.entries[op.EntryID] = &mergedEntry{removed: true}
+		}
+	case syncOrderEntries:
+		playlist.order = slices.Clone(op.Order)
+	}
+}
+
+func (m *syncMerge) conflict(kind string, playlist string, field string, kept string, lost string, keptBy *syncBatch, lostBy *syncBatch) {
+	key := strings.Join([]string{
+		kind, playlist, field,
+		keptBy.Device, strconv.Itoa(keptBy.Seq),
+		lostBy.Device, strconv.Itoa(lostBy.Seq),
+	}, "\x00")
+	sum := sha1.Sum([]byte(key))
+	id := hex.EncodeToString(sum[:8])
+	if _, ok := m.conflicts[id]; ok {
+		return
+	}
+	m.conflicts[id] = SyncConflict{
+		ID:         id,
+		Kind:       kind,
+		Playlist:   playlist,
+		Field:      field,
+		Kept:       kept,
+		Lost:       lost,
+		KeptDevice: m.deviceName(keptBy.Device),
+		LostDevice: m.deviceName(lostBy.Device),
+		At:         max(keptBy.At, lostBy.At),
+	}
+}
+
+func (m *syncMerge) deviceName(id string) string {
+	if name := m.names[id]; name != "" {
+		return name
+	}
+	return id
+}
+
+func (m *syncMerge) result() (syncDoc, []SyncConflict) {
+	doc := syncDoc{
+		Theme:          m.scalars["theme"].value,
+		ComposerFilter: m.scalars["composerFilter"].value,
+		AlbumFilter:    m.scalars["albumFilter"].value,
+		Playlists:      make([]syncPlaylist, 0, len(m.playlists)),
+	}
+	live := make([]*mergedPlaylist, 0, len(m.playlists))
+	for _, playlist := range m.playlists {
+		if playlist.deleted == nil && strings.TrimSpace(playlist.name.value) != "" {
+			live = append(live, playlist)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool {
+		a, b := live[i].created, live[j].created
+		if a.At != b.At {
+			return a.At < b.At
+		}
+		if a.Device != b.Device {
+			return a.Device < b.Device
+		}
+		if a.Seq != b.Seq {
+			return a.Seq < b.Seq
+		}
+		return live[i].id < live[j].id
+	})
+	taken := make(map[string]struct{}, len(live))
+	for _, playlist := range live {
+		name := playlist.name.value
+		unique := name
+		for n := 2; ; n++ {
+			if _, ok := taken[strings.ToLower(unique)]; !ok {
+				break
+			}
+			unique = name + " (" + strconv.Itoa(n) + ")"
+		}
+		if unique != name {
+			m.conflict(SyncConflictName, name, "name", unique, name, playlist.name.by, playlist.created)
+		}
+		taken[strings.ToLower(unique)] = struct{}{}
+		shared := syncPlaylist{
+			ID:          playlist.id,
+			Name:        unique,
+			Description: playlist.description.value,
+			Entries:     make([]syncEntry, 0, len(playlist.added)),
+		}
+		keep := playlist.firstEntries()
+		placed := make(map[string]struct{}, len(playlist.added))
+		for _, ids := range [][]string{playlist.order, playlist.added} {
+			for _, id := range ids {
+				entry, ok := playlist.entries[id]
+				if !ok || entry.removed || keep[entry.key()] != id {
+					continue
+				}
+				if _, ok := placed[id]; ok {
+					continue
+				}
+				placed[id] = struct{}{}
+				shared.Entries = append(shared.Entries, entry.entry)
+			}
+		}
+		doc.Playlists = append(doc.Playlists, shared)
+	}
+	conflicts := make([]SyncConflict, 0, len(m.conflicts))
+	for _, conflict := range m.conflicts {
+		conflicts = append(conflicts, conflict)
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].At != conflicts[j].At {
+			return conflicts[i].At > conflicts[j].At
+		}
+		return conflicts[i].ID < conflicts[j].ID
+	})
+	return doc, conflicts
+}
+
+func (e *mergedEntry) key() string {
+	return strings.ToLower(e.entry.Root + "\x00" + filepath.ToSlash(e.entry.Path))
+}
+
+// firstEntries picks, for each track, the entry that was added first, by
+// time and then ID. Devices adding the same track while offline each make
+// an entry of their own, and a playlist holds a track only once.
+func (p *mergedPlaylist) firstEntries() map[string]string {
+	first := make(map[string]*mergedEntry, len(p.entries))
+	for _, entry := range p.entries {
+		if entry.removed {
+			continue
+		}
+		key := entry.key()
+		current, ok := first[key]
+		if !ok || entry.entry.AddedAt < current.entry.AddedAt ||
+			(entry.entry.AddedAt == current.entry.AddedAt && entry.entry.ID < current.entry.ID) {
+			first[key] = entry
+		}
+	}
+	ids := make(map[string]string, len(first))
+	for key, entry := range first {
+		ids[key] = entry.entry.ID
+	}
+	return ids
+}
+
+// applySyncDoc makes the shared part of state match doc. Playlists that
+// were shared before (they are in base) and are missing from doc were
+// deleted elsewhere and are removed. It reports whether any playlist or
+// entry was removed.
+func applySyncDoc(state *State, doc syncDoc, base syncDoc) bool {
+	removed := false
+	if theme, err := NormalizeTheme(doc.Theme); err == nil && doc.Theme != "" {
+		state.Theme = theme
+	}
+	state.ComposerFilter = doc.ComposerFilter
+	state.AlbumFilter = doc.AlbumFilter
+
+	// Names in doc are unique among shared playlists, but may clash with
+	// playlists that stay local: folder playlists and smart playlists. The
+	// shared playlist is then given a suffixed name on this device only.
+	local := make(map[string]struct{})
+	for _, playlist := range state.Playlists {
+		if playlist.Source != nil {
+			local[strings.ToLower(playlist.Name)] = struct{}{}
+		}
+	}
+	for _, playlist := range state.SmartPlaylists {
+		local[strings.ToLower(playlist.Name)] = struct{}{}
+	}
+	sharedNames := make(map[string]struct{}, len(doc.Playlists))
+	for _, shared := range doc.Playlists {
+		sharedNames[strings.ToLower(shared.Name)] = struct{}{}
+	}
+	assigned := make(map[string]struct{}, len(doc.Playlists))
+	localName := func(name string) string {
+		unique := name
+		for n := 2; ; n++ {
+			key := strings.ToLower(unique)
+			_, isLocal := local[key]
+			_, isAssigned := assigned[key]
+			_, isShared := sharedNames[key]
+			if !isLocal && !isAssigned && (unique == name || !isShared) {
+				break
+			}
+			unique = name + " (" + strconv.Itoa(n) + ")"
+		}
+		assigned[strings.ToLower(unique)] = struct{}{}
+		return unique
+	}
+
+	roots := musicRootsFor(state)
+	wanted := make(map[string]struct{}, len(doc.Playlists))
+	for _, shared := range doc.Playlists {
+		wanted[shared.ID] = struct{}{}
+		name := localName(shared.Name)
+		entries := make([]PlaylistEntry, 0, len(shared.Entries))
+		for _, item := range shared.Entries {
+			entry := PlaylistEntry{ID: item.ID, Path: item.Path, Root: item.Root, AddedAt: item.AddedAt}
+			if entry.Root != "" {
+				if resolved, ok := resolveRootRelative(roots, entry.Root, filepath.FromSlash(entry.Path)); ok {
+					entry.Path, entry.Root = resolved, ""
+				}
+			}
+			entries = append(entries, entry)
+		}
+		index := slices.IndexFunc(state.Playlists, func(playlist Playlist) bool { return playlist.ID == shared.ID })
+		if index < 0 {
+			playlist := newPlaylist(name)
+			playlist.ID = shared.ID
+			playlist.Description = shared.Description
+			playlist.Entries = entries
+			playlist.syncTracks()
+			appendPlaylist(state, playlist)
+			continue
+		}
+		playlist := &state.Playlists[index]
+		if len(entries) < len(playlist.Entries) {
+			removed = true
+		}
+		if playlist.Name != name || playlist.Description != shared.Description || !sameEntries(playlist.Entries, entries) {
+			if strings.EqualFold(state.ActivePlaylist, playlist.Name) {
+				state.ActivePlaylist = name
+			}
+			playlist.Name = name
+			playlist.Description = shared.Description
+			playlist.Entries = entries
+			playlist.touch()
+		}
+	}
+	shared := make(map[string]struct{}, len(base.Playlists))
+	for _, playlist := range base.Playlists {
+		shared[playlist.ID] = struct{}{}
+	}
+	kept := state.Playlists[:0]
+	for _, playlist := range state.Playlists {
+		_, isWanted := wanted[playlist.ID]
+		_, wasShared := shared[playlist.ID]
+		if playlist.Source == nil && !isWanted && wasShared && playlist.Name != FavoritesKey {
+			removed = true
+			if strings.EqualFold(state.ActivePlaylist, playlist.Name) {
+				state.ActivePlaylist = ""
+			}
+			continue
+		}
+		kept = append(kept, playlist)
+	}
+	state.Playlists = kept
+	normalizePlaylists(state)
+	return removed
+}
+
+func sameEntries(a []PlaylistEntry, b []PlaylistEntry) bool {
+	return slices.EqualFunc(a, b, func(x PlaylistEntry, y PlaylistEntry) bool {
+		return x.ID == y.ID && x.Path == y.Path && x.Root == y.Root
+	})
+}
@@ -0,0 +1,199 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+)
+
+func syncTestBatch(device string, seq int, at int64, seen map[string]int, ops ...syncOp) *syncBatch {
+	return &syncBatch{Device: device, Name: device, Seq: seq, At: at, Seen: seen, Ops: ops}
+}
+
+func createOps(id string, name string) []syncOp {
+	return []syncOp{{Op: syncSetPlaylist, Playlist: id, Field: "name", Value: name}}
+}
+
+func addOp(playlist string, id string, path string, addedAt int64) syncOp {
+	return syncOp{Op: syncAddEntry, Playlist: playlist, Entry: &syncEntry{ID: id, Root: "music", Path: path, AddedAt: addedAt}}
+}
+
+type mergedSummary struct {
+	name    string
+	entries []string
+}
+
+func summarizeSyncDoc(doc syncDoc) []mergedSummary {
+	summary := make([]mergedSummary, 0, len(doc.Playlists))
+	for _, playlist := range doc.Playlists {
+		entries := make([]string, 0, len(playlist.Entries))
+		for _, entry := range playlist.Entries {
+			entries = append(entries, entry.ID)
+		}
+		summary = append(summary, mergedSummary{name: playlist.Name, entries: entries})
+	}
+	return summary
+}
+
+func permutations(batches []*syncBatch) [][]*syncBatch {
+	if len(batches) <= 1 {
+		return [][]*syncBatch{batches}
+	}
+	result := make([][]*syncBatch, 0)
+	for i := range batches {
+		rest := make([]*syncBatch, 0, len(batches)-1)
+		rest = append(rest, batches[:i]...)
+		rest = append(rest, batches[i+1:]...)
+		for _, tail := range permutations(rest) {
+			result = append(result, append([]*syncBatch{batches[i]}, tail...))
+		}
+	}
+	return result
+}
+
+func TestMergeSyncBatches(t *testing.T) {
+	// Device a creates playlist p with two entries; every case starts from
+	// it, and device b has seen it.
+	created := syncTestBatch("a", 1, 100, nil,
+		append(createOps("p", "Road Trip"),
+			addOp("p", "e1", "one.mp3", 100),
+			addOp("p", "e2", "two.mp3", 100),
+		)...)
+	seenCreate := map[string]int{"a": 1}
+
+	tests := []struct {
+		name      string
+		batches   []*syncBatch
+		want      []mergedSummary
+		conflicts []string
+	}{
+		{
+			name: "concurrent renames keep the later one",
+			batches: []*syncBatch{
+				created,
+				syncTestBatch("a", 2, 200, nil, createOps("p", "Drive")...),
+				syncTestBatch("b", 1, 300, seenCreate, createOps("p", "Commute")...),
+			},
+			want:      []mergedSummary{{name: "Commute", entries: []string{"e1", "e2"}}},
+			conflicts: []string{SyncConflictValue},
+		},
+		{
+			name: "a rename made after seeing another is not a conflict",
+			batches: []*syncBatch{
+				created,
+				syncTestBatch("a", 2, 200, nil, createOps("p", "Drive")...),
+				syncTestBatch("b", 1, 300, map[string]int{"a": 2}, createOps("p", "Commute")...),
+			},
+			want: []mergedSummary{{name: "Commute", entries: []string{"e1", "e2"}}},
+		},
+		{
+			name: "delete wins over a later concurrent edit",
+			batches: []*syncBatch{
+				created,
+				syncTestBatch("a", 2, 200, nil, syncOp{Op: syncDeletePlaylist, Playlist: "p"}),
+				syncTestBatch("b", 1, 300, seenCreate, addOp("p", "e3", "three.mp3", 300)),
+			},
+			want:      []mergedSummary{},
+			conflicts: []string{SyncConflictDeleted},
+		},
+		{
+			name: "delete wins over an earlier concurrent edit",
+			batches: []*syncBatch{
+				created,
+				syncTestBatch("b", 1, 200, seenCreate, createOps("p", "Commute")...),
+				syncTestBatch("a", 2, 300, nil, syncOp{Op: syncDeletePlaylist, Playlist: "p"}),
+			},
+			want:      []mergedSummary{},
+			conflicts: []string{SyncConflictDeleted},
+		},
+		{
+			name: "remove and a concurrent add both apply",
+			batches: []*syncBatch{
+				created,
+				syncTestBatch("a", 2, 200, nil, syncOp{Op: syncRemoveEntry, Playlist: "p", EntryID: "e1"}),
+				syncTestBatch("b", 1, 300, seenCreate, addOp("p", "e3", "three.mp3", 300)),
+			},
+			want: []mergedSummary{{name: "Road Trip", entries: []string{"e2", "e3"}}},
+		},
+		{
+			name: "remove of an entry not yet seen still applies",
+			batches: []*syncBatch{
+				created,
+				syncTestBatch("b", 1, 200, seenCreate, syncOp{Op: syncRemoveEntry, Playlist: "p", EntryID: "e3"}),
+				syncTestBatch("a", 2, 300, nil, addOp("p", "e3", "three.mp3", 300)),
+			},
+			want: []mergedSummary{{name: "Road Trip", entries: []string{"e1", "e2"}}},
+		},
+		{
+			name: "the same track added on two devices is kept once",
+			batches: []*syncBatch{
+				created,
+				syncTestBatch("a", 2, 200, nil, addOp("p", "e3", "Three.mp3", 200)),
+				syncTestBatch("b", 1, 300, seenCreate, addOp("p", "e4", "three.mp3", 300)),
+			},
+			want: []mergedSummary{{name: "Road Trip", entries: []string{"e1", "e2", "e3"}}},
+		},
+		{
+			name: "playlists created with the same name are both kept",
+			batches: []*syncBatch{
+				syncTestBatch("a", 1, 100, nil, createOps("p", "Mix")...),
+				syncTestBatch("b", 1, 200, nil, createOps("q", "mix")...),
+			},
+			want: []mergedSummary{
+				{name: "Mix", entries: []string{}},
+				{name: "mix (2)", entries: []string{}},
+			},
+			conflicts: []string{SyncConflictName},
+		},
+		{
+			name: "a concurrent reorder keeps entries added elsewhere",
+			batches: []*syncBatch{
+				created,
+				syncTestBatch("a", 2, 200, nil, syncOp{Op: syncOrderEntries, Playlist: "p", Order: []string{"e2", "e1"}}),
+				syncTestBatch("b", 1, 300, seenCreate, addOp("p", "e3", "three.mp3", 300)),
+			},
+			want: []mergedSummary{{name: "Road Trip", entries: []string{"e2", "e1", "e3"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, conflicts := mergeSyncBatches(test.batches)
+			if got := summarizeSyncDoc(doc); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("playlists = %+v, want %+v", got, test.want)
+			}
+			kinds := make([]string, 0, len(conflicts))
+			for _, conflict := range conflicts {
+				kinds = append(kinds, conflict.Kind)
+			}
+			if len(kinds) != len(test.conflicts) || (len(kinds) > 0 && !reflect.DeepEqual(kinds, test.conflicts)) {
+				t.Fatalf("conflicts = %v, want %v", kinds, test.conflicts)
+			}
+			for _, order := range permutations(test.batches) {
+				otherDoc, otherConflicts := mergeSyncBatches(order)
+				if !reflect.DeepEqual(otherDoc, doc) || !reflect.DeepEqual(otherConflicts, conflicts) {
+					t.Fatalf("merging in another order gave %+v and %+v, want %+v and %+v", otherDoc, otherConflicts, doc, conflicts)
+				}
+			}
+		})
+	}
+}
+
+func TestApplySyncDocKeepsLocalNames(t *testing.T) {
+	state := State{
+		Playlists:      []Playlist{{ID: "f", Name: "Albums", Source: &FolderSource{Dir: "/music/albums"}}},
+		SmartPlaylists: []SmartPlaylist{{ID: "s", Name: "Recent"}},
+	}
+	doc := syncDoc{Playlists: []syncPlaylist{
+		{ID: "a", Name: "albums"},
+		{ID: "b", Name: "Recent"},
+		{ID: "c", Name: "Recent (2)"},
+	}}
+	want := map[string]string{"f": "Albums", "a": "albums (2)", "b": "Recent (3)", "c": "Recent (2)"}
+	for range 2 {
+		applySyncDoc(&state, doc, syncDoc{})
+		for _, playlist := range state.Playlists {
+			if name, ok := want[playlist.ID]; ok && playlist.Name != name {
+				t.Errorf("playlist %s is named %q, want %q", playlist.ID, playlist.Name, name)
+			}
+		}
+	}
+}
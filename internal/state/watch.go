@@ -0,0 +1,96 @@
+package state
+
+import (
+	"os"
+	"time"
+)
+
+// SnapshotReload labels the snapshot of unsaved changes that an external
+// edit of state.json replaced.
+const SnapshotReload = "reload"
+
+// fileStamp identifies one version of a file well enough to notice that
+// something else rewrote it.
+type fileStamp struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func stampFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{path: path}
+	}
+	return fileStamp{path: path, modTime: info.ModTime(), size: info.Size()}
+}
+
+// Watch checks state.json for edits made outside the store every interval
+// and reloads it when it changes, until the returned function is called.
+// The file is polled rather than watched so it works the same on every
+// platform and on network drives.
+func (s *Store) Watch(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				_ = s.ReloadIfChanged()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// ReloadIfChanged reloads state.json if something other than the store has
+// written it since the store last read or wrote it. Unsaved changes in
+// memory are kept as a snapshot before being replaced. A file that does
+// not parse is ignored until it changes again, and overwritten by the next
+// save.
+func (s *Store) ReloadIfChanged() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded {
+		return nil
+	}
+	statePath, err := s.stateFilePath()
+	if err != nil {
+		return err
+	}
+	stamp := stampFile(statePath)
+	if stamp.modTime.IsZero() || stamp == s.stamp {
+		return nil
+	}
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return err
+	}
+	s.stamp = stamp
+	state, err := decodeState(data)
+	if err != nil {
+		return err
+	}
+	if s.dirty {
+		if _, err := s.takeSnapshot(SnapshotReload, s.state); err != nil {
+			return err
+		}
+		s.dirty = false
+		if s.timer != nil {
+			s.timer.Stop()
+			s.timer = nil
+		}
+	}
+	previous := s.state
+	s.state = state
+	s.publish(&previous, &s.state, ChangeFromFile)
+	if backupPath, err := s.backupFilePath(); err == nil {
+		_ = writeFileAtomic(backupPath, data)
+	}
+	return nil
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"embed"
+	"os"
 
 	"LiteSound/internal/app"
+	"LiteSound/internal/state"
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
@@ -21,18 +23,32 @@ var updateRepoOwner = "ptsfdtz"
 var updateRepoName = "LiteSound"
 
 func main() {
+	// The data directory comes from --data-dir, LITESOUND_DATA_DIR or a
+	// portable marker next to the executable; an empty one means the
+	// default location.
+	dataDir, err := state.ResolveDataDir("LiteSound", os.Args[1:])
+	if err != nil {
+		println("Error:", err.Error())
+	}
+
 	// Create an instance of the app structure
-	appInstance := app.NewApp(appVersion, updateRepoOwner, updateRepoName)
+	appInstance := app.NewApp(appVersion, updateRepoOwner, updateRepoName, dataDir)
+	preferences := app.Preferences(appInstance)
+	startState := options.Normal
+	if preferences.StartMinimized {
+		startState = options.Minimised
+	}
 
 	// Create application with options
-	err := wails.Run(&options.App{
+	err = wails.Run(&options.App{
 		Title:             "LiteSound",
-		Width:             1024,
-		Height:            768,
+		Width:             preferences.WindowWidth,
+		Height:            preferences.WindowHeight,
 		Frameless:         true,
-		HideWindowOnClose: true,
-		MinWidth:          904,
-		MinHeight:         500,
+		HideWindowOnClose: preferences.CloseToTray,
+		WindowStartState:  startState,
+		MinWidth:          state.MinWindowWidth,
+		MinHeight:         state.MinWindowHeight,
 		AssetServer: &assetserver.Options{
 			Assets: assets,
 		},